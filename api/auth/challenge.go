@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const challengePurpose = "mfa_challenge"
+
+var ErrInvalidChallenge = errors.New("Invalid or expired challenge")
+
+// derivedKey returns a key for tokens of purpose, derived from the API
+// secret so such a token can never pass as an access token, nor as a
+// token of another purpose.
+func derivedKey(purpose string) []byte {
+	sum := sha256.Sum256(append([]byte("reading "+purpose+"\x00"), secret...))
+	return sum[:]
+}
+
+func challengeKey() []byte {
+	return derivedKey(challengePurpose)
+}
+
+// CreateChallengeToken returns a token proving user_id gave the right
+// password, to be exchanged within ttl for an access token together with a
+// second factor.
+func CreateChallengeToken(user_id uint32, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{}
+	claims["purpose"] = challengePurpose
+	claims["user_id"] = user_id
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(challengeKey())
+}
+
+// ParseChallengeToken returns the user a challenge token was issued to.
+func ParseChallengeToken(tokenString string) (uint32, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return challengeKey(), nil
+	})
+	if err != nil {
+		return 0, ErrInvalidChallenge
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != challengePurpose {
+		return 0, ErrInvalidChallenge
+	}
+	uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
+	if err != nil {
+		return 0, ErrInvalidChallenge
+	}
+	return uint32(uid), nil
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// APIKeyPrefix starts every personal API key, telling them apart from
+// access tokens.
+const APIKeyPrefix = "rk_"
+
+// Scopes an API key can be given. Access tokens from a login have them all.
+// No scope lets a key change or delete the account itself.
+const (
+	ScopeBooksWrite    = "books:write"
+	ScopeAuthorsWrite  = "authors:write"
+	ScopeAuditRead     = "audit:read"
+	ScopeWebhooksWrite = "webhooks:write"
+)
+
+// Scopes lists every scope that can be granted to an API key.
+var Scopes = []string{ScopeBooksWrite, ScopeAuthorsWrite, ScopeAuditRead, ScopeWebhooksWrite}
+
+var ErrInvalidAPIKey = errors.New("Invalid or expired API key")
+
+// Principal is who a request acts for.
+type Principal struct {
+	UserID uint32
+	// APIKeyID is set when the request authenticated with an API key,
+	// which limits it to Scopes.
+	APIKeyID uint32
+	Scopes   []string
+	// Signed is set when the request came through a signed URL, which
+	// grants a GET of one path and no scopes.
+	Signed bool
+}
+
+// HasScope reports whether the principal may act within scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p.APIKeyID == 0 && !p.Signed {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyResolver looks up an API key. It returns ErrInvalidAPIKey for keys
+// that are unknown, revoked or expired.
+type APIKeyResolver func(ctx context.Context, key string) (*Principal, error)
+
+var resolveAPIKey APIKeyResolver
+
+// SetAPIKeyResolver sets how API keys are checked. Without one they are
+// refused.
+func SetAPIKeyResolver(f APIKeyResolver) {
+	resolveAPIKey = f
+}
+
+// IsAPIKey reports whether credential is an API key rather than a token.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+type principalKey struct{}
+
+// cachedPrincipal remembers the outcome of authenticating a request, so an
+// API key is looked up once however often the request is asked who it is.
+type cachedPrincipal struct {
+	done      bool
+	principal *Principal
+	err       error
+}
+
+// WithPrincipalCache prepares r to remember who it authenticated as.
+func WithPrincipalCache(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, &cachedPrincipal{}))
+}
+
+// Authenticate returns who the request's credential belongs to.
+func Authenticate(r *http.Request) (*Principal, error) {
+	cache, _ := r.Context().Value(principalKey{}).(*cachedPrincipal)
+	if cache != nil && cache.done {
+		return cache.principal, cache.err
+	}
+	p, err := authenticate(r)
+	if cache != nil {
+		cache.done, cache.principal, cache.err = true, p, err
+	}
+	return p, err
+}
+
+func authenticate(r *http.Request) (*Principal, error) {
+	credential := ExtractToken(r)
+	if credential == "" && IsSigned(r) {
+		uid, err := VerifySignedPath(r)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{UserID: uid, Signed: true}, nil
+	}
+	if !IsAPIKey(credential) {
+		claims, err := parseAccessToken(credential)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := claimsUserID(claims)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{UserID: uid}, nil
+	}
+	if resolveAPIKey == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return resolveAPIKey(r.Context(), credential)
+}
+
+// HasScope reports whether the request may act within scope.
+func HasScope(r *http.Request, scope string) bool {
+	p, err := Authenticate(r)
+	return err == nil && p.HasScope(scope)
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const signedURLPurpose = "signed_url"
+
+var ErrInvalidSignature = errors.New("Invalid or expired link")
+
+// SignPath returns the query parameters that let anyone holding them GET
+// urlPath on behalf of user_id until they expire after ttl. Unlike a token
+// in the URL they are good for that one path only and for a short time.
+func SignPath(urlPath string, user_id uint32, ttl time.Duration) (url.Values, time.Time) {
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	uid := strconv.FormatUint(uint64(user_id), 10)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		"uid":     {uid},
+		"expires": {exp},
+		"sig":     {pathSignature(urlPath, uid, exp)},
+	}, expires
+}
+
+// IsSigned reports whether r carries the parameters of a signed URL.
+func IsSigned(r *http.Request) bool {
+	return r.URL.Query().Get("sig") != ""
+}
+
+// VerifySignedPath returns the user a signed URL was made for, if r is a
+// GET or HEAD of the signed path before it expired.
+func VerifySignedPath(r *http.Request) (uint32, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return 0, ErrInvalidSignature
+	}
+	q := r.URL.Query()
+	uid, exp, sig := q.Get("uid"), q.Get("expires"), q.Get("sig")
+	want := pathSignature(r.URL.Path, uid, exp)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return 0, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return 0, ErrInvalidSignature
+	}
+	id, err := strconv.ParseUint(uid, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+	return uint32(id), nil
+}
+
+func pathSignature(urlPath, uid, expires string) string {
+	mac := hmac.New(sha256.New, derivedKey(signedURLPurpose))
+	mac.Write([]byte(urlPath + "\n" + uid + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var ErrInvalidState = errors.New("Invalid or expired state")
+
+// CreateStateToken signs values for purpose, to be handed to the client
+// and given back within ttl, for example in a cookie across a redirect.
+func CreateStateToken(purpose string, values map[string]string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{}
+	for k, v := range values {
+		claims[k] = v
+	}
+	claims["purpose"] = purpose
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(derivedKey(purpose))
+}
+
+// ParseStateToken returns the values of a token made by CreateStateToken
+// for purpose.
+func ParseStateToken(purpose, tokenString string) (map[string]string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return derivedKey(purpose), nil
+	})
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != purpose {
+		return nil, ErrInvalidState
+	}
+	values := make(map[string]string)
+	for k, v := range claims {
+		if s, ok := v.(string); ok && k != "purpose" {
+			values[k] = s
+		}
+	}
+	return values, nil
+}
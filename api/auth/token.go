@@ -1,89 +1,204 @@
 package auth
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/serg2013/reading/api/metrics"
 )
 
-func CreateToken(user_id uint32) (string, error) {
+var (
+	secret   []byte
+	tokenTTL = time.Hour
+	// queryTokenRoutes are the path patterns on which a token may be
+	// passed as a query parameter.
+	queryTokenRoutes []string
+)
+
+// Configure sets the key tokens are signed with and how long they last.
+func Configure(apiSecret string, ttl time.Duration) {
+	secret = []byte(apiSecret)
+	tokenTTL = ttl
+}
+
+// AllowQueryTokens lets requests to paths matching one of patterns, in
+// path.Match syntax, pass their token as ?token=. Tokens in URLs end up in
+// logs, browser history and Referer headers, so keep the list short and
+// prefer signed URLs.
+func AllowQueryTokens(patterns []string) {
+	queryTokenRoutes = patterns
+}
+
+// Authentication methods recorded in the amr claim, as named by RFC 8176.
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	AMRMFA      = "mfa"
+	// AMROIDC is not registered in RFC 8176. It marks a login through the
+	// OpenID Connect provider, followed by the methods the provider used.
+	AMROIDC = "oidc"
+)
+
+// CreateToken returns an access token for user_id. amr lists how the user
+// proved who they are, so routes can demand more than a password.
+func CreateToken(user_id uint32, amr ...string) (string, error) {
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["user_id"] = user_id
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix() //Token expires after 1 hour
+	claims["amr"] = amr
+	claims["exp"] = time.Now().Add(tokenTTL).Unix()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+	return token.SignedString(secret)
 
 }
 
+// TokenValid checks the request's access token or API key.
 func TokenValid(r *http.Request) error {
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+	_, err := Authenticate(r)
 	if err != nil {
-		return err
-	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		Pretty(claims)
+		metrics.TokenValidationFailures.Inc(failureReason(ExtractToken(r), err))
 	}
-	return nil
+	return err
 }
 
+// ExtractToken returns the request's credential: an X-API-Key header, a
+// Bearer Authorization header or, on routes allowed by AllowQueryTokens, a
+// token query parameter.
 func ExtractToken(r *http.Request) string {
-	keys := r.URL.Query()
-	token := keys.Get("token")
-	//log.Println(token)
-	if token != "" {
-		return token
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		return bearerToken(header)
 	}
-	bearerToken := r.Header.Get("Authorization")
-	//log.Println(bearerToken)
-	if len(strings.Split(bearerToken, " ")) == 2 {
-		return strings.Split(bearerToken, " ")[1]
+	if queryTokenAllowed(r.URL.Path) {
+		return r.URL.Query().Get("token")
 	}
 	return ""
 }
 
+// bearerToken returns the token of an Authorization header using the
+// Bearer scheme, or "" for any other header.
+func bearerToken(header string) string {
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	token := strings.TrimSpace(parts[1])
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return ""
+	}
+	return token
+}
+
+func queryTokenAllowed(urlPath string) bool {
+	for _, pattern := range queryTokenRoutes {
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractTokenID returns the ID of the user the request acts for.
 func ExtractTokenID(r *http.Request) (uint32, error) {
-	tokenString := ExtractToken(r)
+	p, err := Authenticate(r)
+	if err != nil {
+		return 0, err
+	}
+	return p.UserID, nil
+}
+
+// parseAccessToken checks an access token and returns its claims.
+func parseAccessToken(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("API_SECRET")), nil
+		return secret, nil
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
-		if err != nil {
-			return 0, err
+	if !ok || !token.Valid {
+		return nil, jwt.NewValidationError("token is invalid", jwt.ValidationErrorMalformed)
+	}
+	return claims, nil
+}
+
+// claimsUserID returns the user of an access token's claims.
+func claimsUserID(claims jwt.MapClaims) (uint32, error) {
+	uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(uid), nil
+}
+
+// ExtractAMR returns the authentication methods recorded in the request's
+// access token.
+func ExtractAMR(r *http.Request) ([]string, error) {
+	claims, err := parseAccessToken(ExtractToken(r))
+	if err != nil {
+		return nil, err
+	}
+	// Tokens issued before the claim existed have none
+	list, _ := claims["amr"].([]interface{})
+	amr := make([]string, 0, len(list))
+	for _, m := range list {
+		if s, ok := m.(string); ok {
+			amr = append(amr, s)
 		}
-		return uint32(uid), nil
 	}
-	return 0, nil
+	return amr, nil
 }
 
-//Pretty display the claims licely in the terminal
-func Pretty(data interface{}) {
-	b, err := json.MarshalIndent(data, "", " ")
+// HasAMR reports whether the request's access token records method.
+func HasAMR(r *http.Request, method string) bool {
+	amr, err := ExtractAMR(r)
 	if err != nil {
-		log.Println(err)
-		return
+		return false
 	}
+	for _, m := range amr {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
 
-	fmt.Println(string(b))
+// failureReason classifies a token validation error for metrics.
+func failureReason(tokenString string, err error) string {
+	if err == ErrInvalidSignature {
+		return "signed_url"
+	}
+	if tokenString == "" {
+		return "missing"
+	}
+	if IsAPIKey(tokenString) {
+		return "api_key"
+	}
+	ve, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return "invalid"
+	}
+	switch {
+	case ve.Errors&jwt.ValidationErrorMalformed != 0:
+		return "malformed"
+	case ve.Errors&jwt.ValidationErrorUnverifiable != 0:
+		return "unverifiable"
+	case ve.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return "signature"
+	case ve.Errors&jwt.ValidationErrorExpired != 0:
+		return "expired"
+	case ve.Errors&jwt.ValidationErrorNotValidYet != 0:
+		return "not_yet_valid"
+	}
+	return "invalid"
 }
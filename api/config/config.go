@@ -0,0 +1,545 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the complete server configuration. See Load for where each
+// value comes from.
+type Config struct {
+	Server      ServerConfig      `yaml:"server" json:"server"`
+	GRPC        GRPCConfig        `yaml:"grpc" json:"grpc"`
+	Database    DatabaseConfig    `yaml:"database" json:"database"`
+	Auth        AuthConfig        `yaml:"auth" json:"auth"`
+	OIDC        OIDCConfig        `yaml:"oidc" json:"oidc"`
+	CORS        CORSConfig        `yaml:"cors" json:"cors"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" json:"rate_limit"`
+	Idempotency IdempotencyConfig `yaml:"idempotency" json:"idempotency"`
+	Batch       BatchConfig       `yaml:"batch" json:"batch"`
+	GraphQL     GraphQLConfig     `yaml:"graphql" json:"graphql"`
+	Events      EventsConfig      `yaml:"events" json:"events"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks" json:"webhooks"`
+	API         APIConfig         `yaml:"api" json:"api"`
+	Password    PasswordConfig    `yaml:"password" json:"password"`
+	Mail        MailConfig        `yaml:"mail" json:"mail"`
+	Log         LogConfig         `yaml:"log" json:"log"`
+	Dev         DevConfig         `yaml:"dev" json:"dev"`
+}
+
+type ServerConfig struct {
+	Addr              string        `yaml:"addr" json:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" json:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" json:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" json:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" json:"idle_timeout"`
+	// ShutdownTimeout bounds how long in-flight requests may take to
+	// finish after SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+	// MaxBodyBytes is the largest request body accepted.
+	MaxBodyBytes int `yaml:"max_body_bytes" json:"max_body_bytes"`
+}
+
+// GRPCConfig sets up the gRPC API for internal services. It shares the
+// shutdown timeout of ServerConfig.
+type GRPCConfig struct {
+	// Addr is where the gRPC API listens, on its own port. Empty, the
+	// default, turns it off.
+	Addr string `yaml:"addr" json:"addr"`
+}
+
+// DatabaseConfig selects and configures the database. For SQLite only
+// Driver and Name, the file path, are used.
+type DatabaseConfig struct {
+	Driver      string `yaml:"driver" json:"driver"`
+	Host        string `yaml:"host" json:"host"`
+	Port        string `yaml:"port" json:"port"`
+	User        string `yaml:"user" json:"user"`
+	Password    Secret `yaml:"password" json:"password"`
+	Name        string `yaml:"name" json:"name"`
+	SSLMode     string `yaml:"sslmode" json:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert" json:"sslrootcert"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns" json:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" json:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" json:"conn_max_lifetime"`
+}
+
+type AuthConfig struct {
+	Secret   Secret        `yaml:"secret" json:"secret"`
+	TokenTTL time.Duration `yaml:"token_ttl" json:"token_ttl"`
+	// ResetTokenTTL and VerifyTokenTTL are the lifetimes of the single-use
+	// tokens mailed for password reset and email verification.
+	ResetTokenTTL  time.Duration `yaml:"reset_token_ttl" json:"reset_token_ttl"`
+	VerifyTokenTTL time.Duration `yaml:"verify_token_ttl" json:"verify_token_ttl"`
+	// RequireVerifiedEmail refuses logins until the email is verified.
+	RequireVerifiedEmail bool `yaml:"require_verified_email" json:"require_verified_email"`
+	// MFAChallengeTTL is how long a user with two-factor login has to
+	// enter their code after giving the right password.
+	MFAChallengeTTL time.Duration `yaml:"mfa_challenge_ttl" json:"mfa_challenge_ttl"`
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string `yaml:"totp_issuer" json:"totp_issuer"`
+	// AdminRequiresMFA restricts admin only routes to tokens issued after
+	// a second factor.
+	AdminRequiresMFA bool `yaml:"admin_requires_mfa" json:"admin_requires_mfa"`
+	// APIKeyDefaultTTL is the lifetime of API keys created without an
+	// expiry, and APIKeyMaxTTL the longest one allowed.
+	APIKeyDefaultTTL time.Duration `yaml:"api_key_default_ttl" json:"api_key_default_ttl"`
+	APIKeyMaxTTL     time.Duration `yaml:"api_key_max_ttl" json:"api_key_max_ttl"`
+	// QueryTokenRoutes are path patterns, in path.Match syntax, on which an
+	// access token is accepted as ?token= for clients that cannot set
+	// headers. Empty by default; signed download URLs are safer.
+	QueryTokenRoutes []string `yaml:"query_token_routes" json:"query_token_routes"`
+	// DownloadURLTTL is how long a signed download URL works.
+	DownloadURLTTL time.Duration `yaml:"download_url_ttl" json:"download_url_ttl"`
+}
+
+// CORSConfig is the policy for browsers calling the API from other origins.
+// Routes replaces it for the paths under a prefix, such as "/auth"; the
+// longest matching prefix wins and an empty policy turns CORS off.
+type CORSConfig struct {
+	CORSPolicy `yaml:",inline"`
+	Routes     map[string]CORSPolicy `yaml:"routes" json:"routes"`
+}
+
+type CORSPolicy struct {
+	// AllowedOrigins are origins such as https://example.com. One leading
+	// wildcard label, as in https://*.example.com, matches any subdomain,
+	// and "*" any origin.
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods" json:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers" json:"allowed_headers"`
+	// ExposedHeaders are the response headers scripts may read.
+	ExposedHeaders []string `yaml:"exposed_headers" json:"exposed_headers"`
+	// AllowCredentials lets browsers send cookies. Browsers refuse it
+	// together with the "*" origin.
+	AllowCredentials bool `yaml:"allow_credentials" json:"allow_credentials"`
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration `yaml:"max_age" json:"max_age"`
+}
+
+// IdempotencyConfig sets how long responses to requests with an
+// Idempotency-Key header are kept for retries.
+type IdempotencyConfig struct {
+	TTL time.Duration `yaml:"ttl" json:"ttl"`
+	// LockTimeout is how long a request may run before a retry with its key
+	// takes over, taking the first one to have died. Keep it above
+	// server.write_timeout.
+	LockTimeout time.Duration `yaml:"lock_timeout" json:"lock_timeout"`
+}
+
+// APIConfig announces the retirement of API versions.
+type APIConfig struct {
+	// Legacy serves the v1 routes also without the /v1 prefix, as they
+	// were before the API was versioned.
+	Legacy LegacyConfig `yaml:"legacy" json:"legacy"`
+	// Deprecated maps versions, such as "v1", to their retirement.
+	Deprecated map[string]Deprecation `yaml:"deprecated" json:"deprecated"`
+}
+
+type LegacyConfig struct {
+	Enabled     bool `yaml:"enabled" json:"enabled"`
+	Deprecation `yaml:",inline"`
+}
+
+// Deprecation is announced in the headers of every response: Since is
+// when clients were told to move on, Sunset when the routes go away.
+type Deprecation struct {
+	Since  time.Time `yaml:"since" json:"since"`
+	Sunset time.Time `yaml:"sunset" json:"sunset"`
+}
+
+// BatchConfig limits the batch endpoints.
+type BatchConfig struct {
+	// MaxOperations is the most operations one batch request may hold.
+	MaxOperations int `yaml:"max_operations" json:"max_operations"`
+}
+
+// GraphQLConfig sets up /graphql and how much one query may ask for.
+type GraphQLConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// MaxDepth is how deeply fields may be nested.
+	MaxDepth int `yaml:"max_depth" json:"max_depth"`
+	// MaxComplexity caps the fields a query may resolve, counting those
+	// under a list once for every item the list may hold.
+	MaxComplexity int `yaml:"max_complexity" json:"max_complexity"`
+	// PageSize is how many items a list returns when the query does not
+	// say, and MaxPageSize the most it may ask for.
+	PageSize    int `yaml:"page_size" json:"page_size"`
+	MaxPageSize int `yaml:"max_page_size" json:"max_page_size"`
+}
+
+// EventsConfig sets how the domain events of the outbox are handed to the
+// subscribers in the server, such as the webhooks.
+type EventsConfig struct {
+	// Enabled dispatches events from this server. Events are stored
+	// either way, and dispatched once a server with it on catches up.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// PollInterval is how often pending events are looked for.
+	PollInterval time.Duration `yaml:"poll_interval" json:"poll_interval"`
+	// An event a subscriber failed on is retried after MinBackoff,
+	// doubling per attempt up to MaxBackoff, until it succeeds.
+	MinBackoff time.Duration `yaml:"min_backoff" json:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff" json:"max_backoff"`
+	// Retention is how long dispatched events are kept.
+	Retention time.Duration `yaml:"retention" json:"retention"`
+}
+
+// WebhooksConfig sets how events are sent to webhook subscriptions.
+type WebhooksConfig struct {
+	// Enabled sends queued deliveries from this server. They are queued
+	// either way, and sent once a server with it on catches up.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// AllowHTTP accepts webhook URLs without TLS, for development.
+	AllowHTTP bool `yaml:"allow_http" json:"allow_http"`
+	// Timeout bounds one attempt, PollInterval is how often queued events
+	// are looked for.
+	Timeout      time.Duration `yaml:"timeout" json:"timeout"`
+	PollInterval time.Duration `yaml:"poll_interval" json:"poll_interval"`
+	// A failed delivery is retried after MinBackoff, doubling per attempt
+	// up to MaxBackoff, and given up after MaxAttempts.
+	MinBackoff  time.Duration `yaml:"min_backoff" json:"min_backoff"`
+	MaxBackoff  time.Duration `yaml:"max_backoff" json:"max_backoff"`
+	MaxAttempts int           `yaml:"max_attempts" json:"max_attempts"`
+}
+
+// RateLimitConfig sets request quotas, in requests per minute (0 disables a
+// quota), and the brute-force protection of /login.
+type RateLimitConfig struct {
+	LoginPerIP      int `yaml:"login_per_ip" json:"login_per_ip"`
+	LoginPerAccount int `yaml:"login_per_account" json:"login_per_account"`
+	WritePerIP      int `yaml:"write_per_ip" json:"write_per_ip"`
+	WritePerUser    int `yaml:"write_per_user" json:"write_per_user"`
+
+	// After DelayAfter failed logins an account must wait BaseDelay before
+	// the next attempt, doubling per failure up to MaxDelay. After
+	// LockAfter failures it is locked for LockFor.
+	DelayAfter int           `yaml:"delay_after" json:"delay_after"`
+	BaseDelay  time.Duration `yaml:"base_delay" json:"base_delay"`
+	MaxDelay   time.Duration `yaml:"max_delay" json:"max_delay"`
+	LockAfter  int           `yaml:"lock_after" json:"lock_after"`
+	LockFor    time.Duration `yaml:"lock_for" json:"lock_for"`
+}
+
+// OIDCConfig enables signing in with an OpenID Connect provider.
+// DiscoveryURL defaults to the issuer's /.well-known/openid-configuration.
+// RedirectURL must be this API's /v1/auth/oidc/callback as registered with
+// the provider. AllowSignup creates accounts for unknown verified emails.
+type OIDCConfig struct {
+	Enabled      bool     `yaml:"enabled" json:"enabled"`
+	Issuer       string   `yaml:"issuer" json:"issuer"`
+	DiscoveryURL string   `yaml:"discovery_url" json:"discovery_url"`
+	ClientID     string   `yaml:"client_id" json:"client_id"`
+	ClientSecret Secret   `yaml:"client_secret" json:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url" json:"redirect_url"`
+	Scopes       []string `yaml:"scopes" json:"scopes"`
+	AllowSignup  bool     `yaml:"allow_signup" json:"allow_signup"`
+}
+
+// PasswordConfig sets the strength rules for new passwords. Passwords on
+// the built-in breached list, or on the one in BreachedList, are refused.
+type PasswordConfig struct {
+	MinLength     int    `yaml:"min_length" json:"min_length"`
+	MaxLength     int    `yaml:"max_length" json:"max_length"`
+	RequireUpper  bool   `yaml:"require_upper" json:"require_upper"`
+	RequireLower  bool   `yaml:"require_lower" json:"require_lower"`
+	RequireDigit  bool   `yaml:"require_digit" json:"require_digit"`
+	RequireSymbol bool   `yaml:"require_symbol" json:"require_symbol"`
+	BreachedList  string `yaml:"breached_list" json:"breached_list"`
+}
+
+// MailConfig selects how mail is sent: "smtp", "file" to write each
+// message to Dir, or "log" to write it to the log.
+type MailConfig struct {
+	Driver string `yaml:"driver" json:"driver"`
+	From   string `yaml:"from" json:"from"`
+	// LinkBaseURL is the web app the mailed links point to, e.g.
+	// https://reading.example.com/reset-password?token=...
+	LinkBaseURL  string `yaml:"link_base_url" json:"link_base_url"`
+	Dir          string `yaml:"dir" json:"dir"`
+	SMTPHost     string `yaml:"smtp_host" json:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port" json:"smtp_port"`
+	SMTPUser     string `yaml:"smtp_user" json:"smtp_user"`
+	SMTPPassword Secret `yaml:"smtp_password" json:"smtp_password"`
+}
+
+// Supported mail drivers.
+const (
+	MailSMTP = "smtp"
+	MailFile = "file"
+	MailLog  = "log"
+)
+
+type LogConfig struct {
+	Level string `yaml:"level" json:"level"`
+}
+
+// DevConfig holds what only a development setup may turn on.
+type DevConfig struct {
+	// Seed empties the database on start, dropping every table with the
+	// outbox, audit trail, keys and webhooks, and fills it with sample
+	// users, authors and books. Never turn it on for real data.
+	Seed bool `yaml:"seed" json:"seed"`
+}
+
+// Default returns the configuration used for anything not set elsewhere.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+			MaxBodyBytes:      1 << 20,
+		},
+		Database: DatabaseConfig{
+			Driver:          Postgres,
+			Host:            "localhost",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Auth: AuthConfig{
+			TokenTTL:         time.Hour,
+			ResetTokenTTL:    time.Hour,
+			VerifyTokenTTL:   48 * time.Hour,
+			MFAChallengeTTL:  5 * time.Minute,
+			TOTPIssuer:       "reading",
+			APIKeyDefaultTTL: 90 * 24 * time.Hour,
+			APIKeyMaxTTL:     365 * 24 * time.Hour,
+			DownloadURLTTL:   5 * time.Minute,
+		},
+		OIDC: OIDCConfig{
+			Scopes:      []string{"openid", "email", "profile"},
+			AllowSignup: true,
+		},
+		CORS: CORSConfig{
+			CORSPolicy: CORSPolicy{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{http.MethodHead, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+				AllowedHeaders: []string{"Authorization", "Content-Type", "Idempotency-Key", "X-API-Key", "X-Request-Id"},
+				ExposedHeaders: []string{"Location", "Entity", "Idempotent-Replayed", "X-Request-Id", "Retry-After"},
+				MaxAge:         10 * time.Minute,
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:         24 * time.Hour,
+			LockTimeout: time.Minute,
+		},
+		Batch: BatchConfig{
+			MaxOperations: 100,
+		},
+		GraphQL: GraphQLConfig{
+			Enabled:       true,
+			MaxDepth:      15,
+			MaxComplexity: 1000,
+			PageSize:      20,
+			MaxPageSize:   100,
+		},
+		Events: EventsConfig{
+			Enabled:      true,
+			PollInterval: time.Second,
+			MinBackoff:   time.Second,
+			MaxBackoff:   5 * time.Minute,
+			Retention:    7 * 24 * time.Hour,
+		},
+		Webhooks: WebhooksConfig{
+			Enabled:      true,
+			Timeout:      10 * time.Second,
+			PollInterval: 5 * time.Second,
+			MinBackoff:   30 * time.Second,
+			MaxBackoff:   6 * time.Hour,
+			MaxAttempts:  10,
+		},
+		API: APIConfig{
+			Legacy: LegacyConfig{
+				Enabled: true,
+				Deprecation: Deprecation{
+					Since:  time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+					Sunset: time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		RateLimit: RateLimitConfig{
+			LoginPerIP:      20,
+			LoginPerAccount: 10,
+			WritePerIP:      120,
+			WritePerUser:    60,
+			DelayAfter:      3,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockAfter:       10,
+			LockFor:         15 * time.Minute,
+		},
+		Password: PasswordConfig{
+			MinLength: 8,
+			// bcrypt ignores everything after 72 bytes
+			MaxLength: 72,
+		},
+		Mail: MailConfig{
+			Driver:      MailLog,
+			From:        "reading@localhost",
+			LinkBaseURL: "http://localhost:8080",
+			Dir:         "mail",
+			SMTPPort:    "587",
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+	}
+}
+
+// Supported database drivers, named as gorm names its dialects.
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+	SQLite   = "sqlite3"
+)
+
+// DSN returns the connection string for the configured driver.
+func (d DatabaseConfig) DSN() string {
+	switch d.Driver {
+	case MySQL:
+		return d.mysqlDSN()
+	case SQLite:
+		return d.sqliteDSN()
+	default:
+		return d.postgresDSN()
+	}
+}
+
+func (d DatabaseConfig) postgresDSN() string {
+	port := d.Port
+	if port == "" {
+		port = "5432"
+	}
+	parts := []string{
+		"host=" + dsnValue(d.Host),
+		"port=" + dsnValue(port),
+		"user=" + dsnValue(d.User),
+		"dbname=" + dsnValue(d.Name),
+		"sslmode=" + dsnValue(d.SSLMode),
+		"password=" + dsnValue(d.Password.Value()),
+	}
+	if d.SSLRootCert != "" {
+		parts = append(parts, "sslrootcert="+dsnValue(d.SSLRootCert))
+	}
+	return strings.Join(parts, " ")
+}
+
+// dsnValue quotes v for a libpq key/value connection string when needed.
+func dsnValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// mysqlTLS maps the libpq style SSL modes onto the driver's tls parameter.
+var mysqlTLS = map[string]string{
+	"disable":     "false",
+	"allow":       "preferred",
+	"prefer":      "preferred",
+	"require":     "skip-verify",
+	"verify-ca":   "true",
+	"verify-full": "true",
+}
+
+func (d DatabaseConfig) mysqlDSN() string {
+	port := d.Port
+	if port == "" {
+		port = "3306"
+	}
+	c := mysql.NewConfig()
+	c.User = d.User
+	c.Passwd = d.Password.Value()
+	c.Net = "tcp"
+	c.Addr = net.JoinHostPort(d.Host, port)
+	c.DBName = d.Name
+	c.ParseTime = true
+	c.Loc = time.UTC
+	c.TLSConfig = mysqlTLS[d.SSLMode]
+	c.Params = map[string]string{"charset": "utf8mb4"}
+	return c.FormatDSN()
+}
+
+// sqliteDSN treats the database name as a file path, or ":memory:".
+func (d DatabaseConfig) sqliteDSN() string {
+	name := d.Name
+	if name == "" {
+		name = ":memory:"
+	}
+	return "file:" + name + "?_foreign_keys=1&cache=shared"
+}
+
+// String renders the configuration as YAML with secrets redacted.
+func (c Config) String() string {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(out)
+}
+
+// Secret is a configuration value that is never printed or logged.
+type Secret string
+
+const redacted = "[redacted]"
+
+// Value returns the secret itself.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// absoluteURL reports whether u is an absolute http(s) URL.
+func absoluteURL(u string) bool {
+	p, err := url.Parse(u)
+	return err == nil && (p.Scheme == "http" || p.Scheme == "https") && p.Host != ""
+}
+
+// validOrigin reports whether o is "*" or an absolute http(s) origin.
+func validOrigin(o string) bool {
+	if o == "*" {
+		return true
+	}
+	// A wildcard may only stand for the leftmost labels of the host.
+	if strings.Contains(o, "*") {
+		i := strings.Index(o, "://*.")
+		if i < 0 || strings.Count(o, "*") > 1 {
+			return false
+		}
+		o = o[:i] + "://x." + o[i+len("://*."):]
+	}
+	u, err := url.Parse(o)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && (u.Path == "" || u.Path == "/")
+}
@@ -0,0 +1,297 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+// Load builds the configuration from, in increasing order of precedence:
+//
+//  1. the defaults (see Default)
+//  2. a YAML file named by -config or CONFIG_FILE, if any
+//  3. environment variables, including those in an optional .env file
+//  4. command line flags
+//
+// The result is validated before it is returned.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("reading", flag.ContinueOnError)
+	path := fs.String("config", "", "path to a YAML configuration file")
+	fl := newFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// A missing .env is fine: real environment variables may be set.
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("config: reading .env: %v", err)
+	}
+
+	if *path == "" {
+		*path = os.Getenv("CONFIG_FILE")
+	}
+	if *path != "" {
+		if err := loadFile(&cfg, *path); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadEnv(&cfg); err != nil {
+		return nil, err
+	}
+	fl.apply(fs, &cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return fmt.Errorf("config: %s: %v", path, err)
+	}
+	return nil
+}
+
+// envVars maps environment variables onto configuration fields.
+var envVars = []struct {
+	name string
+	set  func(cfg *Config, v string) error
+}{
+	{"API_PORT", func(c *Config, v string) error { c.Server.Addr = ":" + v; return nil }},
+	{"API_ADDR", func(c *Config, v string) error { c.Server.Addr = v; return nil }},
+	{"GRPC_ADDR", func(c *Config, v string) error { c.GRPC.Addr = v; return nil }},
+	{"SERVER_READ_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+	{"SERVER_READ_HEADER_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Server.ReadHeaderTimeout })},
+	{"SERVER_WRITE_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+	{"SERVER_IDLE_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+	{"SERVER_SHUTDOWN_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{"SERVER_MAX_BODY_BYTES", intVar(func(c *Config) *int { return &c.Server.MaxBodyBytes })},
+	{"DB_DRIVER", func(c *Config, v string) error { c.Database.Driver = v; return nil }},
+	{"DB_HOST", func(c *Config, v string) error { c.Database.Host = v; return nil }},
+	{"DB_PORT", func(c *Config, v string) error { c.Database.Port = v; return nil }},
+	{"DB_USER", func(c *Config, v string) error { c.Database.User = v; return nil }},
+	{"DB_PASSWORD", func(c *Config, v string) error { c.Database.Password = Secret(v); return nil }},
+	{"DB_NAME", func(c *Config, v string) error { c.Database.Name = v; return nil }},
+	{"DB_SSLMODE", func(c *Config, v string) error { c.Database.SSLMode = v; return nil }},
+	{"DB_SSLROOTCERT", func(c *Config, v string) error { c.Database.SSLRootCert = v; return nil }},
+	{"DB_MAX_OPEN_CONNS", intVar(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+	{"DB_MAX_IDLE_CONNS", intVar(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+	{"DB_CONN_MAX_LIFETIME", durationVar(func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime })},
+	{"API_SECRET", func(c *Config, v string) error { c.Auth.Secret = Secret(v); return nil }},
+	{"TOKEN_TTL", durationVar(func(c *Config) *time.Duration { return &c.Auth.TokenTTL })},
+	{"RESET_TOKEN_TTL", durationVar(func(c *Config) *time.Duration { return &c.Auth.ResetTokenTTL })},
+	{"VERIFY_TOKEN_TTL", durationVar(func(c *Config) *time.Duration { return &c.Auth.VerifyTokenTTL })},
+	{"REQUIRE_VERIFIED_EMAIL", boolVar(func(c *Config) *bool { return &c.Auth.RequireVerifiedEmail })},
+	{"MFA_CHALLENGE_TTL", durationVar(func(c *Config) *time.Duration { return &c.Auth.MFAChallengeTTL })},
+	{"TOTP_ISSUER", func(c *Config, v string) error { c.Auth.TOTPIssuer = v; return nil }},
+	{"ADMIN_REQUIRES_MFA", boolVar(func(c *Config) *bool { return &c.Auth.AdminRequiresMFA })},
+	{"API_KEY_DEFAULT_TTL", durationVar(func(c *Config) *time.Duration { return &c.Auth.APIKeyDefaultTTL })},
+	{"API_KEY_MAX_TTL", durationVar(func(c *Config) *time.Duration { return &c.Auth.APIKeyMaxTTL })},
+	{"QUERY_TOKEN_ROUTES", func(c *Config, v string) error { c.Auth.QueryTokenRoutes = splitList(v); return nil }},
+	{"DOWNLOAD_URL_TTL", durationVar(func(c *Config) *time.Duration { return &c.Auth.DownloadURLTTL })},
+	{"OIDC_ENABLED", boolVar(func(c *Config) *bool { return &c.OIDC.Enabled })},
+	{"OIDC_ISSUER", func(c *Config, v string) error { c.OIDC.Issuer = v; return nil }},
+	{"OIDC_DISCOVERY_URL", func(c *Config, v string) error { c.OIDC.DiscoveryURL = v; return nil }},
+	{"OIDC_CLIENT_ID", func(c *Config, v string) error { c.OIDC.ClientID = v; return nil }},
+	{"OIDC_CLIENT_SECRET", func(c *Config, v string) error { c.OIDC.ClientSecret = Secret(v); return nil }},
+	{"OIDC_REDIRECT_URL", func(c *Config, v string) error { c.OIDC.RedirectURL = v; return nil }},
+	{"OIDC_SCOPES", func(c *Config, v string) error { c.OIDC.Scopes = splitList(v); return nil }},
+	{"OIDC_ALLOW_SIGNUP", boolVar(func(c *Config) *bool { return &c.OIDC.AllowSignup })},
+	{"CORS_ALLOWED_ORIGINS", func(c *Config, v string) error { c.CORS.AllowedOrigins = splitList(v); return nil }},
+	{"CORS_ALLOWED_METHODS", func(c *Config, v string) error { c.CORS.AllowedMethods = splitList(v); return nil }},
+	{"CORS_ALLOWED_HEADERS", func(c *Config, v string) error { c.CORS.AllowedHeaders = splitList(v); return nil }},
+	{"CORS_EXPOSED_HEADERS", func(c *Config, v string) error { c.CORS.ExposedHeaders = splitList(v); return nil }},
+	{"CORS_ALLOW_CREDENTIALS", boolVar(func(c *Config) *bool { return &c.CORS.AllowCredentials })},
+	{"CORS_MAX_AGE", durationVar(func(c *Config) *time.Duration { return &c.CORS.MaxAge })},
+	{"IDEMPOTENCY_TTL", durationVar(func(c *Config) *time.Duration { return &c.Idempotency.TTL })},
+	{"IDEMPOTENCY_LOCK_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Idempotency.LockTimeout })},
+	{"BATCH_MAX_OPERATIONS", intVar(func(c *Config) *int { return &c.Batch.MaxOperations })},
+	{"GRAPHQL_ENABLED", boolVar(func(c *Config) *bool { return &c.GraphQL.Enabled })},
+	{"GRAPHQL_MAX_DEPTH", intVar(func(c *Config) *int { return &c.GraphQL.MaxDepth })},
+	{"GRAPHQL_MAX_COMPLEXITY", intVar(func(c *Config) *int { return &c.GraphQL.MaxComplexity })},
+	{"EVENTS_ENABLED", boolVar(func(c *Config) *bool { return &c.Events.Enabled })},
+	{"EVENTS_RETENTION", durationVar(func(c *Config) *time.Duration { return &c.Events.Retention })},
+	{"WEBHOOKS_ENABLED", boolVar(func(c *Config) *bool { return &c.Webhooks.Enabled })},
+	{"WEBHOOKS_ALLOW_HTTP", boolVar(func(c *Config) *bool { return &c.Webhooks.AllowHTTP })},
+	{"WEBHOOKS_MAX_ATTEMPTS", intVar(func(c *Config) *int { return &c.Webhooks.MaxAttempts })},
+	{"DEV_SEED", boolVar(func(c *Config) *bool { return &c.Dev.Seed })},
+	{"API_LEGACY_ROUTES", boolVar(func(c *Config) *bool { return &c.API.Legacy.Enabled })},
+	{"API_LEGACY_SUNSET", timeVar(func(c *Config) *time.Time { return &c.API.Legacy.Sunset })},
+	{"RATE_LIMIT_LOGIN_PER_IP", intVar(func(c *Config) *int { return &c.RateLimit.LoginPerIP })},
+	{"RATE_LIMIT_LOGIN_PER_ACCOUNT", intVar(func(c *Config) *int { return &c.RateLimit.LoginPerAccount })},
+	{"RATE_LIMIT_WRITE_PER_IP", intVar(func(c *Config) *int { return &c.RateLimit.WritePerIP })},
+	{"RATE_LIMIT_WRITE_PER_USER", intVar(func(c *Config) *int { return &c.RateLimit.WritePerUser })},
+	{"LOGIN_LOCK_AFTER", intVar(func(c *Config) *int { return &c.RateLimit.LockAfter })},
+	{"LOGIN_LOCK_FOR", durationVar(func(c *Config) *time.Duration { return &c.RateLimit.LockFor })},
+	{"PASSWORD_MIN_LENGTH", intVar(func(c *Config) *int { return &c.Password.MinLength })},
+	{"PASSWORD_MAX_LENGTH", intVar(func(c *Config) *int { return &c.Password.MaxLength })},
+	{"PASSWORD_REQUIRE_UPPER", boolVar(func(c *Config) *bool { return &c.Password.RequireUpper })},
+	{"PASSWORD_REQUIRE_LOWER", boolVar(func(c *Config) *bool { return &c.Password.RequireLower })},
+	{"PASSWORD_REQUIRE_DIGIT", boolVar(func(c *Config) *bool { return &c.Password.RequireDigit })},
+	{"PASSWORD_REQUIRE_SYMBOL", boolVar(func(c *Config) *bool { return &c.Password.RequireSymbol })},
+	{"PASSWORD_BREACHED_LIST", func(c *Config, v string) error { c.Password.BreachedList = v; return nil }},
+	{"MAIL_DRIVER", func(c *Config, v string) error { c.Mail.Driver = v; return nil }},
+	{"MAIL_FROM", func(c *Config, v string) error { c.Mail.From = v; return nil }},
+	{"MAIL_LINK_BASE_URL", func(c *Config, v string) error { c.Mail.LinkBaseURL = v; return nil }},
+	{"MAIL_DIR", func(c *Config, v string) error { c.Mail.Dir = v; return nil }},
+	{"SMTP_HOST", func(c *Config, v string) error { c.Mail.SMTPHost = v; return nil }},
+	{"SMTP_PORT", func(c *Config, v string) error { c.Mail.SMTPPort = v; return nil }},
+	{"SMTP_USER", func(c *Config, v string) error { c.Mail.SMTPUser = v; return nil }},
+	{"SMTP_PASSWORD", func(c *Config, v string) error { c.Mail.SMTPPassword = Secret(v); return nil }},
+	{"LOG_LEVEL", func(c *Config, v string) error { c.Log.Level = v; return nil }},
+}
+
+func loadEnv(cfg *Config) error {
+	for _, e := range envVars {
+		v, ok := os.LookupEnv(e.name)
+		if !ok || v == "" {
+			continue
+		}
+		if err := e.set(cfg, v); err != nil {
+			return fmt.Errorf("config: %s: %v", e.name, err)
+		}
+	}
+	return nil
+}
+
+func durationVar(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func intVar(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func boolVar(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func timeVar(field func(*Config) *time.Time) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return err
+		}
+		*field(c) = t
+		return nil
+	}
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// flags holds the command line flags. Only flags given explicitly override
+// the file and environment.
+type flags struct {
+	addr            *string
+	grpcAddr        *string
+	dbDriver        *string
+	dbHost          *string
+	dbPort          *string
+	dbUser          *string
+	dbName          *string
+	dbSSLMode       *string
+	dbMaxOpenConns  *int
+	dbMaxIdleConns  *int
+	tokenTTL        *time.Duration
+	corsOrigins     *string
+	logLevel        *string
+	shutdownTimeout *time.Duration
+}
+
+// Secrets have no flags on purpose: command lines are visible to other
+// users of the machine.
+func newFlags(fs *flag.FlagSet) *flags {
+	return &flags{
+		addr:            fs.String("addr", "", "listen address, e.g. :8080"),
+		grpcAddr:        fs.String("grpc-addr", "", "gRPC listen address, e.g. :9090"),
+		dbDriver:        fs.String("db-driver", "", "database driver"),
+		dbHost:          fs.String("db-host", "", "database host"),
+		dbPort:          fs.String("db-port", "", "database port"),
+		dbUser:          fs.String("db-user", "", "database user"),
+		dbName:          fs.String("db-name", "", "database name"),
+		dbSSLMode:       fs.String("db-sslmode", "", "database SSL mode (disable, require, verify-ca, verify-full, ...)"),
+		dbMaxOpenConns:  fs.Int("db-max-open-conns", 0, "maximum open database connections"),
+		dbMaxIdleConns:  fs.Int("db-max-idle-conns", 0, "maximum idle database connections"),
+		tokenTTL:        fs.Duration("token-ttl", 0, "lifetime of issued access tokens"),
+		corsOrigins:     fs.String("cors-origins", "", "comma separated allowed CORS origins"),
+		logLevel:        fs.String("log-level", "", "log level (debug, info, warn, error)"),
+		shutdownTimeout: fs.Duration("shutdown-timeout", 0, "time allowed for in-flight requests on shutdown"),
+	}
+}
+
+func (f *flags) apply(fs *flag.FlagSet, cfg *Config) {
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "addr":
+			cfg.Server.Addr = *f.addr
+		case "grpc-addr":
+			cfg.GRPC.Addr = *f.grpcAddr
+		case "db-driver":
+			cfg.Database.Driver = *f.dbDriver
+		case "db-host":
+			cfg.Database.Host = *f.dbHost
+		case "db-port":
+			cfg.Database.Port = *f.dbPort
+		case "db-user":
+			cfg.Database.User = *f.dbUser
+		case "db-name":
+			cfg.Database.Name = *f.dbName
+		case "db-sslmode":
+			cfg.Database.SSLMode = *f.dbSSLMode
+		case "db-max-open-conns":
+			cfg.Database.MaxOpenConns = *f.dbMaxOpenConns
+		case "db-max-idle-conns":
+			cfg.Database.MaxIdleConns = *f.dbMaxIdleConns
+		case "token-ttl":
+			cfg.Auth.TokenTTL = *f.tokenTTL
+		case "cors-origins":
+			cfg.CORS.AllowedOrigins = splitList(*f.corsOrigins)
+		case "log-level":
+			cfg.Log.Level = *f.logLevel
+		case "shutdown-timeout":
+			cfg.Server.ShutdownTimeout = *f.shutdownTimeout
+		}
+	})
+}
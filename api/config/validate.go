@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"path"
+	"strings"
+	"time"
+)
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true,
+	"require": true, "verify-ca": true, "verify-full": true,
+}
+
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "warning": true, "error": true}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks that the configuration is complete and consistent.
+func (c *Config) Validate() error {
+	var p []string
+	add := func(format string, args ...interface{}) {
+		p = append(p, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.Addr == "" {
+		add("server.addr (API_ADDR) is required")
+	}
+	if c.GRPC.Addr != "" && c.GRPC.Addr == c.Server.Addr {
+		add("grpc.addr (GRPC_ADDR) must differ from server.addr")
+	}
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d <= 0 {
+			add("%s must be positive", t.name)
+		}
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		add("server.max_body_bytes (SERVER_MAX_BODY_BYTES) must be positive")
+	}
+
+	db := c.Database
+	switch db.Driver {
+	case Postgres, MySQL:
+		if db.Host == "" {
+			add("database.host (DB_HOST) is required")
+		}
+		if db.User == "" {
+			add("database.user (DB_USER) is required")
+		}
+		if db.Name == "" {
+			add("database.name (DB_NAME) is required")
+		}
+		if !sslModes[db.SSLMode] {
+			add("database.sslmode (DB_SSLMODE) %q is not one of disable, allow, prefer, require, verify-ca, verify-full", db.SSLMode)
+		}
+		if db.Driver == MySQL && db.SSLRootCert != "" {
+			add("database.sslrootcert (DB_SSLROOTCERT) is not supported for mysql")
+		}
+	case SQLite:
+	default:
+		add("database.driver (DB_DRIVER) %q is not one of %s, %s, %s", db.Driver, Postgres, MySQL, SQLite)
+	}
+	if db.MaxOpenConns < 0 || db.MaxIdleConns < 0 {
+		add("database pool sizes must not be negative")
+	}
+	if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		add("database.max_idle_conns (%d) exceeds database.max_open_conns (%d)", db.MaxIdleConns, db.MaxOpenConns)
+	}
+	if db.ConnMaxLifetime < 0 {
+		add("database.conn_max_lifetime must not be negative")
+	}
+
+	if c.Auth.Secret == "" {
+		add("auth.secret (API_SECRET) is required")
+	}
+	if c.Auth.TokenTTL <= 0 {
+		add("auth.token_ttl (TOKEN_TTL) must be positive")
+	}
+	if c.Auth.ResetTokenTTL <= 0 || c.Auth.VerifyTokenTTL <= 0 {
+		add("auth.reset_token_ttl and auth.verify_token_ttl must be positive")
+	}
+	if c.Auth.MFAChallengeTTL <= 0 {
+		add("auth.mfa_challenge_ttl (MFA_CHALLENGE_TTL) must be positive")
+	}
+	if c.Auth.APIKeyDefaultTTL <= 0 || c.Auth.APIKeyMaxTTL < c.Auth.APIKeyDefaultTTL {
+		add("auth.api_key_default_ttl must be positive and auth.api_key_max_ttl at least as long")
+	}
+	for _, pattern := range c.Auth.QueryTokenRoutes {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.HasPrefix(pattern, "/") {
+			add("auth.query_token_routes (QUERY_TOKEN_ROUTES) %q is not a path pattern", pattern)
+		}
+	}
+	if c.Auth.DownloadURLTTL <= 0 {
+		add("auth.download_url_ttl (DOWNLOAD_URL_TTL) must be positive")
+	}
+	if c.Auth.TOTPIssuer == "" || strings.Contains(c.Auth.TOTPIssuer, ":") {
+		add("auth.totp_issuer (TOTP_ISSUER) is required and must not contain a colon")
+	}
+
+	if o := c.OIDC; o.Enabled {
+		if !absoluteURL(o.Issuer) {
+			add("oidc.issuer (OIDC_ISSUER) %q is not an absolute http(s) URL", o.Issuer)
+		}
+		if o.DiscoveryURL != "" && !absoluteURL(o.DiscoveryURL) {
+			add("oidc.discovery_url (OIDC_DISCOVERY_URL) %q is not an absolute http(s) URL", o.DiscoveryURL)
+		}
+		if o.ClientID == "" {
+			add("oidc.client_id (OIDC_CLIENT_ID) is required")
+		}
+		if !absoluteURL(o.RedirectURL) {
+			add("oidc.redirect_url (OIDC_REDIRECT_URL) %q is not an absolute http(s) URL", o.RedirectURL)
+		}
+		hasOpenID := false
+		for _, s := range o.Scopes {
+			hasOpenID = hasOpenID || s == "openid"
+		}
+		if !hasOpenID {
+			add("oidc.scopes (OIDC_SCOPES) must include openid")
+		}
+	}
+
+	pw := c.Password
+	if pw.MinLength < 1 {
+		add("password.min_length (PASSWORD_MIN_LENGTH) must be at least 1")
+	}
+	if pw.MaxLength < pw.MinLength || pw.MaxLength > 72 {
+		add("password.max_length (PASSWORD_MAX_LENGTH) must be between min_length and 72")
+	}
+
+	m := c.Mail
+	switch m.Driver {
+	case MailSMTP:
+		if m.SMTPHost == "" {
+			add("mail.smtp_host (SMTP_HOST) is required for the smtp driver")
+		}
+	case MailFile:
+		if m.Dir == "" {
+			add("mail.dir (MAIL_DIR) is required for the file driver")
+		}
+	case MailLog:
+	default:
+		add("mail.driver (MAIL_DRIVER) %q is not one of %s, %s, %s", m.Driver, MailSMTP, MailFile, MailLog)
+	}
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		add("mail.from (MAIL_FROM) %q is not an email address", m.From)
+	}
+	if !absoluteURL(m.LinkBaseURL) {
+		add("mail.link_base_url (MAIL_LINK_BASE_URL) %q is not an absolute http(s) URL", m.LinkBaseURL)
+	}
+
+	validCORS := func(name string, p CORSPolicy) {
+		for _, o := range p.AllowedOrigins {
+			if !validOrigin(o) {
+				add("%s.allowed_origins: %q is not \"*\" or an origin such as https://example.com or https://*.example.com", name, o)
+			}
+			if o == "*" && p.AllowCredentials {
+				add("%s.allow_credentials cannot be used with the \"*\" origin", name)
+			}
+		}
+		if p.MaxAge < 0 {
+			add("%s.max_age must not be negative", name)
+		}
+	}
+	validCORS("cors", c.CORS.CORSPolicy)
+	for prefix, p := range c.CORS.Routes {
+		if !strings.HasPrefix(prefix, "/") {
+			add("cors.routes: %q is not a path prefix", prefix)
+		}
+		validCORS("cors.routes."+prefix, p)
+	}
+
+	if c.Idempotency.TTL <= 0 {
+		add("idempotency.ttl (IDEMPOTENCY_TTL) must be positive")
+	}
+	if c.Idempotency.LockTimeout <= 0 {
+		add("idempotency.lock_timeout (IDEMPOTENCY_LOCK_TIMEOUT) must be positive")
+	}
+
+	if c.Batch.MaxOperations < 1 {
+		add("batch.max_operations (BATCH_MAX_OPERATIONS) must be at least 1")
+	}
+
+	if g := c.GraphQL; g.Enabled {
+		if g.MaxDepth < 1 {
+			add("graphql.max_depth (GRAPHQL_MAX_DEPTH) must be at least 1")
+		}
+		if g.MaxComplexity < 1 {
+			add("graphql.max_complexity (GRAPHQL_MAX_COMPLEXITY) must be at least 1")
+		}
+		if g.PageSize < 1 || g.PageSize > g.MaxPageSize {
+			add("graphql.page_size must be between 1 and graphql.max_page_size")
+		}
+	}
+
+	if ev := c.Events; ev.Enabled {
+		if ev.PollInterval <= 0 {
+			add("events.poll_interval must be positive")
+		}
+		if ev.MinBackoff <= 0 || ev.MaxBackoff < ev.MinBackoff {
+			add("events.min_backoff must be positive and events.max_backoff at least as long")
+		}
+		if ev.Retention <= 0 {
+			add("events.retention (EVENTS_RETENTION) must be positive")
+		}
+	}
+
+	if wh := c.Webhooks; wh.Enabled {
+		if wh.Timeout <= 0 || wh.PollInterval <= 0 {
+			add("webhooks.timeout and webhooks.poll_interval must be positive")
+		}
+		if wh.MinBackoff <= 0 || wh.MaxBackoff < wh.MinBackoff {
+			add("webhooks.min_backoff must be positive and webhooks.max_backoff at least as long")
+		}
+		if wh.MaxAttempts < 1 {
+			add("webhooks.max_attempts (WEBHOOKS_MAX_ATTEMPTS) must be at least 1")
+		}
+	}
+
+	validDeprecation := func(name string, d Deprecation) {
+		if !d.Since.IsZero() && !d.Sunset.IsZero() && !d.Sunset.After(d.Since) {
+			add("%s.sunset must be after %s.since", name, name)
+		}
+	}
+	validDeprecation("api.legacy", c.API.Legacy.Deprecation)
+	for version, d := range c.API.Deprecated {
+		validDeprecation("api.deprecated."+version, d)
+	}
+
+	rl := c.RateLimit
+	if rl.LoginPerIP < 0 || rl.LoginPerAccount < 0 || rl.WritePerIP < 0 || rl.WritePerUser < 0 {
+		add("rate_limit quotas must not be negative")
+	}
+	if rl.DelayAfter < 0 || rl.LockAfter < 0 || rl.BaseDelay < 0 || rl.MaxDelay < rl.BaseDelay {
+		add("rate_limit delays must not be negative and max_delay must be at least base_delay")
+	}
+	if rl.LockAfter > 0 && rl.LockFor <= 0 {
+		add("rate_limit.lock_for must be positive when lock_after is set")
+	}
+
+	if !logLevels[strings.ToLower(c.Log.Level)] {
+		add("log.level (LOG_LEVEL) %q is not one of debug, info, warn, error", c.Log.Level)
+	}
+
+	if len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/badoux/checkmail"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/responses"
+	"github.com/serg2013/reading/api/services"
+)
+
+// RequestPasswordReset mails a password reset link
+// @Summary Requests a password reset
+// @Description Mails a single-use password reset link if an account has the email. The reply is the same either way.
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Param data body dto.PasswordResetRequest true "account email"
+// @Success 202
+// @Router /v1/auth/password-reset [post]
+func (server *Server) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	req := dto.PasswordResetRequest{}
+	if !server.decodeJSON(w, r, &req) {
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if err := checkmail.ValidateFormat(email); err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Invalid Email"))
+		return
+	}
+	user, token, err := server.service(r).RequestPasswordReset(email, server.config.Auth.ResetTokenTTL)
+	switch {
+	case err == nil:
+		server.sendPasswordReset(r, user, token)
+	case errors.Is(err, services.ErrNotFound):
+		// Answer as if it existed, so the endpoint does not reveal accounts
+	default:
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusAccepted, "")
+}
+
+// ConfirmPasswordReset sets a new password
+// @Summary Sets a new password
+// @Description Sets a new password with the token from a password reset link.
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Param data body dto.PasswordResetConfirmation true "token and new password"
+// @Success 204
+// @Router /v1/auth/password-reset/confirm [post]
+func (server *Server) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	req := dto.PasswordResetConfirmation{}
+	if !server.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Token == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Token"))
+		return
+	}
+	if err := server.passwords.Check(req.Password); err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err := server.service(r).ResetPassword(req.Token, req.Password)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// VerifyEmail confirms an email address
+// @Summary Verifies an email address
+// @Description Marks the email of an account as verified with the token from a verification link.
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Param data body dto.EmailVerification true "verification token"
+// @Success 204
+// @Router /v1/auth/verify-email [post]
+func (server *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	req := dto.EmailVerification{}
+	if !server.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Token == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Token"))
+		return
+	}
+	err := server.service(r).VerifyEmail(req.Token)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// ResendEmailVerification mails a new verification link
+// @Summary Resends the verification link
+// @Description Mails the signed in user a new email verification link.
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 202
+// @Router /v1/auth/verify-email/resend [post]
+func (server *Server) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	user, token, err := server.service(r).StartEmailVerification(uid, server.config.Auth.VerifyTokenTTL)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	server.sendEmailVerification(r, user, token)
+	responses.JSON(w, http.StatusAccepted, "")
+}
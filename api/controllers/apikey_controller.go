@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// CreateAPIKey creates a personal API key
+// @Summary Creates an API key
+// @Description Creates an API key for the signed in user. The key is in this reply only. Send it as "Authorization: Bearer <key>" or "X-API-Key: <key>".
+// @Tags API keys
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body dto.APIKeyRequest true "name, scopes and optional expiry"
+// @Success 201 {object} dto.APIKeyResponse
+// @Router /v1/api-keys [post]
+func (server *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	req := dto.APIKeyRequest{}
+	if !server.decodeJSON(w, r, &req) {
+		return
+	}
+	name := html.EscapeString(strings.TrimSpace(req.Name))
+	if name == "" || len(name) > 100 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Name of at most 100 characters"))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Scopes"))
+		return
+	}
+	for _, s := range req.Scopes {
+		if !knownScope(s) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("Unknown scope %q, expected one of %s", s, strings.Join(auth.Scopes, ", ")))
+			return
+		}
+	}
+	cfg := server.config.Auth
+	expiresAt := time.Now().Add(cfg.APIKeyDefaultTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(time.Now()) || expiresAt.After(time.Now().Add(cfg.APIKeyMaxTTL)) {
+		responses.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("Expiry must be in the future and within %s", cfg.APIKeyMaxTTL))
+		return
+	}
+	key, raw, err := server.service(r).CreateAPIKey(uid, name, req.Scopes, expiresAt)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	resp := dto.NewAPIKeyResponse(key)
+	resp.Key = raw
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, key.ID))
+	responses.JSON(w, http.StatusCreated, resp)
+}
+
+// GetAPIKeys lists the user's API keys
+// @Summary Lists API keys
+// @Description Lists the API keys of the signed in user, without the keys themselves.
+// @Tags API keys
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} dto.APIKeyResponse
+// @Router /v1/api-keys [get]
+func (server *Server) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	keys, err := server.service(r).ListAPIKeys(uid)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, dto.NewAPIKeyResponses(*keys))
+}
+
+// DeleteAPIKey revokes an API key
+// @Summary Revokes an API key
+// @Tags API keys
+// @Security ApiKeyAuth
+// @Param id path string true "API key ID"
+// @Success 204
+// @Router /v1/api-keys/{id} [delete]
+func (server *Server) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	err = server.service(r).DeleteAPIKey(uint32(id), uid)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", id))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func knownScope(scope string) bool {
+	for _, s := range auth.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
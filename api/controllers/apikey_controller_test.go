@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/models"
+)
+
+// createAPIKey returns a new API key of user with scopes.
+func createAPIKey(t *testing.T, server *Server, user *models.User, scopes ...string) string {
+	t.Helper()
+	w := do(server, "POST", "/v1/api-keys", dto.APIKeyRequest{Name: "test", Scopes: scopes}, "Authorization", bearer(tokenFor(t, user)))
+	expectStatus(t, w, http.StatusCreated)
+	resp := dto.APIKeyResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Key
+}
+
+func TestAPIKeysCannotManageTheAccount(t *testing.T) {
+	server := newTestServer(t)
+	user := createUser(t, server, "reader", "reader@example.com", "password", false)
+	key := createAPIKey(t, server, user, auth.Scopes...)
+	target := fmt.Sprintf("/v1/users/%d", user.ID)
+	change := dto.UserRequest{Nickname: "taken over", Email: "attacker@example.com", Password: "another password"}
+
+	for _, header := range []string{"Authorization", "X-API-Key"} {
+		value := key
+		if header == "Authorization" {
+			value = bearer(key)
+		}
+		t.Run(header, func(t *testing.T) {
+			expectStatus(t, do(server, "PUT", target, change, header, value), http.StatusForbidden)
+			expectStatus(t, do(server, "DELETE", target, nil, header, value), http.StatusForbidden)
+		})
+	}
+	stored := models.User{}
+	if err := server.DB.Where("id = ?", user.ID).Take(&stored).Error; err != nil {
+		t.Fatalf("user gone: %v", err)
+	}
+	if stored.Email != user.Email || models.VerifyPassword(stored.Password, "password") != nil {
+		t.Errorf("user changed through an API key: %+v", stored)
+	}
+
+	// A login still may
+	token := bearer(tokenFor(t, user))
+	change = dto.UserRequest{Nickname: "reader", Email: user.Email, Password: "a new password"}
+	expectStatus(t, do(server, "PUT", target, change, "Authorization", token), http.StatusOK)
+	expectStatus(t, do(server, "DELETE", target, nil, "Authorization", token), http.StatusNoContent)
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	server := newTestServer(t)
+	user := createUser(t, server, "reader", "reader@example.com", "password", false)
+	token := bearer(tokenFor(t, user))
+
+	w := do(server, "POST", "/v1/api-keys", dto.APIKeyRequest{Name: "test", Scopes: []string{"users:write"}}, "Authorization", token)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+
+	key := createAPIKey(t, server, user, auth.ScopeBooksWrite)
+	author := dto.AuthorRequest{Name: "Peter", Lastname: "Sidorov", Email: "p.sidorov@example.com"}
+	w = do(server, "POST", "/v1/authors", author, "X-API-Key", key)
+	expectStatus(t, w, http.StatusForbidden)
+	// Nor may a key make more keys
+	w = do(server, "POST", "/v1/api-keys", dto.APIKeyRequest{Name: "more", Scopes: []string{auth.ScopeBooksWrite}}, "X-API-Key", key)
+	expectStatus(t, w, http.StatusForbidden)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/responses"
+)
+
+const (
+	auditPageSize    = 100
+	auditMaxPageSize = 500
+	typeAudit        = "audit"
+)
+
+// GetAuditLogs func lists recorded changes, newest first.
+// @Description Lists recorded changes to users, authors and books, newest first, a page at a time. When there are older entries, the Link header has the URL of the next page, with rel=next. Admins only.
+// @Summary Lists audit log entries
+// @Tags Audit
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param resource query string false "Resource type (user, author, book)"
+// @Param actor query int false "Actor user ID"
+// @Param since query string false "RFC 3339 timestamp"
+// @Param page_size query int false "Entries per page, 100 by default and at most 500"
+// @Param page_token query string false "Page to read, from the Link header of the page before"
+// @Success 200 {array} models.AuditLog
+// @Header 200 {string} Link "URL of the next page, with rel=next"
+// @Router /v1/audit [get]
+func (server *Server) GetAuditLogs(w http.ResponseWriter, r *http.Request) {
+
+	if _, ok := server.adminID(w, r); !ok {
+		return
+	}
+
+	keys := r.URL.Query()
+	filter := models.AuditFilter{ResourceType: keys.Get("resource")}
+	if actor := keys.Get("actor"); actor != "" {
+		id, err := strconv.ParseUint(actor, 10, 32)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid actor"))
+			return
+		}
+		filter.ActorID = uint32(id)
+	}
+	if since := keys.Get("since"); since != "" {
+		var err error
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid since, expected RFC 3339"))
+			return
+		}
+	}
+
+	size := auditPageSize
+	if s := keys.Get("page_size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid page_size"))
+			return
+		}
+		if n > auditMaxPageSize {
+			n = auditMaxPageSize
+		}
+		size = n
+	}
+	before, err := readIDCursor(typeAudit, keys.Get("page_token"), 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid page_token"))
+		return
+	}
+	filter.Before = before
+	// One entry more than the page tells whether there is a next one
+	filter.Limit = size + 1
+
+	entry := models.AuditLog{}
+	logs, err := entry.FindAuditLogs(server.DB, filter)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(*logs) > size {
+		*logs = (*logs)[:size]
+		next := *r.URL
+		q := next.Query()
+		q.Set("page_token", idCursor(typeAudit, (*logs)[size-1].ID))
+		next.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	responses.JSON(w, http.StatusOK, logs)
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/serg2013/reading/api/models"
+)
+
+var nextLink = regexp.MustCompile(`^<([^>]+)>; rel="next"$`)
+
+func TestAuditLogPages(t *testing.T) {
+	server := newTestServer(t)
+	admin := createUser(t, server, "admin", "admin@example.com", "password", true)
+	token := bearer(tokenFor(t, admin))
+	for i := 0; i < 7; i++ {
+		resource := "book"
+		if i%2 == 1 {
+			resource = "author"
+		}
+		entry := models.AuditLog{Action: models.AuditCreate, ResourceType: resource, ResourceID: uint32(i + 1), CreatedAt: time.Now()}
+		if err := server.DB.Create(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Books are the entries 7, 5, 3 and 1, newest first
+	want := []uint32{7, 5, 3, 1}
+	got := []uint32{}
+	target := "/v1/audit?resource=book&page_size=3"
+	for pages := 0; target != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("the pages do not end")
+		}
+		w := do(server, "GET", target, nil, "Authorization", token)
+		expectStatus(t, w, http.StatusOK)
+		logs := []models.AuditLog{}
+		if err := json.Unmarshal(w.Body.Bytes(), &logs); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range logs {
+			got = append(got, l.ResourceID)
+		}
+		target = ""
+		if link := w.Header().Get("Link"); link != "" {
+			m := nextLink.FindStringSubmatch(link)
+			if m == nil {
+				t.Fatalf("Link = %q, want a next page", link)
+			}
+			target = m[1]
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read books %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("read books %v, want %v", got, want)
+		}
+	}
+
+	// A page that ends the log has no next one
+	w := do(server, "GET", "/v1/audit?page_size=7", nil, "Authorization", token)
+	expectStatus(t, w, http.StatusOK)
+	if link := w.Header().Get("Link"); link != "" {
+		t.Errorf("Link = %q on the last page", link)
+	}
+
+	for _, target := range []string{"/v1/audit?page_size=0", "/v1/audit?page_size=x", "/v1/audit?page_token=bogus", "/v1/audit?page_token=" + pageCursor("books", 3)} {
+		expectStatus(t, do(server, "GET", target, nil, "Authorization", token), http.StatusBadRequest)
+	}
+}
@@ -1,18 +1,15 @@
 package controllers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/serg2013/reading/api/auth"
-	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/dto"
 	"github.com/serg2013/reading/api/responses"
-	"github.com/serg2013/reading/api/utils/formaterror"
 )
 
 // CreateAuthor func creates a new author
@@ -22,38 +19,55 @@ import (
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Param data body models.Author true "book data"
-// @Success 200 {object} models.Author
-// @Router /authors [post]
+// @Param data body dto.AuthorRequest true "author data, optionally with their first book"
+// @Success 201 {object} dto.AuthorResponse
+// @Router /v1/authors [post]
 func (server *Server) CreateAuthor(w http.ResponseWriter, r *http.Request) {
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	req := dto.AuthorRequest{}
+	if !server.decodeJSON(w, r, &req) {
+		return
 	}
-	author := models.Author{}
-	err = json.Unmarshal(body, &author)
+	author := req.Model()
+	author.Prepare()
+	err := author.Validate("")
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	author.Prepare()
-	err = author.Validate("")
+	viewer := viewerID(r)
+	if req.FirstBook == nil {
+		authorCreated, err := server.service(r).CreateAuthor(&author)
+		if err != nil {
+			serviceError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, authorCreated.ID))
+		responses.JSON(w, http.StatusCreated, dto.NewAuthorResponse(authorCreated, viewer))
+		return
+	}
+
+	// The author and their first book are created atomically. The book's
+	// AuthorID is only known once the author exists, so a placeholder lets
+	// Validate check the remaining fields.
+	book := req.FirstBook.Model()
+	book.Prepare()
+	book.AuthorID = 1
+	err = book.Validate()
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	authorCreated, err := author.SaveAuthor(server.DB)
-
+	authorCreated, bookCreated, err := server.service(r).CreateAuthorWithBook(&author, &book)
 	if err != nil {
-
-		formattedError := formaterror.FormatError(err.Error())
-
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		serviceError(w, err)
 		return
 	}
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, authorCreated.ID))
-	responses.JSON(w, http.StatusCreated, authorCreated)
+	resp := dto.NewAuthorResponse(authorCreated, viewer)
+	bookResp := dto.NewBookResponse(bookCreated, viewer)
+	resp.FirstBook = &bookResp
+	responses.JSON(w, http.StatusCreated, resp)
 }
 
 // GetAuthors func gets all existing authors.
@@ -62,18 +76,24 @@ func (server *Server) CreateAuthor(w http.ResponseWriter, r *http.Request) {
 // @Tags Authors
 // @Accept json
 // @Produce json
-// @Success 200 {array} models.Author
-// @Router /authors [get]
+// @Param fields[books] query string false "book fields to return, e.g. id,title"
+// @Param fields[authors] query string false "author fields to return, e.g. id,name"
+// @Param include query string false "relations to embed: books"
+// @Success 200 {array} dto.AuthorResponse
+// @Router /v1/authors [get]
 func (server *Server) GetAuthors(w http.ResponseWriter, r *http.Request) {
 
-	author := models.Author{}
-
-	authors, err := author.FindAllAuthors(server.DB)
+	q, err := readQuery(r, dto.TypeAuthors)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	authors, err := server.service(r).ListAuthors(q)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, authors)
+	sparseJSON(w, http.StatusOK, dto.NewAuthorResponses(*authors, viewerID(r)), dto.TypeAuthors, q)
 }
 
 // GetAuthor func gets author by given ID or 404 error.
@@ -83,8 +103,11 @@ func (server *Server) GetAuthors(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Author ID"
-// @Success 200 {object} models.Author
-// @Router /authors/{id} [get]
+// @Param fields[books] query string false "book fields to return, e.g. id,title"
+// @Param fields[authors] query string false "author fields to return, e.g. id,name"
+// @Param include query string false "relations to embed: books"
+// @Success 200 {object} dto.AuthorResponse
+// @Router /v1/authors/{id} [get]
 func (server *Server) GetAuthor(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -93,13 +116,17 @@ func (server *Server) GetAuthor(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	author := models.Author{}
-	authorGotten, err := author.FindAuthorByID(server.DB, uint32(uid))
+	q, err := readQuery(r, dto.TypeAuthors)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, authorGotten)
+	authorGotten, err := server.service(r).GetAuthor(uint32(uid), q)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	sparseJSON(w, http.StatusOK, dto.NewAuthorResponse(authorGotten, viewerID(r)), dto.TypeAuthors, q)
 }
 
 // UpdateAuthor func updates existing author
@@ -110,9 +137,9 @@ func (server *Server) GetAuthor(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path string true "Author ID"
-// @Param data body models.Author true "book data"
-// @Success 200 {object} models.Author
-// @Router /authors/{id} [put]
+// @Param data body dto.AuthorRequest true "author data"
+// @Success 200 {object} dto.AuthorResponse
+// @Router /v1/authors/{id} [put]
 func (server *Server) UpdateAuthor(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -121,17 +148,11 @@ func (server *Server) UpdateAuthor(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	author := models.Author{}
-	err = json.Unmarshal(body, &author)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	req := dto.AuthorRequest{}
+	if !server.decodeJSON(w, r, &req) {
 		return
 	}
+	author := req.Model()
 	tokenID, err := auth.ExtractTokenID(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
@@ -147,13 +168,12 @@ func (server *Server) UpdateAuthor(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	updatedAuthor, err := author.UpdateAuthor(server.DB, uint32(uid))
+	updatedAuthor, err := server.service(r).UpdateAuthor(uint32(uid), &author)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		serviceError(w, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, updatedAuthor)
+	responses.JSON(w, http.StatusOK, dto.NewAuthorResponse(updatedAuthor, tokenID))
 }
 
 // DeleteAuthor func deletes author by given ID or 404 error.
@@ -164,14 +184,12 @@ func (server *Server) UpdateAuthor(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path string true "Author ID"
-// @Success 200 {object} models.Author
-// @Router /authors/{id} [delete]
+// @Success 204
+// @Router /v1/authors/{id} [delete]
 func (server *Server) DeleteAuthor(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 
-	author := models.Author{}
-
 	uid, err := strconv.ParseUint(vars["id"], 10, 32)
 
 	if err != nil {
@@ -187,9 +205,9 @@ func (server *Server) DeleteAuthor(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 		return
 	}
-	_, err = author.DeleteAuthor(server.DB, uint32(uid))
+	err = server.service(r).DeleteAuthor(uint32(uid))
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		serviceError(w, err)
 		return
 	}
 	w.Header().Set("Entity", fmt.Sprintf("%d", uint32(uid)))
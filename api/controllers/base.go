@@ -1,44 +1,401 @@
 package controllers
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
 	"github.com/jinzhu/gorm"
-	"github.com/rs/cors"
+	"google.golang.org/grpc"
 
+	_ "github.com/jinzhu/gorm/dialects/mysql"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/config"
+	"github.com/serg2013/reading/api/events"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/mail"
+	"github.com/serg2013/reading/api/metrics"
+	"github.com/serg2013/reading/api/middlewares"
 	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/oidc"
+	"github.com/serg2013/reading/api/password"
+	"github.com/serg2013/reading/api/ratelimit"
+	"github.com/serg2013/reading/api/responses"
+	"github.com/serg2013/reading/api/services"
+	"github.com/serg2013/reading/api/utils/formaterror"
+	"github.com/serg2013/reading/api/webhooks"
 )
 
 type Server struct {
 	DB     *gorm.DB
 	Router *mux.Router
+
+	config *config.Config
+
+	loginLimiter *ratelimit.Limiter
+	writeLimiter *ratelimit.Limiter
+	loginGuard   *ratelimit.LoginGuard
+
+	passwords *password.Policy
+	mailer    mail.Mailer
+	// oidc is nil unless login through an identity provider is enabled.
+	oidc *oidc.Provider
+	// graphql is nil unless /graphql is enabled.
+	graphql *graphql.Schema
+	// events hands the domain events to their subscribers.
+	events *events.Bus
+
+	// migrationErr is the result of the startup AutoMigrate, reported by /readyz.
+	migrationErr error
+	// draining is set once shutdown starts so /readyz fails while
+	// in-flight requests finish.
+	draining int32
+	// background tracks work started by requests that must finish before
+	// shutdown, such as sending mail.
+	background sync.WaitGroup
 }
 
-func (server *Server) Initialize(Dbdriver, DbUser, DbPassword, DbPort, DbHost, DbName string) {
+func (server *Server) Initialize(cfg *config.Config) {
 	var err error
-	DBURL := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", DbHost, DbPort, DbUser, DbName, DbPassword)
-	server.DB, err = gorm.Open(Dbdriver, DBURL)
+	server.config = cfg
+	db := cfg.Database
+	server.DB, err = gorm.Open(db.Driver, db.DSN())
+
+	if err != nil {
+		logger.Fatal(context.Background(), "cannot connect to database", logger.Fields{"driver": db.Driver, "error": err})
+	}
+	logger.Info(context.Background(), "connected to database", logger.Fields{"driver": db.Driver})
+
+	server.DB.DB().SetMaxOpenConns(db.MaxOpenConns)
+	server.DB.DB().SetMaxIdleConns(db.MaxIdleConns)
+	server.DB.DB().SetConnMaxLifetime(db.ConnMaxLifetime)
+	if db.Driver == config.SQLite {
+		// SQLite allows a single writer; sharing one connection avoids
+		// "database is locked" errors under concurrent requests.
+		server.DB.DB().SetMaxOpenConns(1)
+	}
 
+	// Queries are logged at debug level; see logger.GormLogger.
+	server.DB.SetLogger(logger.Gorm(context.Background()))
+	server.DB.LogMode(true)
+	metrics.RegisterGormCallbacks(server.DB)
+
+	server.migrationErr = models.Migrate(server.DB)
+	if server.migrationErr != nil {
+		logger.Error(context.Background(), "cannot migrate tables", logger.Fields{"error": server.migrationErr})
+	}
+
+	store := ratelimit.NewMemoryStore()
+	server.initializeRateLimits(store, store)
+
+	server.passwords, err = newPasswordPolicy(cfg.Password)
 	if err != nil {
-		fmt.Printf("Cannot connect to %s database", Dbdriver)
-		log.Fatal("This is the error:", err)
-	} else {
-		fmt.Printf("We are connected to the %s database", Dbdriver)
+		logger.Fatal(context.Background(), "cannot load breached password list", logger.Fields{"error": err})
+	}
+	server.mailer = newMailer(cfg.Mail)
+	if o := cfg.OIDC; o.Enabled {
+		server.oidc = oidc.NewProvider(o.Issuer, o.DiscoveryURL, o.ClientID, o.ClientSecret.Value(), o.RedirectURL, o.Scopes)
 	}
 
-	server.DB.Debug().AutoMigrate(&models.User{}, &models.Author{}, &models.Book{})
+	if cfg.GraphQL.Enabled {
+		schema, err := server.newGraphSchema()
+		if err != nil {
+			logger.Fatal(context.Background(), "cannot build GraphQL schema", logger.Fields{"error": err})
+		}
+		server.graphql = &schema
+	}
+
+	server.initializeEvents()
+
+	auth.SetAPIKeyResolver(func(ctx context.Context, key string) (*auth.Principal, error) {
+		return services.New(server.DB).AuthenticateAPIKey(key)
+	})
 
 	server.Router = mux.NewRouter()
 
 	server.initializeRoutes()
 }
 
-func (server *Server) Run(addr string) {
-	fmt.Println("Listening to port 8080")
-	cHandler := cors.Default().Handler(server.Router)
-	log.Fatal(http.ListenAndServe(addr, cHandler))
+// initializeEvents subscribes the side effects of changes to their domain
+// events.
+func (server *Server) initializeEvents() {
+	server.events = &events.Bus{}
+	server.events.Subscribe("webhooks", func(ctx context.Context, e *models.OutboxEvent) error {
+		return services.New(server.DB).QueueWebhooks(e)
+	})
+}
+
+// initializeRateLimits sets up request quotas on quotas and login lockout
+// on attempts, which may be the same store.
+func (server *Server) initializeRateLimits(quotas ratelimit.Store, attempts ratelimit.AttemptStore) {
+	rl := server.config.RateLimit
+	server.loginLimiter = ratelimit.NewLimiter(quotas,
+		ratelimit.Rule{Name: "login-ip", Limit: ratelimit.PerMinute(rl.LoginPerIP), Key: ratelimit.ByIP},
+		ratelimit.Rule{Name: "login-account", Limit: ratelimit.PerMinute(rl.LoginPerAccount), Key: ratelimit.ByLoginEmail},
+	)
+	server.writeLimiter = ratelimit.NewLimiter(quotas,
+		ratelimit.Rule{Name: "write-ip", Limit: ratelimit.PerMinute(rl.WritePerIP), Key: ratelimit.ByIP},
+		ratelimit.Rule{Name: "write-user", Limit: ratelimit.PerMinute(rl.WritePerUser), Key: ratelimit.ByUser},
+	)
+	server.loginGuard = &ratelimit.LoginGuard{
+		Store:      attempts,
+		DelayAfter: rl.DelayAfter,
+		BaseDelay:  rl.BaseDelay,
+		MaxDelay:   rl.MaxDelay,
+		LockAfter:  rl.LockAfter,
+		LockFor:    rl.LockFor,
+	}
+}
+
+func newPasswordPolicy(cfg config.PasswordConfig) (*password.Policy, error) {
+	breached := password.DefaultList()
+	if cfg.BreachedList != "" {
+		if err := breached.AddFile(cfg.BreachedList); err != nil {
+			return nil, err
+		}
+	}
+	return &password.Policy{
+		MinLength:     cfg.MinLength,
+		MaxLength:     cfg.MaxLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+		Breached:      breached,
+	}, nil
+}
+
+func newMailer(cfg config.MailConfig) mail.Mailer {
+	switch cfg.Driver {
+	case config.MailSMTP:
+		return &mail.SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPassword.Value(),
+			From:     cfg.From,
+		}
+	case config.MailFile:
+		return &mail.FileMailer{Dir: cfg.Dir, From: cfg.From}
+	default:
+		return &mail.LogMailer{From: cfg.From}
+	}
+}
+
+// Run serves the API until SIGINT or SIGTERM, then stops accepting
+// connections, lets in-flight requests finish and closes the database pool.
+func (server *Server) Run() {
+	cfg := server.config.Server
+	cHandler := newCORS(server.config.CORS)(server.Router)
+	mHandler := middlewares.SetMiddlewareMetrics(server.Router)(cHandler)
+	handler := middlewares.SetMiddlewareRequestID(middlewares.SetMiddlewareAccessLog(middlewares.SetMiddlewarePrincipalCache(mHandler)))
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		logger.Info(context.Background(), "listening", logger.Fields{"addr": cfg.Addr})
+		errs <- srv.ListenAndServe()
+	}()
+
+	var rpc *grpc.Server
+	if addr := server.config.GRPC.Addr; addr != "" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			logger.Fatal(context.Background(), "cannot listen for gRPC", logger.Fields{"error": err})
+		}
+		rpc = server.newGRPCServer()
+		go func() {
+			logger.Info(context.Background(), "listening for gRPC", logger.Fields{"addr": addr})
+			errs <- rpc.Serve(lis)
+		}()
+	}
+
+	dispatch, stopDispatch := context.WithCancel(context.Background())
+	defer stopDispatch()
+	dispatched := server.startDispatchers(dispatch)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	select {
+	case err := <-errs:
+		logger.Fatal(context.Background(), "server stopped", logger.Fields{"error": err})
+	case sig := <-stop:
+		logger.Info(context.Background(), "shutting down", logger.Fields{"signal": sig.String()})
+	}
+
+	atomic.StoreInt32(&server.draining, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error(context.Background(), "cannot drain connections", logger.Fields{"error": err})
+	}
+	if rpc != nil {
+		stopGRPC(ctx, rpc)
+	}
+	server.background.Wait()
+	// Work cut short is done again, by this or another server
+	stopDispatch()
+	<-dispatched
+	if err := server.DB.Close(); err != nil {
+		logger.Error(context.Background(), "cannot close database", logger.Fields{"error": err})
+	}
+	logger.Info(context.Background(), "server stopped", nil)
+}
+
+// startDispatchers hands the domain events to their subscribers and sends
+// the webhook deliveries until ctx ends, each unless turned off. The
+// returned channel is closed once they stopped.
+func (server *Server) startDispatchers(ctx context.Context) <-chan struct{} {
+	var running sync.WaitGroup
+	start := func(run func(ctx context.Context)) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			run(ctx)
+		}()
+	}
+	if ev := server.config.Events; ev.Enabled {
+		d := &events.Dispatcher{
+			DB:           server.DB,
+			Bus:          server.events,
+			PollInterval: ev.PollInterval,
+			MinBackoff:   ev.MinBackoff,
+			MaxBackoff:   ev.MaxBackoff,
+			Retention:    ev.Retention,
+		}
+		start(d.Run)
+	}
+	if wh := server.config.Webhooks; wh.Enabled {
+		d := &webhooks.Dispatcher{
+			DB:           server.DB,
+			Timeout:      wh.Timeout,
+			PollInterval: wh.PollInterval,
+			MinBackoff:   wh.MinBackoff,
+			MaxBackoff:   wh.MaxBackoff,
+			MaxAttempts:  wh.MaxAttempts,
+		}
+		start(d.Run)
+	}
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// stopGRPC lets the calls in flight finish, cancelling them when ctx ends.
+func stopGRPC(ctx context.Context, rpc *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		rpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Error(context.Background(), "cannot drain gRPC calls", logger.Fields{"error": ctx.Err()})
+		rpc.Stop()
+	}
+}
+
+// dbFor returns the database handle to use on behalf of r. It carries who
+// made the request and from where, so the model methods can write the audit
+// trail in the same transaction as the change, and it logs queries with the
+// request ID.
+func (server *Server) dbFor(r *http.Request) *gorm.DB {
+	actorID, _ := auth.ExtractTokenID(r)
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	db := models.WithAudit(server.DB, models.AuditMeta{
+		ActorID:   actorID,
+		RequestID: logger.RequestID(r.Context()),
+		IP:        ip,
+	})
+	db.SetLogger(logger.Gorm(r.Context()))
+	return db
+}
+
+// viewerID returns the ID of the user making r, or 0 if the request carries
+// no valid token. It decides how much of a profile a response may show.
+func viewerID(r *http.Request) uint32 {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return 0
+	}
+	return uid
+}
+
+// adminID returns the ID of the admin making r. Otherwise it writes 401
+// or 403 and returns false.
+func (server *Server) adminID(w http.ResponseWriter, r *http.Request) (uint32, bool) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return 0, false
+	}
+	user := models.User{}
+	admin, err := user.FindUserByID(server.DB, uid)
+	if err != nil || !admin.IsAdmin {
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return 0, false
+	}
+	return uid, true
+}
+
+// service returns the use cases bound to the database handle for r.
+func (server *Server) service(r *http.Request) *services.Service {
+	return services.New(server.dbFor(r))
+}
+
+// serviceError writes the response for an error returned by the service layer.
+func serviceError(w http.ResponseWriter, err error) {
+	status, shown := errorStatus(err)
+	responses.ERROR(w, status, shown)
+}
+
+// errorStatus returns the HTTP status for an error of the services and the
+// error to show the client.
+func errorStatus(err error) (int, error) {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound, err
+	case errors.Is(err, services.ErrUnauthorized),
+		errors.Is(err, auth.ErrInvalidAPIKey):
+		return http.StatusUnauthorized, err
+	case errors.Is(err, models.ErrInvalidToken):
+		return http.StatusBadRequest, err
+	case errors.Is(err, services.ErrAlreadyVerified),
+		errors.Is(err, services.ErrMFAEnabled),
+		errors.Is(err, services.ErrMFANotEnabled),
+		errors.Is(err, services.ErrMFANotStarted),
+		errors.Is(err, services.ErrTooManyAPIKeys):
+		return http.StatusConflict, err
+	case errors.Is(err, models.ErrInvalidCode):
+		return http.StatusUnprocessableEntity, err
+	default:
+		return http.StatusInternalServerError, formaterror.FormatError(err.Error())
+	}
 }
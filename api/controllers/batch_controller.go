@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/responses"
+	"github.com/serg2013/reading/api/services"
+)
+
+// batchOp applies one operation of a batch with svc. It returns the
+// response for the operation and its status. An error without a status is
+// one of the service layer's.
+type batchOp func(svc *services.Service) (interface{}, int, error)
+
+type batchOutcome struct {
+	status int
+	err    error
+	value  interface{}
+}
+
+// errBatchFailed rolls back an atomic batch.
+var errBatchFailed = errors.New("batch failed")
+
+// BatchBooks applies several operations on books
+// @Summary Creates, updates and deletes books in one request
+// @Description Applies up to the configured number of operations, each checked like the single book endpoints. With "atomic" all of them are applied in one transaction or none is; otherwise each on its own. The status is 200 if all succeeded, 207 if only some did, or that of the failed operation in an atomic batch.
+// @Tags Books
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body dto.BookBatchRequest true "operations"
+// @Success 200 {array} dto.BookBatchResult
+// @Router /v1/books:batch [post]
+func (server *Server) BatchBooks(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	req := dto.BookBatchRequest{}
+	if !server.decodeJSON(w, r, &req) {
+		return
+	}
+	if !server.checkBatchSize(w, len(req.Operations)) {
+		return
+	}
+	ops := make([]batchOp, len(req.Operations))
+	for i := range req.Operations {
+		o := req.Operations[i]
+		ops[i] = func(svc *services.Service) (interface{}, int, error) {
+			return bookOperation(svc, uid, o)
+		}
+	}
+	outcomes, status := server.runBatch(r, req.Atomic, ops)
+	results := make([]dto.BookBatchResult, len(outcomes))
+	for i, out := range outcomes {
+		results[i].BatchResult = out.result(i)
+		if book, ok := out.value.(dto.BookResponse); ok {
+			results[i].Book = &book
+		}
+	}
+	responses.JSON(w, status, results)
+}
+
+func bookOperation(svc *services.Service, uid uint32, o dto.BookOperation) (interface{}, int, error) {
+	switch o.Op {
+	case dto.OpCreate, dto.OpUpdate:
+		if o.Op == dto.OpUpdate && o.ID == 0 {
+			return nil, http.StatusUnprocessableEntity, errors.New("Required id")
+		}
+		if o.Book == nil {
+			return nil, http.StatusUnprocessableEntity, errors.New("Required book")
+		}
+		book := o.Book.Model()
+		book.Prepare()
+		if err := book.Validate(); err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+		if uid != book.AuthorID {
+			return nil, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized))
+		}
+		if o.Op == dto.OpCreate {
+			created, err := svc.CreateBook(&book)
+			if err != nil {
+				return nil, 0, err
+			}
+			return dto.NewBookResponse(created, uid), http.StatusCreated, nil
+		}
+		updated, err := svc.UpdateBook(o.ID, uid, &book)
+		if err != nil {
+			return nil, 0, err
+		}
+		return dto.NewBookResponse(updated, uid), http.StatusOK, nil
+	case dto.OpDelete:
+		if o.ID == 0 {
+			return nil, http.StatusUnprocessableEntity, errors.New("Required id")
+		}
+		if err := svc.DeleteBook(o.ID, uid); err != nil {
+			return nil, 0, err
+		}
+		return nil, http.StatusNoContent, nil
+	}
+	return nil, http.StatusUnprocessableEntity, unknownOp(o.Op)
+}
+
+// BatchAuthors applies several operations on authors
+// @Summary Creates, updates and deletes authors in one request
+// @Description Applies up to the configured number of operations, each checked like the single author endpoints. With "atomic" all of them are applied in one transaction or none is; otherwise each on its own. The status is 200 if all succeeded, 207 if only some did, or that of the failed operation in an atomic batch.
+// @Tags Authors
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body dto.AuthorBatchRequest true "operations"
+// @Success 200 {array} dto.AuthorBatchResult
+// @Router /v1/authors:batch [post]
+func (server *Server) BatchAuthors(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	req := dto.AuthorBatchRequest{}
+	if !server.decodeJSON(w, r, &req) {
+		return
+	}
+	if !server.checkBatchSize(w, len(req.Operations)) {
+		return
+	}
+	ops := make([]batchOp, len(req.Operations))
+	for i := range req.Operations {
+		o := req.Operations[i]
+		ops[i] = func(svc *services.Service) (interface{}, int, error) {
+			return authorOperation(svc, uid, o)
+		}
+	}
+	outcomes, status := server.runBatch(r, req.Atomic, ops)
+	results := make([]dto.AuthorBatchResult, len(outcomes))
+	for i, out := range outcomes {
+		results[i].BatchResult = out.result(i)
+		if author, ok := out.value.(dto.AuthorResponse); ok {
+			results[i].Author = &author
+		}
+	}
+	responses.JSON(w, status, results)
+}
+
+func authorOperation(svc *services.Service, uid uint32, o dto.AuthorOperation) (interface{}, int, error) {
+	switch o.Op {
+	case dto.OpCreate:
+		if o.Author == nil {
+			return nil, http.StatusUnprocessableEntity, errors.New("Required author")
+		}
+		author := o.Author.Model()
+		author.Prepare()
+		if err := author.Validate(""); err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+		if o.Author.FirstBook == nil {
+			created, err := svc.CreateAuthor(&author)
+			if err != nil {
+				return nil, 0, err
+			}
+			return dto.NewAuthorResponse(created, uid), http.StatusCreated, nil
+		}
+		// As in CreateAuthor, a placeholder AuthorID lets Validate check
+		// the rest of the book.
+		book := o.Author.FirstBook.Model()
+		book.Prepare()
+		book.AuthorID = 1
+		if err := book.Validate(); err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+		created, createdBook, err := svc.CreateAuthorWithBook(&author, &book)
+		if err != nil {
+			return nil, 0, err
+		}
+		resp := dto.NewAuthorResponse(created, uid)
+		bookResp := dto.NewBookResponse(createdBook, uid)
+		resp.FirstBook = &bookResp
+		return resp, http.StatusCreated, nil
+	case dto.OpUpdate:
+		if o.Author == nil {
+			return nil, http.StatusUnprocessableEntity, errors.New("Required author")
+		}
+		if o.ID != uid {
+			return nil, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized))
+		}
+		author := o.Author.Model()
+		author.Prepare()
+		if err := author.Validate("update"); err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+		updated, err := svc.UpdateAuthor(o.ID, &author)
+		if err != nil {
+			return nil, 0, err
+		}
+		return dto.NewAuthorResponse(updated, uid), http.StatusOK, nil
+	case dto.OpDelete:
+		if o.ID != uid {
+			return nil, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized))
+		}
+		if err := svc.DeleteAuthor(o.ID); err != nil {
+			return nil, 0, err
+		}
+		return nil, http.StatusNoContent, nil
+	}
+	return nil, http.StatusUnprocessableEntity, unknownOp(o.Op)
+}
+
+func unknownOp(op string) error {
+	return fmt.Errorf("Unknown op %q, expected %s, %s or %s", op, dto.OpCreate, dto.OpUpdate, dto.OpDelete)
+}
+
+// checkBatchSize refuses empty batches and ones over the configured size.
+func (server *Server) checkBatchSize(w http.ResponseWriter, n int) bool {
+	max := server.config.Batch.MaxOperations
+	if n == 0 || n > max {
+		responses.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("A batch must have between 1 and %d operations", max))
+		return false
+	}
+	return true
+}
+
+// runBatch applies ops and returns their outcomes and the status of the
+// whole batch. An atomic batch runs in one transaction and stops at the
+// first failure; otherwise every operation runs in its own.
+func (server *Server) runBatch(r *http.Request, atomic bool, ops []batchOp) ([]batchOutcome, int) {
+	outcomes := make([]batchOutcome, len(ops))
+	run := func(svc *services.Service, i int) bool {
+		value, status, err := ops[i](svc)
+		if err != nil && status == 0 {
+			status, err = errorStatus(err)
+		}
+		outcomes[i] = batchOutcome{status: status, err: err, value: value}
+		return err == nil
+	}
+
+	svc := server.service(r)
+	if !atomic {
+		failed := 0
+		for i := range ops {
+			if !run(svc, i) {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return outcomes, http.StatusMultiStatus
+		}
+		return outcomes, http.StatusOK
+	}
+
+	failedAt := -1
+	err := svc.WithTx(func(tx *services.Service) error {
+		for i := range ops {
+			if !run(tx, i) {
+				failedAt = i
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		return outcomes, http.StatusOK
+	}
+	if failedAt < 0 {
+		// The commit itself failed
+		status, shown := errorStatus(err)
+		for i := range outcomes {
+			outcomes[i] = batchOutcome{status: status, err: shown}
+		}
+		return outcomes, status
+	}
+	notApplied := fmt.Errorf("Not applied: operation %d failed", failedAt)
+	for i := range outcomes {
+		if i != failedAt {
+			outcomes[i] = batchOutcome{status: http.StatusFailedDependency, err: notApplied}
+		}
+	}
+	return outcomes, outcomes[failedAt].status
+}
+
+func (out batchOutcome) result(i int) dto.BatchResult {
+	res := dto.BatchResult{Index: i, Status: out.status}
+	if out.err != nil {
+		res.Error = out.err.Error()
+	}
+	return res
+}
@@ -1,18 +1,15 @@
 package controllers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/serg2013/reading/api/auth"
-	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/dto"
 	"github.com/serg2013/reading/api/responses"
-	"github.com/serg2013/reading/api/utils/formaterror"
 )
 
 // CreateBook func creates a new book
@@ -23,24 +20,18 @@ import (
 // @Produce json
 // @Security ApiKeyAuth
 //Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
-// @Param data body models.Book true "book data"
-// @Success 200 {object} models.Book
-// @Router /books [post]
+// @Param data body dto.BookRequest true "book data"
+// @Success 201 {object} dto.BookResponse
+// @Router /v1/books [post]
 func (server *Server) CreateBook(w http.ResponseWriter, r *http.Request) {
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	book := models.Book{}
-	err = json.Unmarshal(body, &book)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	req := dto.BookRequest{}
+	if !server.decodeJSON(w, r, &req) {
 		return
 	}
+	book := req.Model()
 	book.Prepare()
-	err = book.Validate()
+	err := book.Validate()
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
@@ -54,16 +45,14 @@ func (server *Server) CreateBook(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 		return
 	}
-	postCreated, err := book.SaveBook(server.DB)
+	postCreated, err := server.service(r).CreateBook(&book)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		serviceError(w, err)
 		return
 	}
-	fmt.Println(r.Host + r.URL.Path)
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, postCreated.ID))
 
-	responses.JSON(w, http.StatusCreated, postCreated)
+	responses.JSON(w, http.StatusCreated, dto.NewBookResponse(postCreated, uid))
 }
 
 // GetBooks func gets all exists books.
@@ -72,18 +61,24 @@ func (server *Server) CreateBook(w http.ResponseWriter, r *http.Request) {
 // @Tags Books
 // @Accept json
 // @Produce json
-// @Success 200 {array} models.Book
-// @Router /books [get]
+// @Param fields[books] query string false "book fields to return, e.g. id,title"
+// @Param fields[authors] query string false "author fields to return, e.g. id,name"
+// @Param include query string false "relations to embed: author (the default) or none with include="
+// @Success 200 {array} dto.BookResponse
+// @Router /v1/books [get]
 func (server *Server) GetBooks(w http.ResponseWriter, r *http.Request) {
 
-	book := models.Book{}
-
-	books, err := book.FindAllBooks(server.DB)
+	q, err := readQuery(r, dto.TypeBooks, "author")
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	books, err := server.service(r).ListBooks(q)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, books)
+	sparseJSON(w, http.StatusOK, dto.NewBookResponses(*books, viewerID(r)), dto.TypeBooks, q)
 }
 
 // GetBook func gets book by given ID or 404 error.
@@ -93,8 +88,11 @@ func (server *Server) GetBooks(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Book ID"
-// @Success 200 {object} models.Book
-// @Router /books/{id} [get]
+// @Param fields[books] query string false "book fields to return, e.g. id,title"
+// @Param fields[authors] query string false "author fields to return, e.g. id,name"
+// @Param include query string false "relations to embed: author (the default) or none with include="
+// @Success 200 {object} dto.BookResponse
+// @Router /v1/books/{id} [get]
 func (server *Server) GetBook(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -103,14 +101,17 @@ func (server *Server) GetBook(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	book := models.Book{}
-
-	bookReceived, err := book.FindBookByID(server.DB, pid)
+	q, err := readQuery(r, dto.TypeBooks, "author")
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	bookReceived, err := server.service(r).GetBook(pid, q)
+	if err != nil {
+		serviceError(w, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, bookReceived)
+	sparseJSON(w, http.StatusOK, dto.NewBookResponse(bookReceived, viewerID(r)), dto.TypeBooks, q)
 }
 
 // UpdateBook func updates existing book
@@ -121,9 +122,9 @@ func (server *Server) GetBook(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path string true "Book ID"
-// @Param data body models.Book true "book data"
-// @Success 200 {object} models.Book
-// @Router /books/{id} [put]
+// @Param data body dto.BookRequest true "book data"
+// @Success 200 {object} dto.BookResponse
+// @Router /v1/books/{id} [put]
 func (server *Server) UpdateBook(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -141,33 +142,12 @@ func (server *Server) UpdateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	book := models.Book{}
-	err = server.DB.Debug().Model(models.Book{}).Where("id = ?", pid).Take(&book).Error
-	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("post not found"))
-		return
-	}
-
-	// If a user attempt to update a book not belonging to him
-	if uid != book.AuthorID {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
-	}
-
 	// Read the data posted
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-
-	// Start processing the request data
-	bookUpdate := models.Book{}
-	err = json.Unmarshal(body, &bookUpdate)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	req := dto.BookRequest{}
+	if !server.decodeJSON(w, r, &req) {
 		return
 	}
+	bookUpdate := req.Model()
 
 	//Also check if the request user id is equal to the one gotten from token
 	if uid != bookUpdate.AuthorID {
@@ -182,16 +162,13 @@ func (server *Server) UpdateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bookUpdate.ID = book.ID
-
-	bookUpdated, err := bookUpdate.UpdateABook(server.DB)
-
+	// The service checks that the book exists and belongs to the user
+	bookUpdated, err := server.service(r).UpdateBook(pid, uid, &bookUpdate)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		serviceError(w, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, bookUpdated)
+	responses.JSON(w, http.StatusOK, dto.NewBookResponse(bookUpdated, uid))
 }
 
 // DeleteBook func deletes book by given ID or 404 error.
@@ -202,8 +179,8 @@ func (server *Server) UpdateBook(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path string true "Book ID"
-// @Success 200 {object} models.Book
-// @Router /books/{id} [delete]
+// @Success 204
+// @Router /v1/books/{id} [delete]
 func (server *Server) DeleteBook(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -222,23 +199,10 @@ func (server *Server) DeleteBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the book exists
-	book := models.Book{}
-	err = server.DB.Debug().Model(models.Book{}).Where("id = ?", pid).Take(&book).Error
+	// Does the book exist, and is the authenticated author its owner?
+	err = server.service(r).DeleteBook(pid, uid)
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Unauthorized"))
-		return
-	}
-
-	// Is the authenticated author, the owner of this book?
-	if uid != book.AuthorID {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
-	}
-
-	_, err = book.DeleteABook(server.DB, pid, uid)
-	if err != nil {
-		responses.ERROR(w, http.StatusBadRequest, err)
+		serviceError(w, err)
 		return
 	}
 
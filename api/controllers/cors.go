@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rs/cors"
+	"github.com/serg2013/reading/api/config"
+)
+
+// corsRoute is the CORS policy for the paths under prefix. A nil policy
+// turns CORS off there.
+type corsRoute struct {
+	prefix string
+	policy *cors.Cors
+}
+
+// newCORS returns a middleware applying cfg: the policy of the longest
+// route prefix matching the request path, or else the default one.
+// Preflight requests are answered here, before routing, so routes need no
+// OPTIONS method of their own.
+func newCORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	routes := []corsRoute{{prefix: "/", policy: corsPolicy(cfg.CORSPolicy)}}
+	for prefix, p := range cfg.Routes {
+		routes = append(routes, corsRoute{prefix: prefix, policy: corsPolicy(p)})
+	}
+	sort.Slice(routes, func(i, j int) bool { return len(routes[i].prefix) > len(routes[j].prefix) })
+
+	return func(next http.Handler) http.Handler {
+		handlers := make([]http.Handler, len(routes))
+		for i, route := range routes {
+			handlers[i] = next
+			if route.policy != nil {
+				handlers[i] = route.policy.Handler(next)
+			}
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i, route := range routes {
+				if underPrefix(r.URL.Path, route.prefix) {
+					handlers[i].ServeHTTP(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func corsPolicy(p config.CORSPolicy) *cors.Cors {
+	// cors.New allows every origin when given none.
+	if len(p.AllowedOrigins) == 0 {
+		return nil
+	}
+	return cors.New(cors.Options{
+		AllowedOrigins:   p.AllowedOrigins,
+		AllowedMethods:   p.AllowedMethods,
+		AllowedHeaders:   p.AllowedHeaders,
+		ExposedHeaders:   p.ExposedHeaders,
+		AllowCredentials: p.AllowCredentials,
+		MaxAge:           int(p.MaxAge.Seconds()),
+	})
+}
+
+// underPrefix reports whether path is prefix or below it, so "/auth"
+// covers "/auth/totp" but not "/authors".
+func underPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/") || prefix == ""
+}
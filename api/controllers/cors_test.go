@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serg2013/reading/api/config"
+)
+
+func testCORSConfig() config.CORSConfig {
+	return config.CORSConfig{
+		CORSPolicy: config.CORSPolicy{
+			AllowedOrigins:   []string{"https://reading.example.com", "https://*.partner.example.com"},
+			AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut},
+			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			ExposedHeaders:   []string{"Location"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+		Routes: map[string]config.CORSPolicy{
+			"/v1/auth": {},
+			"/public":  {AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}},
+		},
+	}
+}
+
+// corsRequest sends r through the CORS policy of cfg and reports whether
+// it reached the handler behind it.
+func corsRequest(cfg config.CORSConfig, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	handler := newCORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, reached
+}
+
+func preflight(path, origin, method string, headers ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if len(headers) > 0 {
+		r.Header.Set("Access-Control-Request-Headers", strings.Join(headers, ","))
+	}
+	return r
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name        string
+		r           *http.Request
+		allowOrigin string
+		credentials bool
+	}{
+		{"allowed origin", preflight("/v1/books", "https://reading.example.com", "PUT", "Authorization", "Content-Type"), "https://reading.example.com", true},
+		{"wildcard subdomain", preflight("/v1/books", "https://app.partner.example.com", "POST"), "https://app.partner.example.com", true},
+		{"disallowed origin", preflight("/v1/books", "https://evil.example.com", "PUT"), "", false},
+		{"lookalike of a wildcard", preflight("/v1/books", "https://partner.example.com.evil.com", "POST"), "", false},
+		{"disallowed method", preflight("/v1/books", "https://reading.example.com", "DELETE"), "", false},
+		{"disallowed header", preflight("/v1/books", "https://reading.example.com", "POST", "X-Secret"), "", false},
+		{"route without CORS", preflight("/v1/auth/password-reset", "https://reading.example.com", "POST"), "", false},
+		{"route allowing any origin", preflight("/public/covers", "https://anywhere.example.com", "GET"), "*", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, reached := corsRequest(testCORSConfig(), tt.r)
+			h := w.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials"); (got == "true") != tt.credentials {
+				t.Errorf("Allow-Credentials = %q, want it set: %v", got, tt.credentials)
+			}
+			if tt.name == "route without CORS" {
+				// Left to the router, which has no OPTIONS routes
+				if !reached {
+					t.Error("preflight answered on a route without CORS")
+				}
+				return
+			}
+			if reached {
+				t.Error("preflight reached the handler")
+			}
+			if !hasVary(h, "Origin") {
+				t.Errorf("Vary = %q, want Origin", h.Values("Vary"))
+			}
+			if tt.allowOrigin == "" {
+				return
+			}
+			if got := h.Get("Access-Control-Allow-Methods"); got != tt.r.Header.Get("Access-Control-Request-Method") {
+				t.Errorf("Allow-Methods = %q", got)
+			}
+			if tt.credentials && h.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("Max-Age = %q, want 600", h.Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/books", nil)
+	r.Header.Set("Origin", "https://reading.example.com")
+	w, reached := corsRequest(testCORSConfig(), r)
+	h := w.Header()
+	if !reached {
+		t.Fatal("request did not reach the handler")
+	}
+	if h.Get("Access-Control-Allow-Origin") != "https://reading.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("headers = %v, want the origin allowed with credentials", h)
+	}
+	if h.Get("Access-Control-Expose-Headers") != "Location" {
+		t.Errorf("Expose-Headers = %q, want Location", h.Get("Access-Control-Expose-Headers"))
+	}
+	if !hasVary(h, "Origin") {
+		t.Errorf("Vary = %q, want Origin", h.Values("Vary"))
+	}
+
+	r.Header.Set("Origin", "https://evil.example.com")
+	w, reached = corsRequest(testCORSConfig(), r)
+	if !reached || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed origin: reached %v, headers %v", reached, w.Header())
+	}
+	if !hasVary(w.Header(), "Origin") {
+		t.Errorf("Vary = %q, want Origin", w.Header().Values("Vary"))
+	}
+}
+
+func hasVary(h http.Header, name string) bool {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
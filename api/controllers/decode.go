@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/serg2013/reading/api/responses"
+)
+
+// decodeJSON reads the JSON body of r into dst. It refuses bodies that are
+// not JSON (415), larger than the configured limit (413), contain fields dst
+// does not have or more than one value (422). On failure it writes the
+// response and returns false.
+func (server *Server) decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		responses.ERROR(w, http.StatusUnsupportedMediaType, errors.New("Content-Type must be application/json"))
+		return false
+	}
+
+	limit := int64(server.config.Server.MaxBodyBytes)
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(dst)
+	if err == nil && dec.More() {
+		err = errors.New("Request body must contain a single JSON value")
+	}
+	if err == nil {
+		return true
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	// MaxBytesReader has no error type of its own before Go 1.19
+	case err.Error() == "http: request body too large":
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, fmt.Errorf("Request body must not be larger than %d bytes", limit))
+	case errors.Is(err, io.EOF):
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Request body must not be empty"))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Request body is not valid JSON"))
+	case errors.As(err, &syntaxErr):
+		responses.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("Request body is not valid JSON at offset %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		responses.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("Field %q must be a %s", typeErr.Field, typeErr.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		responses.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("Unknown field %s", field))
+	default:
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	}
+	return false
+}
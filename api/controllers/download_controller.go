@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// DownloadBook sends a book's content as a file
+// @Summary Downloads a book
+// @Description Sends the content of a book as a text file. Readers that cannot set headers can use a link from POST /books/{id}/download-url instead of an access token.
+// @Tags Books
+// @Produce plain
+// @Security ApiKeyAuth
+// @Param id path string true "Book ID"
+// @Success 200 {string} string "book content"
+// @Router /v1/books/{id}/download [get]
+func (server *Server) DownloadBook(w http.ResponseWriter, r *http.Request) {
+	pid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	book, err := server.service(r).GetBook(pid, models.Query{})
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	// The URL may carry a signature; keep it out of caches and of the
+	// Referer of anything opened from the file.
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": book.Title + ".txt"}))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		fmt.Fprint(w, book.Content)
+	}
+}
+
+// CreateDownloadURL signs a link to download a book
+// @Summary Creates a download link
+// @Description Returns a link that downloads the book without an access token, for readers that cannot set headers. It is good for that book only and expires shortly.
+// @Tags Books
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Book ID"
+// @Success 201 {object} dto.DownloadURL
+// @Router /v1/books/{id}/download-url [post]
+func (server *Server) CreateDownloadURL(w http.ResponseWriter, r *http.Request) {
+	pid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	_, err = server.service(r).GetBook(pid, models.Query{})
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	// The download route sits next to this one, whatever prefix they share.
+	path := strings.TrimSuffix(r.URL.Path, "-url")
+	query, expiresAt := auth.SignPath(path, uid, server.config.Auth.DownloadURLTTL)
+	responses.JSON(w, http.StatusCreated, dto.DownloadURL{
+		URL:       path + "?" + query.Encode(),
+		ExpiresAt: expiresAt,
+	})
+}
@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// GraphQL runs a GraphQL query or mutation
+// @Summary Runs a GraphQL query or mutation
+// @Description Reads books, their authors and users in one round trip, and changes books and authors. Mutations are checked like the REST endpoints, need the same scopes and each counts against the same rate limit as one REST write. Queries nested deeper, or resolving more fields, than configured are refused with 400 before they run. Lists are cursor connections.
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param data body dto.GraphQLRequest true "query, operation name and variables"
+// @Success 200 {object} dto.GraphQLResponse
+// @Failure 400 {object} dto.GraphQLResponse
+// @Router /graphql [post]
+func (server *Server) GraphQL(w http.ResponseWriter, r *http.Request) {
+	req := dto.GraphQLRequest{}
+	if !server.decodeJSON(w, r, &req) {
+		return
+	}
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		graphJSON(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if v := graphql.ValidateDocument(server.graphql, doc, nil); !v.IsValid {
+		graphJSON(w, http.StatusBadRequest, &graphql.Result{Errors: v.Errors})
+		return
+	}
+	// Without a single operation to run, Execute reports the error.
+	op := graphOperation(doc, req.OperationName)
+	if op != nil {
+		if err := server.checkGraphLimits(doc, op, req.Variables); err != nil {
+			graphJSON(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+	}
+
+	// Each mutation field counts against the quota of the REST writes, see
+	// graphWrite.
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        *server.graphql,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withRequest(r.Context(), r),
+	})
+	graphJSON(w, http.StatusOK, result)
+}
+
+// graphOperation returns the operation of doc to run: the one called
+// name, or the only one. It returns nil if there is no such operation.
+func graphOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op
+		}
+	}
+	return found
+}
+
+// checkGraphLimits refuses an operation nested deeper, or resolving more
+// fields, than configured.
+func (server *Server) checkGraphLimits(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) error {
+	cfg := server.config.GraphQL
+	c := graphCost{
+		fragments:   map[string]*ast.FragmentDefinition{},
+		variables:   map[string]interface{}{},
+		pageSize:    cfg.PageSize,
+		maxPageSize: cfg.MaxPageSize,
+		spread:      map[string]bool{},
+	}
+	// Variables left out take their default
+	for _, v := range op.VariableDefinitions {
+		if d, ok := v.DefaultValue.(*ast.IntValue); ok {
+			var n float64
+			if _, err := fmt.Sscan(d.Value, &n); err == nil {
+				c.variables[v.Variable.Name.Value] = n
+			}
+		}
+	}
+	for name, v := range variables {
+		c.variables[name] = v
+	}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok {
+			c.fragments[f.Name.Value] = f
+		}
+	}
+	depth, complexity := c.measure(op.SelectionSet, 1)
+	if depth > cfg.MaxDepth {
+		return fmt.Errorf("Query is nested %d levels deep, more than the %d allowed", depth, cfg.MaxDepth)
+	}
+	if complexity > cfg.MaxComplexity {
+		return fmt.Errorf("Query may resolve %d fields, more than the %d allowed", complexity, cfg.MaxComplexity)
+	}
+	return nil
+}
+
+// graphCost measures the work a query asks for.
+type graphCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	pageSize  int
+	// maxPageSize bounds the pages counted; larger ones are refused when
+	// the query runs.
+	maxPageSize int
+	// spread holds the fragments being measured, so a cycle ends.
+	spread map[string]bool
+}
+
+// measure returns how deep the fields of set nest, set's own being at
+// depth, and how many fields they may resolve. The fields under a
+// connection count once for every item of the page asked for. The count
+// saturates instead of overflowing.
+func (c graphCost) measure(set *ast.SelectionSet, depth int) (int, int) {
+	if set == nil {
+		return depth - 1, 0
+	}
+	deepest, total := depth-1, 0
+	for _, sel := range set.Selections {
+		d, n := 0, 0
+		switch sel := sel.(type) {
+		case *ast.Field:
+			d, n = c.measure(sel.SelectionSet, depth+1)
+			n = saturatingAdd(1, saturatingMul(c.items(sel), n))
+		case *ast.InlineFragment:
+			d, n = c.measure(sel.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			name := sel.Name.Value
+			f, ok := c.fragments[name]
+			if !ok || c.spread[name] {
+				continue
+			}
+			c.spread[name] = true
+			d, n = c.measure(f.SelectionSet, depth)
+			delete(c.spread, name)
+		}
+		if d > deepest {
+			deepest = d
+		}
+		total = saturatingAdd(total, n)
+	}
+	return deepest, total
+}
+
+// items returns how many items field may return: the page it asks for if
+// it is a connection, between 0 and the largest page, or else one.
+func (c graphCost) items(field *ast.Field) int {
+	if !graphConnections[field.Name.Value] {
+		return 1
+	}
+	n := float64(c.pageSize)
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if _, err := fmt.Sscan(v.Value, &n); err != nil {
+				n = float64(c.maxPageSize)
+			}
+		case *ast.Variable:
+			// Numbers decoded from JSON are float64
+			if f, ok := c.variables[v.Name.Value].(float64); ok {
+				n = f
+			}
+		}
+	}
+	// Clamped before converting, which is undefined for floats out of range
+	switch {
+	case n < 0:
+		return 0
+	case n > float64(c.maxPageSize):
+		return c.maxPageSize
+	}
+	return int(n)
+}
+
+// maxGraphCost is where the complexity of a query stops counting, far
+// above any sensible limit and within int on every platform.
+const maxGraphCost = math.MaxInt32
+
+// saturatingAdd returns a+b, or maxGraphCost if that is more. Both are at
+// least 0.
+func saturatingAdd(a, b int) int {
+	if a > maxGraphCost-b {
+		return maxGraphCost
+	}
+	return a + b
+}
+
+// saturatingMul returns a*b, or maxGraphCost if that is more. Both are at
+// least 0.
+func saturatingMul(a, b int) int {
+	if a != 0 && b > maxGraphCost/a {
+		return maxGraphCost
+	}
+	return a * b
+}
+
+// graphJSON writes result with status.
+func graphJSON(w http.ResponseWriter, status int, result *graphql.Result) {
+	resp := dto.GraphQLResponse{Data: result.Data}
+	for _, e := range result.Errors {
+		shown := dto.GraphQLError{Message: e.Message, Path: e.Path, Extensions: e.Extensions}
+		for _, l := range e.Locations {
+			shown.Locations = append(shown.Locations, dto.GraphQLLocation{Line: l.Line, Column: l.Column})
+		}
+		resp.Errors = append(resp.Errors, shown)
+	}
+	responses.JSON(w, status, resp)
+}
+
+// graphError is an error of a resolver, with the HTTP status the same
+// failure has on the REST endpoints.
+type graphError struct {
+	status int
+	err    error
+	// retryAfter is how long to wait before retrying a 429.
+	retryAfter time.Duration
+}
+
+// newGraphError returns the error to show for an error of the services.
+func newGraphError(err error) error {
+	status, shown := errorStatus(err)
+	return graphError{status: status, err: shown}
+}
+
+func (e graphError) Error() string {
+	return e.err.Error()
+}
+
+func (e graphError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"status": e.status}
+	if e.retryAfter > 0 {
+		ext["retryAfter"] = int(math.Ceil(e.retryAfter.Seconds()))
+	}
+	return ext
+}
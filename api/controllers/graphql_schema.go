@@ -0,0 +1,679 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/services"
+)
+
+// graphConnections names the fields that are connections, wherever they
+// appear, for the complexity of a query.
+var graphConnections = map[string]bool{"books": true, "authors": true}
+
+// The objects resolved are the REST responses, so a field shows the same
+// viewer what the REST endpoints would. The nodes of one list share a
+// group, which loads the relations of all of them with one query the
+// first time one of them is asked for.
+
+type bookNode struct {
+	book  dto.BookResponse
+	group *bookGroup
+}
+
+// bookGroup loads the authors of its books.
+type bookGroup struct {
+	authorIDs []uint32
+	once      sync.Once
+	authors   map[uint32]*authorNode
+	err       error
+}
+
+type authorNode struct {
+	author dto.AuthorResponse
+	group  *authorGroup
+}
+
+// authorGroup loads the books of its authors.
+type authorGroup struct {
+	nodes []*authorNode
+	once  sync.Once
+	books map[uint32][]*bookNode
+	err   error
+}
+
+func newBookNodes(books []dto.BookResponse) []*bookNode {
+	group := &bookGroup{}
+	nodes := make([]*bookNode, len(books))
+	seen := map[uint32]bool{}
+	for i, b := range books {
+		nodes[i] = &bookNode{book: b, group: group}
+		if !seen[b.AuthorID] {
+			seen[b.AuthorID] = true
+			group.authorIDs = append(group.authorIDs, b.AuthorID)
+		}
+	}
+	return nodes
+}
+
+func newAuthorNodes(authors []dto.AuthorResponse) []*authorNode {
+	group := &authorGroup{}
+	for _, a := range authors {
+		group.nodes = append(group.nodes, &authorNode{author: a, group: group})
+	}
+	return group.nodes
+}
+
+// author returns the author of a book of g, or nil if there is none.
+func (g *bookGroup) author(svc *services.Service, viewer uint32, id uint32) (*authorNode, error) {
+	g.once.Do(func() {
+		found, err := svc.AuthorsByID(g.authorIDs, models.Query{})
+		if err != nil {
+			g.err = err
+			return
+		}
+		authors := make([]models.Author, 0, len(found))
+		for _, id := range g.authorIDs {
+			if a, ok := found[id]; ok {
+				authors = append(authors, a)
+			}
+		}
+		g.authors = map[uint32]*authorNode{}
+		for _, node := range newAuthorNodes(dto.NewAuthorResponses(authors, viewer)) {
+			g.authors[node.author.ID] = node
+		}
+	})
+	return g.authors[id], g.err
+}
+
+// booksOf returns the books of an author of g.
+func (g *authorGroup) booksOf(svc *services.Service, viewer uint32, id uint32) ([]*bookNode, error) {
+	g.once.Do(func() {
+		ids := make([]uint32, len(g.nodes))
+		for i, node := range g.nodes {
+			ids[i] = node.author.ID
+		}
+		found, err := svc.BooksByAuthor(ids, models.Query{})
+		if err != nil {
+			g.err = err
+			return
+		}
+		books := []models.Book{}
+		for _, id := range ids {
+			books = append(books, found[id]...)
+		}
+		nodes := newBookNodes(dto.NewBookResponses(books, viewer))
+		g.books = map[uint32][]*bookNode{}
+		for _, node := range nodes {
+			g.books[node.book.AuthorID] = append(g.books[node.book.AuthorID], node)
+		}
+		// The authors of these books are the group's, so asking for
+		// them again needs no query.
+		if len(nodes) > 0 {
+			group := nodes[0].group
+			group.once.Do(func() {
+				group.authors = map[uint32]*authorNode{}
+				for _, node := range g.nodes {
+					group.authors[node.author.ID] = node
+				}
+			})
+		}
+	})
+	return g.books[id], g.err
+}
+
+// graphPage is one page of a connection.
+type graphPage struct {
+	edges   []graphEdge
+	hasNext bool
+}
+
+type graphEdge struct {
+	cursor string
+	node   interface{}
+}
+
+// pageArgs reads the first and after arguments of a connection of typ.
+func (server *Server) pageArgs(p graphql.ResolveParams, typ string) (int, uint32, error) {
+	cfg := server.config.GraphQL
+	first := cfg.PageSize
+	if n, ok := p.Args["first"].(int); ok {
+		first = n
+	}
+	if first < 0 || first > cfg.MaxPageSize {
+		return 0, 0, graphError{status: http.StatusBadRequest, err: fmt.Errorf("first must be between 0 and %d", cfg.MaxPageSize)}
+	}
+	cursor, _ := p.Args["after"].(string)
+	after, err := readCursor(typ, cursor)
+	if err != nil {
+		return 0, 0, graphError{status: http.StatusBadRequest, err: err}
+	}
+	return first, after, nil
+}
+
+// graphID reads an ID argument.
+func graphID(v interface{}) (uint64, error) {
+	s, _ := v.(string)
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, graphError{status: http.StatusBadRequest, err: fmt.Errorf("Invalid ID %q", s)}
+	}
+	return id, nil
+}
+
+// graphWrite runs a mutation on behalf of the user making the request,
+// who needs scope. It is checked like the REST writes: authentication,
+// scope, rate limit, so a request with several mutations is charged for
+// each of them.
+func (server *Server) graphWrite(p graphql.ResolveParams, scope string, op func(svc *services.Service, uid uint32) (interface{}, int, error)) (interface{}, error) {
+	r := requestFrom(p.Context)
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return nil, graphError{status: http.StatusUnauthorized, err: errors.New("Unauthorized")}
+	}
+	if !auth.HasScope(r, scope) {
+		return nil, graphError{status: http.StatusForbidden, err: fmt.Errorf("Scope %s required", scope)}
+	}
+	res, err := server.writeLimiter.Allow(r)
+	if err != nil {
+		// Fail open, as the REST middleware does
+		logger.Error(r.Context(), "rate limiter unavailable", logger.Fields{"error": err})
+	} else if !res.Allowed {
+		return nil, graphError{status: http.StatusTooManyRequests, err: errors.New(http.StatusText(http.StatusTooManyRequests)), retryAfter: res.RetryAfter}
+	}
+	value, status, err := op(server.service(r), uid)
+	if err != nil && status == 0 {
+		return nil, newGraphError(err)
+	}
+	if err != nil {
+		return nil, graphError{status: status, err: err}
+	}
+	return value, nil
+}
+
+// bookInput returns the book a BookInput describes.
+func bookInput(v interface{}) (*dto.BookRequest, error) {
+	in, _ := v.(map[string]interface{})
+	req := &dto.BookRequest{}
+	req.Title, _ = in["title"].(string)
+	req.Content, _ = in["content"].(string)
+	if id, ok := in["authorId"]; ok && id != nil {
+		authorID, err := graphID(id)
+		if err != nil {
+			return nil, err
+		}
+		req.AuthorID = uint32(authorID)
+	}
+	return req, nil
+}
+
+// authorInput returns the author an AuthorInput describes.
+func authorInput(v interface{}) (*dto.AuthorRequest, error) {
+	in, _ := v.(map[string]interface{})
+	req := &dto.AuthorRequest{}
+	req.Name, _ = in["name"].(string)
+	req.Lastname, _ = in["lastname"].(string)
+	req.Email, _ = in["email"].(string)
+	if book, ok := in["firstBook"]; ok && book != nil {
+		var err error
+		if req.FirstBook, err = bookInput(book); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// newGraphSchema builds the GraphQL schema over books, authors and users.
+func (server *Server) newGraphSchema() (graphql.Schema, error) {
+	pageInfo := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*graphPage).hasNext, nil
+				},
+			},
+			"endCursor": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					page := p.Source.(*graphPage)
+					if len(page.edges) == 0 {
+						return nil, nil
+					}
+					return page.edges[len(page.edges)-1].cursor, nil
+				},
+			},
+		},
+	})
+	connection := func(name string, node *graphql.Object) *graphql.Object {
+		edge := graphql.NewObject(graphql.ObjectConfig{
+			Name: name + "Edge",
+			Fields: graphql.Fields{
+				"cursor": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(graphEdge).cursor, nil
+					},
+				},
+				"node": &graphql.Field{
+					Type: graphql.NewNonNull(node),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(graphEdge).node, nil
+					},
+				},
+			},
+		})
+		return graphql.NewObject(graphql.ObjectConfig{
+			Name: name + "Connection",
+			Fields: graphql.Fields{
+				"edges": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edge))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*graphPage).edges, nil
+					},
+				},
+				"pageInfo": &graphql.Field{
+					Type: graphql.NewNonNull(pageInfo),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+				},
+			},
+		})
+	}
+	pageArgs := graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{Type: graphql.Int},
+		"after": &graphql.ArgumentConfig{Type: graphql.String},
+	}
+
+	book := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Book",
+		Fields: graphql.Fields{
+			"id":       bookField(graphql.NewNonNull(graphql.ID), func(b dto.BookResponse) interface{} { return b.ID }),
+			"title":    bookField(graphql.NewNonNull(graphql.String), func(b dto.BookResponse) interface{} { return b.Title }),
+			"content":  bookField(graphql.NewNonNull(graphql.String), func(b dto.BookResponse) interface{} { return b.Content }),
+			"authorId": bookField(graphql.NewNonNull(graphql.ID), func(b dto.BookResponse) interface{} { return b.AuthorID }),
+		},
+	})
+	author := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Author",
+		Fields: graphql.Fields{
+			"id":       authorField(graphql.NewNonNull(graphql.ID), func(a dto.AuthorResponse) interface{} { return a.ID }),
+			"name":     authorField(graphql.NewNonNull(graphql.String), func(a dto.AuthorResponse) interface{} { return a.Name }),
+			"lastname": authorField(graphql.NewNonNull(graphql.String), func(a dto.AuthorResponse) interface{} { return a.Lastname }),
+			// Only the author sees their own email
+			"email": authorField(graphql.String, func(a dto.AuthorResponse) interface{} {
+				if a.Email == "" {
+					return nil
+				}
+				return a.Email
+			}),
+		},
+	})
+	bookConnection := connection("Book", book)
+	authorConnection := connection("Author", author)
+
+	book.AddFieldConfig("author", &graphql.Field{
+		Type: author,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			node := p.Source.(*bookNode)
+			r := requestFrom(p.Context)
+			found, err := node.group.author(server.service(r), viewerID(r), node.book.AuthorID)
+			if err != nil {
+				return nil, newGraphError(err)
+			}
+			if found == nil {
+				return nil, nil
+			}
+			return found, nil
+		},
+	})
+	author.AddFieldConfig("books", &graphql.Field{
+		Type: graphql.NewNonNull(bookConnection),
+		Args: pageArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			first, after, err := server.pageArgs(p, dto.TypeBooks)
+			if err != nil {
+				return nil, err
+			}
+			node := p.Source.(*authorNode)
+			r := requestFrom(p.Context)
+			books, err := node.group.booksOf(server.service(r), viewerID(r), node.author.ID)
+			if err != nil {
+				return nil, newGraphError(err)
+			}
+			page := &graphPage{}
+			for _, b := range books {
+				if b.book.ID <= after {
+					continue
+				}
+				if len(page.edges) == first {
+					page.hasNext = true
+					break
+				}
+				page.edges = append(page.edges, graphEdge{cursor: pageCursor(dto.TypeBooks, b.book.ID), node: b})
+			}
+			return page, nil
+		},
+	})
+
+	user := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":       userField(graphql.NewNonNull(graphql.ID), func(u dto.UserResponse) interface{} { return u.ID }),
+			"nickname": userField(graphql.NewNonNull(graphql.String), func(u dto.UserResponse) interface{} { return u.Nickname }),
+			// Only the user sees their own email and account settings
+			"email": userField(graphql.String, func(u dto.UserResponse) interface{} {
+				if u.Email == "" {
+					return nil
+				}
+				return u.Email
+			}),
+			"emailVerified": userField(graphql.NewNonNull(graphql.Boolean), func(u dto.UserResponse) interface{} { return u.EmailVerified }),
+			"totpEnabled":   userField(graphql.NewNonNull(graphql.Boolean), func(u dto.UserResponse) interface{} { return u.TOTPEnabled }),
+			"isAdmin":       userField(graphql.NewNonNull(graphql.Boolean), func(u dto.UserResponse) interface{} { return u.IsAdmin }),
+			"createdAt":     userField(graphql.NewNonNull(graphql.DateTime), func(u dto.UserResponse) interface{} { return u.CreatedAt }),
+			"updatedAt":     userField(graphql.NewNonNull(graphql.DateTime), func(u dto.UserResponse) interface{} { return u.UpdatedAt }),
+			// Authors share their ID with the user account that manages them
+			"author": &graphql.Field{
+				Type: author,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := requestFrom(p.Context)
+					found, err := server.service(r).GetAuthor(p.Source.(dto.UserResponse).ID, models.Query{})
+					if errors.Is(err, services.ErrNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, newGraphError(err)
+					}
+					return newAuthorNodes([]dto.AuthorResponse{dto.NewAuthorResponse(found, viewerID(r))})[0], nil
+				},
+			},
+		},
+	})
+
+	getUser := func(r *http.Request, uid uint32) (interface{}, error) {
+		found, err := server.service(r).GetUser(uid)
+		if errors.Is(err, services.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, newGraphError(err)
+		}
+		return dto.NewUserResponse(found, viewerID(r)), nil
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"book": &graphql.Field{
+				Type: book,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := graphID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					r := requestFrom(p.Context)
+					found, err := server.service(r).GetBook(id, models.Query{})
+					if errors.Is(err, services.ErrNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, newGraphError(err)
+					}
+					return newBookNodes([]dto.BookResponse{dto.NewBookResponse(found, viewerID(r))})[0], nil
+				},
+			},
+			"books": &graphql.Field{
+				Type: graphql.NewNonNull(bookConnection),
+				Args: pageArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					first, after, err := server.pageArgs(p, dto.TypeBooks)
+					if err != nil {
+						return nil, err
+					}
+					r := requestFrom(p.Context)
+					books, err := server.service(r).ListBooks(models.Query{After: after, Limit: first + 1})
+					if err != nil {
+						return nil, newGraphError(err)
+					}
+					page := &graphPage{}
+					if len(*books) > first {
+						page.hasNext = true
+						*books = (*books)[:first]
+					}
+					for _, node := range newBookNodes(dto.NewBookResponses(*books, viewerID(r))) {
+						page.edges = append(page.edges, graphEdge{cursor: pageCursor(dto.TypeBooks, node.book.ID), node: node})
+					}
+					return page, nil
+				},
+			},
+			"author": &graphql.Field{
+				Type: author,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := graphID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					r := requestFrom(p.Context)
+					found, err := server.service(r).GetAuthor(uint32(id), models.Query{})
+					if errors.Is(err, services.ErrNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, newGraphError(err)
+					}
+					return newAuthorNodes([]dto.AuthorResponse{dto.NewAuthorResponse(found, viewerID(r))})[0], nil
+				},
+			},
+			"authors": &graphql.Field{
+				Type: graphql.NewNonNull(authorConnection),
+				Args: pageArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					first, after, err := server.pageArgs(p, dto.TypeAuthors)
+					if err != nil {
+						return nil, err
+					}
+					r := requestFrom(p.Context)
+					authors, err := server.service(r).ListAuthors(models.Query{After: after, Limit: first + 1})
+					if err != nil {
+						return nil, newGraphError(err)
+					}
+					page := &graphPage{}
+					if len(*authors) > first {
+						page.hasNext = true
+						*authors = (*authors)[:first]
+					}
+					for _, node := range newAuthorNodes(dto.NewAuthorResponses(*authors, viewerID(r))) {
+						page.edges = append(page.edges, graphEdge{cursor: pageCursor(dto.TypeAuthors, node.author.ID), node: node})
+					}
+					return page, nil
+				},
+			},
+			"user": &graphql.Field{
+				Type: user,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := graphID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return getUser(requestFrom(p.Context), uint32(id))
+				},
+			},
+			// viewer is the user making the request, null for anonymous
+			// clients.
+			"viewer": &graphql.Field{
+				Type: user,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := requestFrom(p.Context)
+					uid := viewerID(r)
+					if uid == 0 {
+						return nil, nil
+					}
+					return getUser(r, uid)
+				},
+			},
+		},
+	})
+
+	bookInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "BookInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"content": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			// Not needed for the first book of a new author
+			"authorId": &graphql.InputObjectFieldConfig{Type: graphql.ID},
+		},
+	})
+	authorInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "AuthorInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"lastname": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"email":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			// Only read on create, where the author and the book are
+			// stored together
+			"firstBook": &graphql.InputObjectFieldConfig{Type: bookInputType},
+		},
+	})
+
+	// The mutations are the operations of the batch endpoints, so they are
+	// checked exactly like the REST ones.
+	bookMutation := func(op string) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) {
+			o := dto.BookOperation{Op: op}
+			var err error
+			if id, ok := p.Args["id"]; ok {
+				if o.ID, err = graphID(id); err != nil {
+					return nil, err
+				}
+			}
+			if input, ok := p.Args["input"]; ok {
+				if o.Book, err = bookInput(input); err != nil {
+					return nil, err
+				}
+			}
+			value, err := server.graphWrite(p, auth.ScopeBooksWrite, func(svc *services.Service, uid uint32) (interface{}, int, error) {
+				return bookOperation(svc, uid, o)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if op == dto.OpDelete {
+				return o.ID, nil
+			}
+			return newBookNodes([]dto.BookResponse{value.(dto.BookResponse)})[0], nil
+		}
+	}
+	authorMutation := func(op string) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) {
+			o := dto.AuthorOperation{Op: op}
+			if id, ok := p.Args["id"]; ok {
+				uid, err := graphID(id)
+				if err != nil {
+					return nil, err
+				}
+				o.ID = uint32(uid)
+			}
+			if input, ok := p.Args["input"]; ok {
+				var err error
+				if o.Author, err = authorInput(input); err != nil {
+					return nil, err
+				}
+			}
+			value, err := server.graphWrite(p, auth.ScopeAuthorsWrite, func(svc *services.Service, uid uint32) (interface{}, int, error) {
+				return authorOperation(svc, uid, o)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if op == dto.OpDelete {
+				return o.ID, nil
+			}
+			return newAuthorNodes([]dto.AuthorResponse{value.(dto.AuthorResponse)})[0], nil
+		}
+	}
+	id := &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}
+	bookIn := &graphql.ArgumentConfig{Type: graphql.NewNonNull(bookInputType)}
+	authorIn := &graphql.ArgumentConfig{Type: graphql.NewNonNull(authorInputType)}
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createBook": &graphql.Field{
+				Type:    graphql.NewNonNull(book),
+				Args:    graphql.FieldConfigArgument{"input": bookIn},
+				Resolve: bookMutation(dto.OpCreate),
+			},
+			"updateBook": &graphql.Field{
+				Type:    graphql.NewNonNull(book),
+				Args:    graphql.FieldConfigArgument{"id": id, "input": bookIn},
+				Resolve: bookMutation(dto.OpUpdate),
+			},
+			"deleteBook": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.ID),
+				Args:    graphql.FieldConfigArgument{"id": id},
+				Resolve: bookMutation(dto.OpDelete),
+			},
+			"createAuthor": &graphql.Field{
+				Type:    graphql.NewNonNull(author),
+				Args:    graphql.FieldConfigArgument{"input": authorIn},
+				Resolve: authorMutation(dto.OpCreate),
+			},
+			"updateAuthor": &graphql.Field{
+				Type:    graphql.NewNonNull(author),
+				Args:    graphql.FieldConfigArgument{"id": id, "input": authorIn},
+				Resolve: authorMutation(dto.OpUpdate),
+			},
+			"deleteAuthor": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.ID),
+				Args:    graphql.FieldConfigArgument{"id": id},
+				Resolve: authorMutation(dto.OpDelete),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// bookField is a field of Book read from its response.
+func bookField(typ graphql.Output, get func(b dto.BookResponse) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(*bookNode).book), nil
+		},
+	}
+}
+
+// authorField is a field of Author read from its response.
+func authorField(typ graphql.Output, get func(a dto.AuthorResponse) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(*authorNode).author), nil
+		},
+	}
+}
+
+// userField is a field of User read from its response.
+func userField(typ graphql.Output, get func(u dto.UserResponse) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(dto.UserResponse)), nil
+		},
+	}
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/serg2013/reading/api/config"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/models"
+)
+
+// graphQuery posts query with variables to /graphql and decodes the
+// response.
+func graphQuery(t *testing.T, server *Server, query string, variables map[string]interface{}, headers ...string) (int, dto.GraphQLResponse) {
+	t.Helper()
+	w := do(server, "POST", "/graphql", dto.GraphQLRequest{Query: query, Variables: variables}, headers...)
+	resp := dto.GraphQLResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response %s: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func TestGraphQLComplexity(t *testing.T) {
+	server := newTestServer(t, func(cfg *config.Config) {
+		cfg.GraphQL.MaxDepth = 100
+	})
+	// Twelve nested pages of 100 would overflow int64
+	nested := "id"
+	for i := 0; i < 12; i++ {
+		nested = "books(first: $n) { edges { node { author { " + nested + " } } } }"
+	}
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		refused   bool
+	}{
+		{"default page", `{ books { edges { node { id title } } } }`, nil, false},
+		{"largest page", `query($n: Int) { books(first: $n) { edges { node { id } } } }`, map[string]interface{}{"n": 100}, false},
+		{"huge page counted as the largest", `query($n: Int) { books(first: $n) { edges { node { id } } } }`, map[string]interface{}{"n": 1e300}, false},
+		{"negative page counted as empty", `{ books(first: -5) { edges { node { id } } } }`, nil, false},
+		{"huge page in a default", `query($n: Int = 2000000000) { a: books(first: $n) { edges { node { id } } } b: books(first: $n) { edges { node { id } } } c: books(first: $n) { edges { node { id } } } d: books(first: $n) { edges { node { id } } } }`, nil, true},
+		{"nested huge pages", "query($n: Int) { author(id: \"1\") { " + nested + " } }", map[string]interface{}{"n": 1e300}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := graphQuery(t, server, tt.query, tt.variables)
+			if tt.refused {
+				if status != http.StatusBadRequest || len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "fields, more than") {
+					t.Errorf("status %d, errors %+v, want the query refused for its complexity", status, resp.Errors)
+				}
+				return
+			}
+			if status != http.StatusOK {
+				t.Errorf("status %d, errors %+v, want the query run", status, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestGraphCostItems(t *testing.T) {
+	c := graphCost{pageSize: 20, maxPageSize: 100, variables: map[string]interface{}{
+		"small": float64(7), "huge": 1e300, "negative": float64(-1), "text": "12",
+	}}
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{`{ books { id } }`, 20},
+		{`{ books(first: 5) { id } }`, 5},
+		{`{ books(first: 1000) { id } }`, 100},
+		{`{ books(first: -3) { id } }`, 0},
+		{`{ books(first: $small) { id } }`, 7},
+		{`{ books(first: $huge) { id } }`, 100},
+		{`{ books(first: $negative) { id } }`, 0},
+		{`{ books(first: $text) { id } }`, 20},
+		{`{ book(id: "1") { id } }`, 1},
+	}
+	for _, tt := range tests {
+		doc := parseGraph(t, tt.query)
+		field := graphOperation(doc, "").SelectionSet.Selections[0]
+		if got := c.items(field.(*ast.Field)); got != tt.want {
+			t.Errorf("items of %s = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+	if got := saturatingMul(maxGraphCost/2, 3); got != maxGraphCost {
+		t.Errorf("saturatingMul = %d, want %d", got, maxGraphCost)
+	}
+	if got := saturatingAdd(maxGraphCost, 1); got != maxGraphCost {
+		t.Errorf("saturatingAdd = %d, want %d", got, maxGraphCost)
+	}
+}
+
+func TestGraphQLMutationsAreEachRateLimited(t *testing.T) {
+	server := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimit.WritePerIP = 3
+		cfg.RateLimit.WritePerUser = 3
+	})
+	user := createUser(t, server, "reader", "reader@example.com", "password", false)
+	token := bearer(tokenFor(t, user))
+	author := dto.AuthorRequest{Name: "Peter", Lastname: "Sidorov", Email: "p.sidorov@example.com"}
+	expectStatus(t, do(server, "POST", "/v1/authors", author, "Authorization", token), http.StatusCreated)
+
+	// Reads are not charged
+	for i := 0; i < 3; i++ {
+		if status, resp := graphQuery(t, server, `{ books { edges { node { id } } } }`, nil, "Authorization", token); status != http.StatusOK || len(resp.Errors) > 0 {
+			t.Fatalf("query: status %d, errors %+v", status, resp.Errors)
+		}
+	}
+	// Two writes are left of the three a minute
+	query := `mutation($author: ID!) {
+		a: createBook(input: {title: "A", content: "Content", authorId: $author}) { id }
+		b: createBook(input: {title: "B", content: "Content", authorId: $author}) { id }
+		c: createBook(input: {title: "C", content: "Content", authorId: $author}) { id }
+	}`
+	_, resp := graphQuery(t, server, query, map[string]interface{}{"author": fmt.Sprint(user.ID)}, "Authorization", token)
+	if len(resp.Errors) != 1 || resp.Errors[0].Path[0] != "c" || resp.Errors[0].Extensions["status"] != float64(http.StatusTooManyRequests) {
+		t.Fatalf("errors %+v, want the third mutation refused with 429", resp.Errors)
+	}
+	if resp.Errors[0].Extensions["retryAfter"] == nil {
+		t.Error("no retryAfter on the refused mutation")
+	}
+	var n int
+	if err := server.DB.Model(&models.Book{}).Count(&n).Error; err != nil || n != 2 {
+		t.Errorf("%d books stored (%v), want 2", n, err)
+	}
+}
+
+func parseGraph(t *testing.T, query string) *ast.Document {
+	t.Helper()
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
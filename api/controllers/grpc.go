@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/middlewares"
+	"github.com/serg2013/reading/api/models"
+	readingv1 "github.com/serg2013/reading/api/proto/reading/v1"
+	"github.com/serg2013/reading/api/services"
+)
+
+// Page sizes of the List calls.
+const (
+	grpcPageSize    = 20
+	grpcMaxPageSize = 100
+)
+
+// newGRPCServer returns the gRPC API for internal services. It serves the
+// same use cases as the REST API, with the same checks.
+func (server *Server) newGRPCServer() *grpc.Server {
+	s := grpc.NewServer(grpc.UnaryInterceptor(server.grpcInterceptor))
+	readingv1.RegisterBookServiceServer(s, bookRPC{server: server})
+	readingv1.RegisterAuthorServiceServer(s, authorRPC{server: server})
+	readingv1.RegisterUserServiceServer(s, userRPC{server: server})
+	return s
+}
+
+// grpcInterceptor authenticates and logs every call. A credential in the
+// metadata must be valid; calls without one may only do what anonymous
+// REST requests may.
+func (server *Server) grpcInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	r := grpcRequest(ctx, info.FullMethod)
+	ctx = withRequest(r.Context(), r)
+
+	var resp interface{}
+	var err error
+	if auth.ExtractToken(r) != "" && auth.TokenValid(r) != nil {
+		err = status.Error(codes.Unauthenticated, "Unauthorized")
+	} else {
+		resp, err = handler(ctx, req)
+	}
+
+	code := status.Code(err)
+	fields := logger.Fields{
+		"method":     "grpc",
+		"path":       info.FullMethod,
+		"code":       code.String(),
+		"latency_ms": float64(time.Since(start).Nanoseconds()) / 1e6,
+		"remote":     r.RemoteAddr,
+	}
+	if uid, err := auth.ExtractTokenID(r); err == nil && uid != 0 {
+		fields["user_id"] = uid
+	}
+	level := logger.InfoLevel
+	if code == codes.Internal || code == codes.Unknown {
+		level = logger.ErrorLevel
+	}
+	logger.Default().Log(ctx, level, "request", fields)
+	return resp, err
+}
+
+// grpcRequest returns the HTTP request the REST API would see for a call
+// to method, so that the call is authenticated, audited and rate limited
+// by the same code. The credential comes from the authorization or
+// x-api-key metadata and the request ID from x-request-id.
+func grpcRequest(ctx context.Context, method string) *http.Request {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	id := middlewares.RequestID(get("x-request-id"))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+
+	r, _ := http.NewRequestWithContext(logger.WithRequestID(ctx, id), http.MethodPost, method, nil)
+	if v := get("authorization"); v != "" {
+		r.Header.Set("Authorization", v)
+	}
+	if v := get("x-api-key"); v != "" {
+		r.Header.Set("X-API-Key", v)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	return auth.WithPrincipalCache(r)
+}
+
+// scopeAccount stands for the changes of the caller's account, which no
+// API key may make.
+const scopeAccount = ""
+
+// grpcWrite runs op, a change on behalf of the caller, who needs scope. It
+// is checked like the REST writes: authentication, scope, rate limit.
+func (server *Server) grpcWrite(ctx context.Context, scope string, op func(svc *services.Service, uid uint32) (interface{}, int, error)) (interface{}, error) {
+	r := requestFrom(ctx)
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	if scope == scopeAccount {
+		// As middlewares.SetMiddlewareNoAPIKey
+		if p, err := auth.Authenticate(r); err != nil || p.APIKeyID != 0 || p.Signed {
+			return nil, status.Error(codes.PermissionDenied, "Not allowed with an API key")
+		}
+	} else if !auth.HasScope(r, scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "Scope %s required", scope)
+	}
+	if err := server.grpcRateLimit(r); err != nil {
+		return nil, err
+	}
+	value, code, err := op(server.service(r), uid)
+	if err != nil {
+		return nil, grpcError(code, err)
+	}
+	return value, nil
+}
+
+// grpcRateLimit counts a write against the quota of the REST writes.
+func (server *Server) grpcRateLimit(r *http.Request) error {
+	res, err := server.writeLimiter.Allow(r)
+	if err != nil {
+		// Fail open, as the REST middleware does
+		logger.Error(r.Context(), "rate limiter unavailable", logger.Fields{"error": err})
+		return nil
+	}
+	if !res.Allowed {
+		return status.Errorf(codes.ResourceExhausted, "Too Many Requests, retry in %s", res.RetryAfter.Round(time.Second))
+	}
+	return nil
+}
+
+// grpcCodes maps the HTTP statuses of failed operations to gRPC codes.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.FailedPrecondition,
+	http.StatusUnprocessableEntity: codes.InvalidArgument,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+}
+
+// grpcError returns the gRPC error for an operation that failed with the
+// HTTP status code, 0 for an error of the service layer.
+func grpcError(code int, err error) error {
+	if code == 0 {
+		code, err = errorStatus(err)
+	}
+	c, ok := grpcCodes[code]
+	if !ok {
+		c = codes.Internal
+	}
+	return status.Error(c, err.Error())
+}
+
+// grpcPage returns the query for the page of a list of typ that a List
+// call asks for. It reads one row more than the page, to tell whether
+// there is a next one.
+func grpcPage(typ string, size int32, token string) (models.Query, int, error) {
+	if size < 0 {
+		return models.Query{}, 0, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	n := int(size)
+	if n == 0 {
+		n = grpcPageSize
+	}
+	if n > grpcMaxPageSize {
+		n = grpcMaxPageSize
+	}
+	after, err := readCursor(typ, token)
+	if err != nil {
+		return models.Query{}, 0, status.Error(codes.InvalidArgument, "Invalid page_token")
+	}
+	return models.Query{After: after, Limit: n + 1}, n, nil
+}
@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/models"
+	readingv1 "github.com/serg2013/reading/api/proto/reading/v1"
+	"github.com/serg2013/reading/api/services"
+)
+
+// The gRPC services return the REST responses as messages, so a caller
+// sees what the REST API would show them. Writes are the operations of the
+// batch endpoints.
+
+type bookRPC struct {
+	readingv1.UnimplementedBookServiceServer
+	server *Server
+}
+
+func (s bookRPC) ListBooks(ctx context.Context, req *readingv1.ListBooksRequest) (*readingv1.ListBooksResponse, error) {
+	q, size, err := grpcPage(dto.TypeBooks, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	if req.IncludeAuthor {
+		q.Include = map[string]bool{"author": true}
+	}
+	r := requestFrom(ctx)
+	books, err := s.server.service(r).ListBooks(q)
+	if err != nil {
+		return nil, grpcError(0, err)
+	}
+	resp := &readingv1.ListBooksResponse{}
+	if len(*books) > size {
+		*books = (*books)[:size]
+		resp.NextPageToken = pageCursor(dto.TypeBooks, (*books)[size-1].ID)
+	}
+	for _, b := range dto.NewBookResponses(*books, viewerID(r)) {
+		resp.Books = append(resp.Books, bookMessage(b))
+	}
+	return resp, nil
+}
+
+func (s bookRPC) GetBook(ctx context.Context, req *readingv1.GetBookRequest) (*readingv1.Book, error) {
+	q := models.Query{}
+	if req.IncludeAuthor {
+		q.Include = map[string]bool{"author": true}
+	}
+	r := requestFrom(ctx)
+	book, err := s.server.service(r).GetBook(req.Id, q)
+	if err != nil {
+		return nil, grpcError(0, err)
+	}
+	return bookMessage(dto.NewBookResponse(book, viewerID(r))), nil
+}
+
+func (s bookRPC) CreateBook(ctx context.Context, req *readingv1.CreateBookRequest) (*readingv1.Book, error) {
+	o := dto.BookOperation{Op: dto.OpCreate, Book: &dto.BookRequest{
+		Title:    req.Title,
+		Content:  req.Content,
+		AuthorID: req.AuthorId,
+	}}
+	return s.write(ctx, o)
+}
+
+func (s bookRPC) UpdateBook(ctx context.Context, req *readingv1.UpdateBookRequest) (*readingv1.Book, error) {
+	o := dto.BookOperation{Op: dto.OpUpdate, ID: req.Id, Book: &dto.BookRequest{
+		Title:    req.Title,
+		Content:  req.Content,
+		AuthorID: req.AuthorId,
+	}}
+	return s.write(ctx, o)
+}
+
+func (s bookRPC) DeleteBook(ctx context.Context, req *readingv1.DeleteBookRequest) (*emptypb.Empty, error) {
+	if _, err := s.write(ctx, dto.BookOperation{Op: dto.OpDelete, ID: req.Id}); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s bookRPC) write(ctx context.Context, o dto.BookOperation) (*readingv1.Book, error) {
+	value, err := s.server.grpcWrite(ctx, auth.ScopeBooksWrite, func(svc *services.Service, uid uint32) (interface{}, int, error) {
+		return bookOperation(svc, uid, o)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if book, ok := value.(dto.BookResponse); ok {
+		return bookMessage(book), nil
+	}
+	return nil, nil
+}
+
+type authorRPC struct {
+	readingv1.UnimplementedAuthorServiceServer
+	server *Server
+}
+
+func (s authorRPC) ListAuthors(ctx context.Context, req *readingv1.ListAuthorsRequest) (*readingv1.ListAuthorsResponse, error) {
+	q, size, err := grpcPage(dto.TypeAuthors, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	r := requestFrom(ctx)
+	authors, err := s.server.service(r).ListAuthors(q)
+	if err != nil {
+		return nil, grpcError(0, err)
+	}
+	resp := &readingv1.ListAuthorsResponse{}
+	if len(*authors) > size {
+		*authors = (*authors)[:size]
+		resp.NextPageToken = pageCursor(dto.TypeAuthors, (*authors)[size-1].ID)
+	}
+	for _, a := range dto.NewAuthorResponses(*authors, viewerID(r)) {
+		resp.Authors = append(resp.Authors, authorMessage(a))
+	}
+	return resp, nil
+}
+
+func (s authorRPC) GetAuthor(ctx context.Context, req *readingv1.GetAuthorRequest) (*readingv1.Author, error) {
+	r := requestFrom(ctx)
+	author, err := s.server.service(r).GetAuthor(req.Id, models.Query{})
+	if err != nil {
+		return nil, grpcError(0, err)
+	}
+	return authorMessage(dto.NewAuthorResponse(author, viewerID(r))), nil
+}
+
+func (s authorRPC) CreateAuthor(ctx context.Context, req *readingv1.CreateAuthorRequest) (*readingv1.Author, error) {
+	o := dto.AuthorOperation{Op: dto.OpCreate, Author: &dto.AuthorRequest{
+		Name:     req.Name,
+		Lastname: req.Lastname,
+		Email:    req.Email,
+	}}
+	return s.write(ctx, o)
+}
+
+func (s authorRPC) UpdateAuthor(ctx context.Context, req *readingv1.UpdateAuthorRequest) (*readingv1.Author, error) {
+	o := dto.AuthorOperation{Op: dto.OpUpdate, ID: req.Id, Author: &dto.AuthorRequest{
+		Name:     req.Name,
+		Lastname: req.Lastname,
+		Email:    req.Email,
+	}}
+	return s.write(ctx, o)
+}
+
+func (s authorRPC) DeleteAuthor(ctx context.Context, req *readingv1.DeleteAuthorRequest) (*emptypb.Empty, error) {
+	if _, err := s.write(ctx, dto.AuthorOperation{Op: dto.OpDelete, ID: req.Id}); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s authorRPC) write(ctx context.Context, o dto.AuthorOperation) (*readingv1.Author, error) {
+	value, err := s.server.grpcWrite(ctx, auth.ScopeAuthorsWrite, func(svc *services.Service, uid uint32) (interface{}, int, error) {
+		return authorOperation(svc, uid, o)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if author, ok := value.(dto.AuthorResponse); ok {
+		return authorMessage(author), nil
+	}
+	return nil, nil
+}
+
+type userRPC struct {
+	readingv1.UnimplementedUserServiceServer
+	server *Server
+}
+
+func (s userRPC) ListUsers(ctx context.Context, req *readingv1.ListUsersRequest) (*readingv1.ListUsersResponse, error) {
+	q, size, err := grpcPage(typeUsers, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	r := requestFrom(ctx)
+	users, err := s.server.service(r).ListUsers(q)
+	if err != nil {
+		return nil, grpcError(0, err)
+	}
+	resp := &readingv1.ListUsersResponse{}
+	if len(*users) > size {
+		*users = (*users)[:size]
+		resp.NextPageToken = pageCursor(typeUsers, (*users)[size-1].ID)
+	}
+	for _, u := range dto.NewUserResponses(*users, viewerID(r)) {
+		resp.Users = append(resp.Users, userMessage(u))
+	}
+	return resp, nil
+}
+
+func (s userRPC) GetUser(ctx context.Context, req *readingv1.GetUserRequest) (*readingv1.User, error) {
+	r := requestFrom(ctx)
+	user, err := s.server.service(r).GetUser(req.Id)
+	if err != nil {
+		return nil, grpcError(0, err)
+	}
+	return userMessage(dto.NewUserResponse(user, viewerID(r))), nil
+}
+
+// CreateUser signs up, so like POST /users it needs no credential.
+func (s userRPC) CreateUser(ctx context.Context, req *readingv1.CreateUserRequest) (*readingv1.User, error) {
+	r := requestFrom(ctx)
+	if err := s.server.grpcRateLimit(r); err != nil {
+		return nil, err
+	}
+	user, code, err := s.server.createUser(r, dto.UserRequest{
+		Nickname: req.Nickname,
+		Email:    req.Email,
+		Password: req.Password,
+	})
+	if err != nil {
+		return nil, grpcError(code, err)
+	}
+	return userMessage(dto.NewUserResponse(user, user.ID)), nil
+}
+
+func (s userRPC) UpdateUser(ctx context.Context, req *readingv1.UpdateUserRequest) (*readingv1.User, error) {
+	r := requestFrom(ctx)
+	value, err := s.server.grpcWrite(ctx, scopeAccount, func(svc *services.Service, uid uint32) (interface{}, int, error) {
+		return s.server.updateUser(r, req.Id, dto.UserRequest{
+			Nickname: req.Nickname,
+			Email:    req.Email,
+			Password: req.Password,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	user := value.(*models.User)
+	return userMessage(dto.NewUserResponse(user, user.ID)), nil
+}
+
+func (s userRPC) DeleteUser(ctx context.Context, req *readingv1.DeleteUserRequest) (*emptypb.Empty, error) {
+	r := requestFrom(ctx)
+	_, err := s.server.grpcWrite(ctx, scopeAccount, func(svc *services.Service, uid uint32) (interface{}, int, error) {
+		code, err := s.server.deleteUser(r, req.Id)
+		return nil, code, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// typeUsers names the users for the cursors of ListUsers.
+const typeUsers = "users"
+
+func bookMessage(b dto.BookResponse) *readingv1.Book {
+	msg := &readingv1.Book{
+		Id:       uint64(b.ID),
+		Title:    b.Title,
+		Content:  b.Content,
+		AuthorId: b.AuthorID,
+	}
+	if b.Author != nil {
+		msg.Author = authorMessage(*b.Author)
+	}
+	return msg
+}
+
+func authorMessage(a dto.AuthorResponse) *readingv1.Author {
+	return &readingv1.Author{
+		Id:       a.ID,
+		Name:     a.Name,
+		Lastname: a.Lastname,
+		Email:    a.Email,
+	}
+}
+
+func userMessage(u dto.UserResponse) *readingv1.User {
+	return &readingv1.User{
+		Id:            u.ID,
+		Nickname:      u.Nickname,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		TotpEnabled:   u.TOTPEnabled,
+		IsAdmin:       u.IsAdmin,
+		CreatedAt:     timestamppb.New(u.CreatedAt),
+		UpdatedAt:     timestamppb.New(u.UpdatedAt),
+	}
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/config"
+	readingv1 "github.com/serg2013/reading/api/proto/reading/v1"
+)
+
+// grpcClients are clients of the gRPC API of one test server.
+type grpcClients struct {
+	books   readingv1.BookServiceClient
+	authors readingv1.AuthorServiceClient
+	users   readingv1.UserServiceClient
+}
+
+// newGRPCTestServer serves the gRPC API of server in memory.
+func newGRPCTestServer(t *testing.T, server *Server) grpcClients {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := server.newGRPCServer()
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpcClients{
+		books:   readingv1.NewBookServiceClient(conn),
+		authors: readingv1.NewAuthorServiceClient(conn),
+		users:   readingv1.NewUserServiceClient(conn),
+	}
+}
+
+// withMetadata returns a context sending the metadata kv, alternating
+// keys and values.
+func withMetadata(kv ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), kv...)
+}
+
+func expectCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Fatalf("code = %s, want %s: %v", got, want, err)
+	}
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	server := newTestServer(t)
+	c := newGRPCTestServer(t, server)
+	user := createUser(t, server, "reader", "reader@example.com", "password", false)
+	token := withMetadata("authorization", bearer(tokenFor(t, user)))
+
+	_, err := c.books.ListBooks(context.Background(), &readingv1.ListBooksRequest{})
+	expectCode(t, err, codes.OK)
+	// A bad credential is refused even where none is needed
+	for _, ctx := range []context.Context{
+		withMetadata("authorization", "Bearer not.a.token"),
+		withMetadata("x-api-key", "rk_not_a_key"),
+	} {
+		_, err = c.books.ListBooks(ctx, &readingv1.ListBooksRequest{})
+		expectCode(t, err, codes.Unauthenticated)
+	}
+	_, err = c.authors.CreateAuthor(context.Background(), &readingv1.CreateAuthorRequest{Name: "Peter", Lastname: "Sidorov", Email: "p.sidorov@example.com"})
+	expectCode(t, err, codes.Unauthenticated)
+
+	author, err := c.authors.CreateAuthor(token, &readingv1.CreateAuthorRequest{Name: "Peter", Lastname: "Sidorov", Email: "p.sidorov@example.com"})
+	expectCode(t, err, codes.OK)
+	if author.Id != user.ID || author.Email != "p.sidorov@example.com" {
+		t.Errorf("author = %v, want the user's with their email", author)
+	}
+	book, err := c.books.CreateBook(token, &readingv1.CreateBookRequest{Title: "Title", Content: "Content", AuthorId: author.Id})
+	expectCode(t, err, codes.OK)
+	got, err := c.books.GetBook(context.Background(), &readingv1.GetBookRequest{Id: book.Id})
+	expectCode(t, err, codes.OK)
+	if got.Title != "Title" {
+		t.Errorf("book = %v", got)
+	}
+	_, err = c.books.GetBook(context.Background(), &readingv1.GetBookRequest{Id: book.Id + 1})
+	expectCode(t, err, codes.NotFound)
+	_, err = c.books.CreateBook(token, &readingv1.CreateBookRequest{Title: "", Content: "Content", AuthorId: author.Id})
+	expectCode(t, err, codes.InvalidArgument)
+}
+
+func TestGRPCScopes(t *testing.T) {
+	server := newTestServer(t)
+	c := newGRPCTestServer(t, server)
+	user := createUser(t, server, "reader", "reader@example.com", "password", false)
+	session := withMetadata("authorization", bearer(tokenFor(t, user)))
+	_, err := c.authors.CreateAuthor(session, &readingv1.CreateAuthorRequest{Name: "Peter", Lastname: "Sidorov", Email: "p.sidorov@example.com"})
+	expectCode(t, err, codes.OK)
+
+	books := withMetadata("x-api-key", createAPIKey(t, server, user, auth.ScopeBooksWrite))
+	_, err = c.books.CreateBook(books, &readingv1.CreateBookRequest{Title: "Title", Content: "Content", AuthorId: user.ID})
+	expectCode(t, err, codes.OK)
+	_, err = c.authors.UpdateAuthor(books, &readingv1.UpdateAuthorRequest{Id: user.ID, Name: "Pyotr", Lastname: "Sidorov", Email: "p.sidorov@example.com"})
+	expectCode(t, err, codes.PermissionDenied)
+
+	// No key may change the account, whatever its scopes
+	all := createAPIKey(t, server, user, auth.Scopes...)
+	for _, ctx := range []context.Context{withMetadata("x-api-key", all), withMetadata("authorization", bearer(all))} {
+		_, err = c.users.UpdateUser(ctx, &readingv1.UpdateUserRequest{Id: user.ID, Nickname: "taken over", Email: "attacker@example.com", Password: "another password"})
+		expectCode(t, err, codes.PermissionDenied)
+		_, err = c.users.DeleteUser(ctx, &readingv1.DeleteUserRequest{Id: user.ID})
+		expectCode(t, err, codes.PermissionDenied)
+	}
+	_, err = c.users.UpdateUser(session, &readingv1.UpdateUserRequest{Id: user.ID, Nickname: "reader", Email: user.Email, Password: "a new password"})
+	expectCode(t, err, codes.OK)
+	_, err = c.users.DeleteUser(session, &readingv1.DeleteUserRequest{Id: user.ID})
+	expectCode(t, err, codes.OK)
+}
+
+func TestGRPCRateLimitAndRequestID(t *testing.T) {
+	server := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimit.WritePerIP = 1
+		cfg.RateLimit.WritePerUser = 1
+	})
+	c := newGRPCTestServer(t, server)
+
+	var header metadata.MD
+	_, err := c.users.CreateUser(withMetadata("x-request-id", "the-request"), &readingv1.CreateUserRequest{Nickname: "reader", Email: "reader@example.com", Password: "correct horse battery"}, grpc.Header(&header))
+	expectCode(t, err, codes.OK)
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "the-request" {
+		t.Errorf("x-request-id = %v, want the one sent", got)
+	}
+	_, err = c.users.CreateUser(context.Background(), &readingv1.CreateUserRequest{Nickname: "other", Email: "other@example.com", Password: "correct horse battery"})
+	expectCode(t, err, codes.ResourceExhausted)
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// Healthz reports that the process is alive.
+// @Description Liveness probe. Always succeeds while the process is serving.
+// @Summary Liveness probe
+// @Tags Health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func (server *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readiness is the body of the /readyz response.
+type readiness struct {
+	Status     string          `json:"status"`
+	Database   string          `json:"database"`
+	Migrations string          `json:"migrations"`
+	Tables     map[string]bool `json:"tables"`
+}
+
+// Readyz reports whether the server can take traffic: the database answers,
+// the startup migration succeeded, every table exists and shutdown has not
+// started.
+// @Description Readiness probe. Pings the database and reports migration status.
+// @Summary Readiness probe
+// @Tags Health
+// @Produce json
+// @Success 200 {object} readiness
+// @Failure 503 {object} readiness
+// @Router /readyz [get]
+func (server *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	ready := true
+	res := readiness{Database: "ok", Migrations: "ok", Tables: map[string]bool{}}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := server.DB.DB().PingContext(ctx); err != nil {
+		ready = false
+		res.Database = err.Error()
+	}
+	if server.migrationErr != nil {
+		ready = false
+		res.Migrations = server.migrationErr.Error()
+	}
+	if res.Database == "ok" {
+		for _, table := range models.Tables() {
+			exists := server.DB.HasTable(table)
+			res.Tables[server.DB.NewScope(table).TableName()] = exists
+			ready = ready && exists
+		}
+	}
+	if atomic.LoadInt32(&server.draining) == 1 {
+		ready = false
+	}
+
+	if !ready {
+		res.Status = "unavailable"
+		responses.JSON(w, http.StatusServiceUnavailable, res)
+		return
+	}
+	res.Status = "ready"
+	responses.JSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/ratelimit"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// idempotent lets clients retry next safely. A request with an
+// Idempotency-Key header is handled once; retries with the same key and
+// body get the stored response, marked with Idempotent-Replayed, until the
+// key expires. Server errors and 429s are not stored, so those can be
+// retried for real, and neither are requests that outlive the lock
+// timeout, which a retry takes over. Anonymous keys are kept per client
+// address.
+func (server *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Idempotency-Key must not be longer than 255 characters"))
+			return
+		}
+
+		// Read one byte past the limit: a body that large is left for the
+		// handler to refuse, and is not worth remembering.
+		limit := int64(server.config.Server.MaxBodyBytes)
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if int64(len(body)) > limit {
+			next(w, r)
+			return
+		}
+
+		uid := viewerID(r)
+		fingerprint := requestFingerprint(r, body)
+		cfg := server.config.Idempotency
+		claim, claimed, err := models.ClaimIdempotencyKey(server.DB, uid, ratelimit.ByIP(r), key, fingerprint, cfg.TTL, cfg.LockTimeout)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !claimed {
+			switch {
+			case claim.Fingerprint != fingerprint:
+				responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Idempotency-Key was already used for a different request"))
+			case !claim.Done():
+				w.Header().Set("Retry-After", "1")
+				responses.ERROR(w, http.StatusConflict, errors.New("A request with this Idempotency-Key is still in progress"))
+			default:
+				replay(w, claim)
+			}
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		stored := false
+		defer func() {
+			// Also on panic: a claim left behind would block retries
+			if !stored {
+				if err := claim.ReleaseIdempotencyKey(server.DB); err != nil {
+					logger.Error(r.Context(), "cannot release idempotency key", logger.Fields{"error": err})
+				}
+			}
+		}()
+		next(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= 500 || status == http.StatusTooManyRequests {
+			return
+		}
+		err = claim.CompleteIdempotencyKey(server.DB, status, w.Header().Get("Content-Type"), w.Header().Get("Location"), rec.body.String())
+		if err != nil {
+			logger.Error(r.Context(), "cannot store idempotent response", logger.Fields{"error": err})
+			return
+		}
+		stored = true
+	}
+}
+
+// requestFingerprint identifies what r asks for, to tell a retry from a
+// different request with the same key.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay writes the response stored for an idempotency key.
+func replay(w http.ResponseWriter, k *models.IdempotencyKey) {
+	if k.ContentType != "" {
+		w.Header().Set("Content-Type", k.ContentType)
+	}
+	if k.Location != "" {
+		w.Header().Set("Location", k.Location)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(k.Status)
+	io.WriteString(w, k.Body)
+}
+
+// responseRecorder passes a response through and keeps a copy.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serg2013/reading/api/models"
+)
+
+// signup posts a new user from the client at addr with Idempotency-Key key.
+func signup(server *Server, addr, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/v1/users", strings.NewReader(body))
+	r.RemoteAddr = addr
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	server.Router.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotentAnonymousKeysPerClient(t *testing.T) {
+	server := newTestServer(t)
+	alice := `{"nickname":"alice","email":"alice@example.com","password":"correct horse battery"}`
+	mallory := `{"nickname":"mallory","email":"mallory@example.com","password":"correct horse battery"}`
+
+	w := signup(server, "192.0.2.1:1234", "signup", alice)
+	expectStatus(t, w, http.StatusCreated)
+	// Another caller using the same key is not blocked by it
+	w = signup(server, "198.51.100.7:4321", "signup", mallory)
+	expectStatus(t, w, http.StatusCreated)
+	if w.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("the response to another client was replayed")
+	}
+
+	w = signup(server, "192.0.2.1:5678", "signup", alice)
+	expectStatus(t, w, http.StatusCreated)
+	if w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("a retry from the same client was not replayed")
+	}
+	w = signup(server, "192.0.2.1:5678", "signup", mallory)
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+}
+
+func TestIdempotentTakesOverStaleRequests(t *testing.T) {
+	server := newTestServer(t)
+	body := `{"nickname":"reader","email":"reader@example.com","password":"correct horse battery"}`
+	r := httptest.NewRequest("POST", "/v1/users", nil)
+	fingerprint := requestFingerprint(r, []byte(body))
+	// Claims left by requests still running and by one that died
+	for key, lock := range map[string]time.Duration{"running": time.Hour, "died": -time.Second} {
+		_, claimed, err := models.ClaimIdempotencyKey(server.DB, 0, "192.0.2.1", key, fingerprint, time.Hour, lock)
+		if err != nil || !claimed {
+			t.Fatalf("claim %s: %v %v", key, claimed, err)
+		}
+	}
+
+	w := signup(server, "192.0.2.1:1234", "running", body)
+	expectStatus(t, w, http.StatusConflict)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After while the first request runs")
+	}
+	w = signup(server, "192.0.2.1:1234", "died", body)
+	expectStatus(t, w, http.StatusCreated)
+	w = signup(server, "192.0.2.1:1234", "died", body)
+	expectStatus(t, w, http.StatusCreated)
+	if w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("the response of the request taking over was not stored")
+	}
+}
@@ -1,14 +1,19 @@
 package controllers
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 
+	"github.com/jinzhu/gorm"
 	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/metrics"
+	"github.com/serg2013/reading/api/middlewares"
 	"github.com/serg2013/reading/api/models"
 	"github.com/serg2013/reading/api/responses"
-	"github.com/serg2013/reading/api/utils/formaterror"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,49 +24,186 @@ import (
 // @Accept  json
 // @Produce  json
 // @Param user body models.Cred true "Authorization"
-// @Success 200 {object} models.User
-// @Router /login [post]
+// @Success 200 {string} string "access token, or a dto.LoginChallenge for users with two-factor login"
+// @Router /v1/login [post]
 func (server *Server) Login(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
+	cred := models.Cred{}
+	if !server.decodeJSON(w, r, &cred) {
+		return
+	}
+
+	user := models.User{Email: cred.Email, Password: cred.Password}
+	user.Prepare()
+	err := user.Validate("login")
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	user := models.User{}
-	err = json.Unmarshal(body, &user)
+	wait, err := server.loginGuard.Wait(user.Email)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wait > 0 {
+		// Too many recent failures: the account is delayed or locked
+		middlewares.TooManyRequests(w, wait)
+		return
+	}
+	signedIn, err := server.SignIn(user.Email, user.Password)
+	if err != nil {
+		metrics.Logins.Inc("failure")
+		if errors.Is(err, ErrEmailNotVerified) {
+			responses.ERROR(w, http.StatusForbidden, err)
+			return
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			logger.Error(r.Context(), "cannot sign in", logger.Fields{"error": err})
+			responses.ERROR(w, http.StatusInternalServerError, errors.New(http.StatusText(http.StatusInternalServerError)))
+			return
+		}
+		if err := server.loginGuard.Failed(user.Email); err != nil {
+			logger.Error(r.Context(), "cannot record failed login", logger.Fields{"error": err})
+		}
+		responses.ERROR(w, http.StatusUnauthorized, ErrInvalidCredentials)
 		return
 	}
+	if signedIn.TOTPEnabled {
+		// The password was right; the second factor goes to LoginMFA
+		ttl := server.config.Auth.MFAChallengeTTL
+		challenge, err := auth.CreateChallengeToken(signedIn.ID, ttl)
+		if err != nil {
+			logger.Error(r.Context(), "cannot create challenge", logger.Fields{"error": err})
+			responses.ERROR(w, http.StatusInternalServerError, errors.New(http.StatusText(http.StatusInternalServerError)))
+			return
+		}
+		metrics.Logins.Inc("challenge")
+		responses.JSON(w, http.StatusOK, dto.LoginChallenge{MFARequired: true, Challenge: challenge, ExpiresIn: int(ttl.Seconds())})
+		return
+	}
+	server.issueToken(w, r, signedIn, auth.AMRPassword)
+}
 
-	user.Prepare()
-	err = user.Validate("login")
+// LoginMFA completes a two-factor login
+// @Summary Completes a two-factor login
+// @Description Exchanges the challenge from /login and a code from the authenticator app, or a recovery code, for an access token.
+// @Tags Authorization
+// @Accept  json
+// @Produce  json
+// @Param data body dto.MFALogin true "challenge and code"
+// @Success 200 {string} string "access token"
+// @Router /v1/login/mfa [post]
+func (server *Server) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	req := dto.MFALogin{}
+	if !server.decodeJSON(w, r, &req) {
+		return
+	}
+	uid, err := auth.ParseChallengeToken(req.Challenge)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		responses.ERROR(w, http.StatusUnauthorized, err)
 		return
 	}
-	token, err := server.SignIn(user.Email, user.Password)
+	user, err := server.service(r).GetUser(uid)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusUnprocessableEntity, formattedError)
+		responses.ERROR(w, http.StatusUnauthorized, auth.ErrInvalidChallenge)
 		return
 	}
+	// Wrong codes count against the same account as wrong passwords
+	wait, err := server.loginGuard.Wait(user.Email)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wait > 0 {
+		middlewares.TooManyRequests(w, wait)
+		return
+	}
+	amr, err := server.service(r).VerifySecondFactor(uid, req.Code)
+	if err != nil {
+		metrics.Logins.Inc("failure")
+		if !errors.Is(err, models.ErrInvalidCode) {
+			serviceError(w, err)
+			return
+		}
+		if err := server.loginGuard.Failed(user.Email); err != nil {
+			logger.Error(r.Context(), "cannot record failed login", logger.Fields{"error": err})
+		}
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	server.issueToken(w, r, user, amr...)
+}
+
+// issueToken answers a successful login with an access token for user.
+func (server *Server) issueToken(w http.ResponseWriter, r *http.Request, user *models.User, amr ...string) {
+	token, err := auth.CreateToken(user.ID, amr...)
+	if err != nil {
+		logger.Error(r.Context(), "cannot create token", logger.Fields{"error": err})
+		responses.ERROR(w, http.StatusInternalServerError, errors.New(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+	metrics.Logins.Inc("success")
+	if err := server.loginGuard.Succeeded(user.Email); err != nil {
+		logger.Error(r.Context(), "cannot reset failed logins", logger.Fields{"error": err})
+	}
 	responses.JSON(w, http.StatusOK, token)
 }
 
-func (server *Server) SignIn(email, password string) (string, error) {
+// ErrInvalidCredentials is the only error a client sees for a failed login,
+// whether the email is unknown or the password is wrong.
+var ErrInvalidCredentials = errors.New("Invalid email or password")
+
+// ErrEmailNotVerified refuses a correct login while auth.require_verified_email
+// is set and the user has not verified their email yet.
+var ErrEmailNotVerified = errors.New("Email not verified")
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash returns a bcrypt hash to compare against when the email
+// is unknown, so that case takes as long as a wrong password.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := models.Hash("not the password of any user")
+		if err != nil {
+			panic(err)
+		}
+		dummyHash = string(hash)
+	})
+	return dummyHash
+}
+
+// SignIn returns the user with email and password. It returns
+// ErrInvalidCredentials if there is no such user or the password does not
+// match, and any other error only for failures on the server side.
+func (server *Server) SignIn(email, password string) (*models.User, error) {
 
 	var err error
 
 	user := models.User{}
 
-	err = server.DB.Debug().Model(models.User{}).Where("email = ?", email).Take(&user).Error
+	err = server.DB.Model(models.User{}).Where("email = ?", email).Take(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		// Spend the same bcrypt work as for a known user
+		models.VerifyPassword(dummyPasswordHash(), password)
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	err = models.VerifyPassword(user.Password, password)
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return "", err
+	switch {
+	case err == nil:
+		if server.config.Auth.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+			return nil, ErrEmailNotVerified
+		}
+		return &user, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return nil, ErrInvalidCredentials
+	default:
+		// A stored hash bcrypt cannot read: never let the user in, and
+		// report it as a server problem rather than a bad password.
+		return nil, fmt.Errorf("verifying password of user %d: %v", user.ID, err)
 	}
-	return auth.CreateToken(user.ID)
 }
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/serg2013/reading/api/config"
+	"github.com/serg2013/reading/api/models"
+)
+
+func TestSignIn(t *testing.T) {
+	server := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.RequireVerifiedEmail = true
+	})
+	createUser(t, server, "reader", "reader@example.com", "password", false)
+	corrupt := createUser(t, server, "corrupt", "corrupt@example.com", "password", false)
+	// A hash bcrypt cannot read
+	err := server.DB.Model(&models.User{}).Where("id = ?", corrupt.ID).UpdateColumn("password", "not a bcrypt hash").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	unverified := createUser(t, server, "unverified", "unverified@example.com", "password", false)
+	err = server.DB.Model(&models.User{}).Where("id = ?", unverified.ID).UpdateColumn("email_verified_at", nil).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		err      error // nil for success, errUnknown for any other error
+		status   int
+	}{
+		{"unknown email", "nobody@example.com", "password", ErrInvalidCredentials, http.StatusUnauthorized},
+		{"wrong password", "reader@example.com", "wrong password", ErrInvalidCredentials, http.StatusUnauthorized},
+		{"unreadable hash", "corrupt@example.com", "password", errUnknown, http.StatusInternalServerError},
+		{"unverified email", "unverified@example.com", "password", ErrEmailNotVerified, http.StatusForbidden},
+		{"success", "reader@example.com", "password", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := server.SignIn(tt.email, tt.password)
+			switch {
+			case tt.err == nil:
+				if err != nil || user == nil || user.Email != tt.email {
+					t.Errorf("SignIn = %v, %v; want the user", user, err)
+				}
+			case tt.err == errUnknown:
+				if err == nil || errors.Is(err, ErrInvalidCredentials) || user != nil {
+					t.Errorf("SignIn = %v, %v; want a server error", user, err)
+				}
+			default:
+				if !errors.Is(err, tt.err) || user != nil {
+					t.Errorf("SignIn = %v, %v; want %v", user, err, tt.err)
+				}
+			}
+
+			w := do(server, "POST", "/v1/login", models.Cred{Email: tt.email, Password: tt.password})
+			expectStatus(t, w, tt.status)
+			if tt.err == ErrInvalidCredentials {
+				// Unknown emails and wrong passwords look the same
+				want := `{"error":"` + ErrInvalidCredentials.Error() + `"}`
+				if body := strings.TrimSpace(w.Body.String()); body != want {
+					t.Errorf("body = %s, want %s", body, want)
+				}
+			}
+		})
+	}
+}
+
+// errUnknown stands for an error other than the ones a test names.
+var errUnknown = errors.New("any other error")
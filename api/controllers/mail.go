@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/mail"
+	"github.com/serg2013/reading/api/models"
+)
+
+// sendMail sends msg in the background, so neither a slow mail server nor
+// the response time reveal anything to the client. Failures are logged.
+func (server *Server) sendMail(r *http.Request, msg mail.Message) {
+	ctx := logger.WithRequestID(context.Background(), logger.RequestID(r.Context()))
+	server.background.Add(1)
+	go func() {
+		defer server.background.Done()
+		if err := server.mailer.Send(ctx, msg); err != nil {
+			logger.Error(ctx, "cannot send mail", logger.Fields{"subject": msg.Subject, "error": err})
+		}
+	}()
+}
+
+// link returns the address of page in the web app, carrying token.
+func (server *Server) link(page, token string) string {
+	base := strings.TrimRight(server.config.Mail.LinkBaseURL, "/")
+	return base + page + "?token=" + url.QueryEscape(token)
+}
+
+func (server *Server) sendEmailVerification(r *http.Request, user *models.User, token string) {
+	server.sendMail(r, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n",
+			user.Nickname, server.link("/verify-email", token), server.config.Auth.VerifyTokenTTL),
+	})
+}
+
+func (server *Server) sendPasswordReset(r *http.Request, user *models.User, token string) {
+	server.sendMail(r, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nSomeone asked to reset the password of your account. To choose a new password open this link:\n\n%s\n\nThe link expires in %s and works once. If you did not ask for it, ignore this message.\n",
+			user.Nickname, server.link("/reset-password", token), server.config.Auth.ResetTokenTTL),
+	})
+}
+
+// startEmailVerification mails user uid a verification link. Failures are
+// logged: the user can ask for another link.
+func (server *Server) startEmailVerification(r *http.Request, uid uint32) {
+	user, token, err := server.service(r).StartEmailVerification(uid, server.config.Auth.VerifyTokenTTL)
+	if err != nil {
+		logger.Error(r.Context(), "cannot start email verification", logger.Fields{"user_id": uid, "error": err})
+		return
+	}
+	server.sendEmailVerification(r, user, token)
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// EnrollTOTP starts two-factor enrollment
+// @Summary Starts two-factor enrollment
+// @Description Creates a TOTP secret for the signed in user. Login keeps working with the password alone until the secret is confirmed.
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} dto.TOTPEnrollment
+// @Router /v1/auth/totp/enroll [post]
+func (server *Server) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	secret, uri, err := server.service(r).EnrollTOTP(uid, server.config.Auth.TOTPIssuer)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, dto.TOTPEnrollment{Secret: secret, URI: uri})
+}
+
+// ConfirmTOTP turns on two-factor login
+// @Summary Confirms two-factor enrollment
+// @Description Turns on two-factor login once a code from the app matches, and returns the recovery codes. They are not shown again.
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body dto.MFACode true "code from the authenticator app"
+// @Success 200 {object} dto.RecoveryCodes
+// @Router /v1/auth/totp/confirm [post]
+func (server *Server) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, req, ok := server.mfaRequest(w, r)
+	if !ok {
+		return
+	}
+	codes, err := server.service(r).ConfirmTOTP(uid, req.Code)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, dto.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns off two-factor login
+// @Summary Disables two-factor login
+// @Description Turns off two-factor login and deletes the recovery codes. Needs a current code or a recovery code.
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body dto.MFACode true "code from the authenticator app or a recovery code"
+// @Success 204
+// @Router /v1/auth/totp/disable [post]
+func (server *Server) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, req, ok := server.mfaRequest(w, r)
+	if !ok {
+		return
+	}
+	err := server.service(r).DisableTOTP(uid, req.Code)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes
+// @Summary Regenerates recovery codes
+// @Description Replaces all recovery codes. Needs a current code or a recovery code.
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body dto.MFACode true "code from the authenticator app or a recovery code"
+// @Success 200 {object} dto.RecoveryCodes
+// @Router /v1/auth/totp/recovery-codes [post]
+func (server *Server) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	uid, req, ok := server.mfaRequest(w, r)
+	if !ok {
+		return
+	}
+	codes, err := server.service(r).RegenerateRecoveryCodes(uid, req.Code)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, dto.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// mfaRequest reads the signed in user and the code of a two-factor
+// request, or writes the error response and returns false.
+func (server *Server) mfaRequest(w http.ResponseWriter, r *http.Request) (uint32, dto.MFACode, bool) {
+	req := dto.MFACode{}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return 0, req, false
+	}
+	if !server.decodeJSON(w, r, &req) {
+		return 0, req, false
+	}
+	if req.Code == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Code"))
+		return 0, req, false
+	}
+	return uid, req, true
+}
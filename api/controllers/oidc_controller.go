@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/metrics"
+	"github.com/serg2013/reading/api/oidc"
+	"github.com/serg2013/reading/api/responses"
+	"github.com/serg2013/reading/api/services"
+)
+
+const (
+	oidcCookie  = "reading_oidc"
+	oidcPurpose = "oidc_login"
+	// oidcFlowTTL is how long the user has to sign in at the provider.
+	oidcFlowTTL = 10 * time.Minute
+)
+
+// OIDCLogin starts a login at the identity provider
+// @Summary Signs in with the identity provider
+// @Description Redirects to the OpenID Connect provider. It sends the user back to /v1/auth/oidc/callback.
+// @Tags Authorization
+// @Success 302
+// @Router /v1/auth/oidc/login [get]
+func (server *Server) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	values := map[string]string{}
+	for _, k := range []string{"state", "nonce", "verifier"} {
+		v, err := oidc.RandomString()
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		values[k] = v
+	}
+	target, err := server.oidc.AuthCodeURL(r.Context(), values["state"], values["nonce"], values["verifier"])
+	if err != nil {
+		logger.Error(r.Context(), "cannot start OIDC login", logger.Fields{"error": err})
+		responses.ERROR(w, http.StatusBadGateway, errors.New("Identity provider unavailable"))
+		return
+	}
+	// The state, nonce and PKCE verifier wait for the callback in a signed
+	// cookie, so any instance of the API can finish the login.
+	flow, err := auth.CreateStateToken(oidcPurpose, values, oidcFlowTTL)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	http.SetCookie(w, server.oidcCookie(flow, int(oidcFlowTTL.Seconds())))
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback finishes a login at the identity provider
+// @Summary Finishes signing in with the identity provider
+// @Description The identity provider redirects here. The reply is an access token, as from /login.
+// @Tags Authorization
+// @Produce json
+// @Param code query string true "authorization code"
+// @Param state query string true "state"
+// @Success 200 {string} string "access token"
+// @Router /v1/auth/oidc/callback [get]
+func (server *Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	// The flow cookie is single use whatever happens next
+	http.SetCookie(w, server.oidcCookie("", -1))
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		metrics.Logins.Inc("failure")
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Identity provider refused the login: "+e))
+		return
+	}
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, auth.ErrInvalidState)
+		return
+	}
+	flow, err := auth.ParseStateToken(oidcPurpose, cookie.Value)
+	if err != nil || q.Get("state") == "" || q.Get("state") != flow["state"] {
+		responses.ERROR(w, http.StatusBadRequest, auth.ErrInvalidState)
+		return
+	}
+	claims, err := server.oidc.Exchange(r.Context(), q.Get("code"), flow["verifier"], flow["nonce"])
+	if err != nil {
+		metrics.Logins.Inc("failure")
+		logger.Warn(r.Context(), "OIDC login failed", logger.Fields{"error": err})
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Identity provider login failed"))
+		return
+	}
+	nickname := claims.PreferredUsername
+	if nickname == "" {
+		nickname = claims.Name
+	}
+	user, err := server.service(r).SignInExternal(services.ExternalUser{
+		Issuer:        server.oidc.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Nickname:      nickname,
+	}, server.config.OIDC.AllowSignup)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrEmailNotVerifiedByProvider), errors.Is(err, services.ErrSignupDisabled):
+		metrics.Logins.Inc("failure")
+		responses.ERROR(w, http.StatusForbidden, err)
+		return
+	case errors.Is(err, services.ErrUnverifiedAccount):
+		metrics.Logins.Inc("failure")
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	default:
+		serviceError(w, err)
+		return
+	}
+	server.issueToken(w, r, user, append([]string{auth.AMROIDC}, claims.AMR...)...)
+}
+
+// oidcCookie returns the cookie carrying the login flow, scoped to the
+// callback and only sent over HTTPS when the callback uses it.
+func (server *Server) oidcCookie(value string, maxAge int) *http.Cookie {
+	secure := false
+	cookiePath := "/"
+	if u, err := url.Parse(server.config.OIDC.RedirectURL); err == nil {
+		secure = u.Scheme == "https"
+		if dir := path.Dir(u.Path); strings.HasPrefix(dir, "/") {
+			cookiePath = dir
+		}
+	}
+	return &http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     cookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		// Lax still sends it on the provider's top level redirect back
+		SameSite: http.SameSiteLaxMode,
+	}
+}
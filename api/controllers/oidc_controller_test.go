@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/serg2013/reading/api/config"
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/oidc/oidctest"
+)
+
+func newOIDCTestServer(t *testing.T) (*Server, *oidctest.Server) {
+	idp := oidctest.NewServer("reading", "client secret")
+	t.Cleanup(idp.Close)
+	server := newTestServer(t, func(cfg *config.Config) {
+		cfg.OIDC.Enabled = true
+		cfg.OIDC.Issuer = idp.URL
+		cfg.OIDC.ClientID = idp.ClientID
+		cfg.OIDC.ClientSecret = config.Secret(idp.ClientSecret)
+		cfg.OIDC.RedirectURL = "http://reading.example.com/v1/auth/oidc/callback"
+		cfg.OIDC.AllowSignup = true
+	})
+	return server, idp
+}
+
+// startOIDCLogin starts a login and returns where the user is sent and the
+// flow cookie.
+func startOIDCLogin(t *testing.T, server *Server) (string, *http.Cookie) {
+	t.Helper()
+	w := do(server, "GET", "/v1/auth/oidc/login", nil)
+	expectStatus(t, w, http.StatusFound)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcCookie || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %v, want the HttpOnly flow cookie", cookies)
+	}
+	return w.Header().Get("Location"), cookies[0]
+}
+
+// callback sends the user back from the provider to target with cookie.
+func callback(server *Server, target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	server.Router.ServeHTTP(w, r)
+	return w
+}
+
+func TestOIDCLogin(t *testing.T) {
+	server, idp := newOIDCTestServer(t)
+	existing := createUser(t, server, "reader", "reader@example.com", "password", false)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+		// user is the email of the user signed in
+		user string
+	}{
+		{"links a verified email", jwt.MapClaims{"sub": "u-1", "email": "Reader@example.com", "email_verified": true}, http.StatusOK, existing.Email},
+		{"signs in the linked account", jwt.MapClaims{"sub": "u-1", "email": "changed@example.com"}, http.StatusOK, existing.Email},
+		{"provisions a new user", jwt.MapClaims{"sub": "u-2", "email": "new@example.com", "email_verified": true, "preferred_username": "newbie"}, http.StatusOK, "new@example.com"},
+		{"refuses an unverified email", jwt.MapClaims{"sub": "u-3", "email": "other@example.com", "email_verified": false}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, cookie := startOIDCLogin(t, server)
+			back, err := idp.Authorize(authURL, tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := callback(server, back.RequestURI(), cookie)
+			expectStatus(t, w, tt.status)
+			if tt.user == "" {
+				return
+			}
+			claims := tokenClaims(t, w.Body.String())
+			user := models.User{}
+			if err := server.DB.Where("email = ?", tt.user).Take(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+			if uid, _ := claims["user_id"].(float64); uint32(uid) != user.ID {
+				t.Errorf("token for user %v, want %d", claims["user_id"], user.ID)
+			}
+			if amr, _ := claims["amr"].([]interface{}); len(amr) == 0 || amr[0] != "oidc" {
+				t.Errorf("amr = %v, want oidc", claims["amr"])
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackChecksTheFlow(t *testing.T) {
+	server, idp := newOIDCTestServer(t)
+	claims := jwt.MapClaims{"sub": "u-1", "email": "reader@example.com", "email_verified": true}
+	authURL, cookie := startOIDCLogin(t, server)
+	back, err := idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("without the cookie", func(t *testing.T) {
+		expectStatus(t, callback(server, back.RequestURI(), nil), http.StatusBadRequest)
+	})
+	t.Run("with another state", func(t *testing.T) {
+		q := back.Query()
+		q.Set("state", "forged")
+		expectStatus(t, callback(server, back.Path+"?"+q.Encode(), cookie), http.StatusBadRequest)
+	})
+	t.Run("with the cookie of another login", func(t *testing.T) {
+		_, other := startOIDCLogin(t, server)
+		expectStatus(t, callback(server, back.RequestURI(), other), http.StatusBadRequest)
+	})
+	t.Run("with a tampered cookie", func(t *testing.T) {
+		tampered := *cookie
+		tampered.Value = cookie.Value[:len(cookie.Value)-2] + "xx"
+		expectStatus(t, callback(server, back.RequestURI(), &tampered), http.StatusBadRequest)
+	})
+	t.Run("refused by the provider", func(t *testing.T) {
+		expectStatus(t, callback(server, back.Path+"?error=access_denied", cookie), http.StatusUnauthorized)
+	})
+	t.Run("with the flow it started", func(t *testing.T) {
+		expectStatus(t, callback(server, back.RequestURI(), cookie), http.StatusOK)
+	})
+	t.Run("with a code used already", func(t *testing.T) {
+		expectStatus(t, callback(server, back.RequestURI(), cookie), http.StatusUnauthorized)
+	})
+}
+
+// tokenClaims returns the claims of the access token in body, unverified.
+func tokenClaims(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var token string
+	if err := json.Unmarshal([]byte(body), &token); err != nil {
+		t.Fatalf("response %s: %v", body, err)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("response %s is not a token", body)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// readQuery parses the ?fields[type]=a,b and ?include=x,y parameters of a
+// read of typ. Without include the relations in defaultInclude are loaded,
+// as they were before the parameter existed; include= loads none.
+func readQuery(r *http.Request, typ string, defaultInclude ...string) (models.Query, error) {
+	q := models.Query{Fields: map[string][]string{}, Include: map[string]bool{}}
+	values := r.URL.Query()
+	for key, vals := range values {
+		if strings.HasPrefix(key, "fields[") && strings.HasSuffix(key, "]") {
+			q.Fields[key[len("fields["):len(key)-1]] = splitParam(vals)
+		}
+	}
+	if err := dto.CheckFields(q.Fields); err != nil {
+		return q, err
+	}
+	include := defaultInclude
+	if vals, ok := values["include"]; ok {
+		include = splitParam(vals)
+	}
+	if err := dto.CheckInclude(typ, include); err != nil {
+		return q, err
+	}
+	for _, rel := range include {
+		q.Include[rel] = true
+	}
+	return q, nil
+}
+
+// pageCursor returns the opaque cursor that continues a list of typ after
+// the item with ID id.
+func pageCursor(typ string, id uint32) string {
+	return idCursor(typ, uint64(id))
+}
+
+// readCursor returns the ID a cursor of pageCursor continues after, or 0
+// for the empty cursor of the first page.
+func readCursor(typ, cursor string) (uint32, error) {
+	id, err := readIDCursor(typ, cursor, 32)
+	return uint32(id), err
+}
+
+// idCursor is pageCursor for lists with 64-bit IDs.
+func idCursor(typ string, id uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d", typ, id)))
+}
+
+// readIDCursor reads a cursor of idCursor whose ID fits in bits bits.
+func readIDCursor(typ, cursor string, bits int) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && strings.HasPrefix(string(raw), typ+":") {
+		id, err := strconv.ParseUint(strings.TrimPrefix(string(raw), typ+":"), 10, bits)
+		if err == nil {
+			return id, nil
+		}
+	}
+	return 0, errors.New("Invalid cursor")
+}
+
+// requestKey carries the request that GraphQL resolvers and gRPC methods
+// work for.
+type requestKey struct{}
+
+func withRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+// requestFrom returns the request a resolver or gRPC method works for, to
+// act on behalf of whoever made it.
+func requestFrom(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(requestKey{}).(*http.Request)
+	return r
+}
+
+// splitParam returns the comma separated items of a repeated parameter.
+func splitParam(vals []string) []string {
+	items := []string{}
+	for _, v := range vals {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// sparseJSON writes v, a response of type typ, with only the fields q asks
+// for.
+func sparseJSON(w http.ResponseWriter, status int, v interface{}, typ string, q models.Query) {
+	shaped, err := dto.Sparse(v, typ, q.Fields)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, status, shaped)
+}
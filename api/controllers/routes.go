@@ -1,28 +1,124 @@
 package controllers
 
-import "github.com/serg2013/reading/api/middlewares"
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/metrics"
+	"github.com/serg2013/reading/api/middlewares"
+)
+
+// apiVersion is a version of the API, served under /<name>.
+type apiVersion struct {
+	name   string
+	routes func(r *mux.Router)
+}
+
+// apiVersions lists the versions served, oldest first. A new version gets
+// its own routes function, sharing the handlers whose requests and
+// responses did not change, so clients can move over while the old one
+// is still served.
+func (s *Server) apiVersions() []apiVersion {
+	return []apiVersion{
+		{name: "v1", routes: s.initializeV1Routes},
+	}
+}
 
 func (s *Server) initializeRoutes() {
 
 	s.Router.HandleFunc("/", middlewares.SetMiddlewareJSON(s.Home)).Methods("GET")
 
-	s.Router.HandleFunc("/login", middlewares.SetMiddlewareJSON(s.Login)).Methods("POST")
-
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.CreateUser)).Methods("POST")
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.GetUsers)).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(s.GetUser)).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateUser))).Methods("PUT")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteUser)).Methods("DELETE")
-
-	s.Router.HandleFunc("/authors", middlewares.SetMiddlewareJSON(s.CreateAuthor)).Methods("POST")
-	s.Router.HandleFunc("/authors", middlewares.SetMiddlewareJSON(s.GetAuthors)).Methods("GET")
-	s.Router.HandleFunc("/authors/{id}", middlewares.SetMiddlewareJSON(s.GetAuthor)).Methods("GET")
-	s.Router.HandleFunc("/authors/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateAuthor))).Methods("PUT")
-	s.Router.HandleFunc("/authors/{id}", middlewares.SetMiddlewareAuthentication(s.UpdateAuthor)).Methods("DELETE")
-
-	s.Router.HandleFunc("/books", middlewares.SetMiddlewareJSON(s.CreateBook)).Methods("POST")
-	s.Router.HandleFunc("/books", middlewares.SetMiddlewareJSON(s.GetBooks)).Methods("GET")
-	s.Router.HandleFunc("/books/{id}", middlewares.SetMiddlewareJSON(s.GetBook)).Methods("GET")
-	s.Router.HandleFunc("/books/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateBook))).Methods("PUT")
-	s.Router.HandleFunc("/books/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteBook)).Methods("DELETE")
+	s.Router.HandleFunc("/healthz", middlewares.SetMiddlewareJSON(s.Healthz)).Methods("GET")
+	s.Router.HandleFunc("/readyz", middlewares.SetMiddlewareJSON(s.Readyz)).Methods("GET")
+	s.Router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	// The schema evolves by adding fields rather than by versions.
+	if s.graphql != nil {
+		s.Router.HandleFunc("/graphql", middlewares.SetMiddlewareJSON(s.GraphQL)).Methods("POST")
+	}
+
+	for _, v := range s.apiVersions() {
+		sub := s.Router.PathPrefix("/" + v.name).Subrouter()
+		if d, ok := s.config.API.Deprecated[v.name]; ok {
+			sub.Use(middlewares.SetMiddlewareDeprecation(d.Since, d.Sunset, ""))
+		}
+		v.routes(sub)
+	}
+
+	// Clients from before versioning call the v1 routes without a prefix.
+	if legacy := s.config.API.Legacy; legacy.Enabled {
+		sub := s.Router.NewRoute().Subrouter()
+		sub.Use(middlewares.SetMiddlewareDeprecation(legacy.Since, legacy.Sunset, "/v1"))
+		s.initializeV1Routes(sub)
+	}
+}
+
+func (s *Server) initializeV1Routes(r *mux.Router) {
+
+	login := middlewares.SetMiddlewareRateLimit(s.loginLimiter)
+	write := middlewares.SetMiddlewareRateLimit(s.writeLimiter)
+	// API keys may only do what their scopes allow, and never manage the
+	// account itself.
+	authors := middlewares.SetMiddlewareScope(auth.ScopeAuthorsWrite)
+	books := middlewares.SetMiddlewareScope(auth.ScopeBooksWrite)
+	account := middlewares.SetMiddlewareNoAPIKey
+	// Creating requests can be retried safely with an Idempotency-Key.
+	idem := s.idempotent
+
+	r.HandleFunc("/login", middlewares.SetMiddlewareJSON(login(s.Login))).Methods("POST")
+	r.HandleFunc("/login/mfa", middlewares.SetMiddlewareJSON(login(s.LoginMFA))).Methods("POST")
+	if s.oidc != nil {
+		r.HandleFunc("/auth/oidc/login", login(s.OIDCLogin)).Methods("GET")
+		r.HandleFunc("/auth/oidc/callback", middlewares.SetMiddlewareJSON(login(s.OIDCCallback))).Methods("GET")
+	}
+	r.HandleFunc("/auth/password-reset", middlewares.SetMiddlewareJSON(login(s.RequestPasswordReset))).Methods("POST")
+	r.HandleFunc("/auth/password-reset/confirm", middlewares.SetMiddlewareJSON(login(s.ConfirmPasswordReset))).Methods("POST")
+	r.HandleFunc("/auth/verify-email", middlewares.SetMiddlewareJSON(login(s.VerifyEmail))).Methods("POST")
+	r.HandleFunc("/auth/verify-email/resend", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(account(write(s.ResendEmailVerification))))).Methods("POST")
+	r.HandleFunc("/auth/totp/enroll", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(account(write(s.EnrollTOTP))))).Methods("POST")
+	r.HandleFunc("/auth/totp/confirm", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(account(login(s.ConfirmTOTP))))).Methods("POST")
+	r.HandleFunc("/auth/totp/disable", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(account(login(s.DisableTOTP))))).Methods("POST")
+	r.HandleFunc("/auth/totp/recovery-codes", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(account(login(s.RegenerateRecoveryCodes))))).Methods("POST")
+
+	r.HandleFunc("/users", middlewares.SetMiddlewareJSON(idem(write(s.CreateUser)))).Methods("POST")
+	r.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.GetUsers)).Methods("GET")
+	r.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(s.GetUser)).Methods("GET")
+	r.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(account(write(s.UpdateUser))))).Methods("PUT")
+	r.HandleFunc("/users/{id}", middlewares.SetMiddlewareAuthentication(account(write(s.DeleteUser)))).Methods("DELETE")
+
+	r.HandleFunc("/authors", middlewares.SetMiddlewareJSON(authors(idem(write(s.CreateAuthor))))).Methods("POST")
+	r.HandleFunc("/authors", middlewares.SetMiddlewareJSON(s.GetAuthors)).Methods("GET")
+	r.HandleFunc("/authors:batch", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(authors(idem(write(s.BatchAuthors)))))).Methods("POST")
+	r.HandleFunc("/authors/{id}", middlewares.SetMiddlewareJSON(s.GetAuthor)).Methods("GET")
+	r.HandleFunc("/authors/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(authors(write(s.UpdateAuthor))))).Methods("PUT")
+	r.HandleFunc("/authors/{id}", middlewares.SetMiddlewareAuthentication(authors(write(s.DeleteAuthor)))).Methods("DELETE")
+
+	r.HandleFunc("/books", middlewares.SetMiddlewareJSON(books(idem(write(s.CreateBook))))).Methods("POST")
+	r.HandleFunc("/books", middlewares.SetMiddlewareJSON(s.GetBooks)).Methods("GET")
+	r.HandleFunc("/books:batch", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(books(idem(write(s.BatchBooks)))))).Methods("POST")
+	r.HandleFunc("/books/{id}", middlewares.SetMiddlewareJSON(s.GetBook)).Methods("GET")
+	r.HandleFunc("/books/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(books(write(s.UpdateBook))))).Methods("PUT")
+	r.HandleFunc("/books/{id}", middlewares.SetMiddlewareAuthentication(books(write(s.DeleteBook)))).Methods("DELETE")
+	r.HandleFunc("/books/{id}/download", middlewares.SetMiddlewareAuthentication(s.DownloadBook)).Methods("GET", "HEAD")
+	r.HandleFunc("/books/{id}/download-url", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateDownloadURL))).Methods("POST")
+
+	r.HandleFunc("/api-keys", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(account(write(s.CreateAPIKey))))).Methods("POST")
+	r.HandleFunc("/api-keys", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(account(s.GetAPIKeys)))).Methods("GET")
+	r.HandleFunc("/api-keys/{id}", middlewares.SetMiddlewareAuthentication(account(write(s.DeleteAPIKey)))).Methods("DELETE")
+
+	admin := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	if s.config.Auth.AdminRequiresMFA {
+		admin = middlewares.SetMiddlewareRequireMFA
+	}
+	webhooks := func(next http.HandlerFunc) http.HandlerFunc {
+		return middlewares.SetMiddlewareAuthentication(middlewares.SetMiddlewareScope(auth.ScopeWebhooksWrite)(admin(next)))
+	}
+	r.HandleFunc("/webhooks", middlewares.SetMiddlewareJSON(webhooks(write(s.CreateWebhook)))).Methods("POST")
+	r.HandleFunc("/webhooks", middlewares.SetMiddlewareJSON(webhooks(s.GetWebhooks))).Methods("GET")
+	r.HandleFunc("/webhooks/{id}", middlewares.SetMiddlewareJSON(webhooks(s.GetWebhook))).Methods("GET")
+	r.HandleFunc("/webhooks/{id}", middlewares.SetMiddlewareJSON(webhooks(write(s.UpdateWebhook)))).Methods("PUT")
+	r.HandleFunc("/webhooks/{id}", webhooks(write(s.DeleteWebhook))).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id}/deliveries", middlewares.SetMiddlewareJSON(webhooks(s.GetWebhookDeliveries))).Methods("GET")
+	r.HandleFunc("/webhooks/{id}/deliveries/{delivery}/redeliver", middlewares.SetMiddlewareJSON(webhooks(write(s.RedeliverWebhook)))).Methods("POST")
+	r.HandleFunc("/audit", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(middlewares.SetMiddlewareScope(auth.ScopeAuditRead)(admin(s.GetAuditLogs))))).Methods("GET")
 }
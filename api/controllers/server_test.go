@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/config"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/models"
+)
+
+func init() {
+	logger.SetLevel(logger.ErrorLevel + 1)
+	auth.Configure("secret used by the tests only", time.Hour)
+}
+
+// newTestServer returns a server on an empty SQLite database with the
+// default configuration, changed by configure.
+func newTestServer(t *testing.T, configure ...func(cfg *config.Config)) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Database.Driver = config.SQLite
+	cfg.Database.Name = filepath.Join(t.TempDir(), "test.db")
+	// The tests send more than a person would
+	cfg.RateLimit.LoginPerIP = 1000
+	cfg.RateLimit.LoginPerAccount = 1000
+	cfg.RateLimit.WritePerIP = 1000
+	cfg.RateLimit.WritePerUser = 1000
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	server := &Server{}
+	server.Initialize(&cfg)
+	if server.migrationErr != nil {
+		t.Fatalf("migrate: %v", server.migrationErr)
+	}
+	t.Cleanup(func() { server.DB.Close() })
+	return server
+}
+
+// createUser stores a user with a verified email and returns it.
+func createUser(t *testing.T, server *Server, nickname, email, password string, admin bool) *models.User {
+	t.Helper()
+	verified := time.Now()
+	user := &models.User{Nickname: nickname, Email: email, Password: password, IsAdmin: admin, EmailVerifiedAt: &verified}
+	if err := server.DB.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// tokenFor returns an access token of user.
+func tokenFor(t *testing.T, user *models.User) string {
+	t.Helper()
+	token, err := auth.CreateToken(user.ID, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// do sends a request to server with body, if not nil, as JSON and returns
+// the response. headers alternate names and values.
+func do(server *Server, method, target string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		if raw, ok := body.(string); ok {
+			buf.WriteString(raw)
+		} else {
+			json.NewEncoder(&buf).Encode(body)
+		}
+	}
+	r := httptest.NewRequest(method, target, &buf)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	server.Router.ServeHTTP(w, r)
+	return w
+}
+
+// bearer returns the Authorization header value for token.
+func bearer(token string) string {
+	return "Bearer " + token
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("status = %d, want %d: %s", w.Code, want, w.Body.String())
+	}
+}
@@ -1,62 +1,43 @@
 package controllers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/dto"
 	"github.com/serg2013/reading/api/models"
 	"github.com/serg2013/reading/api/responses"
-	"github.com/serg2013/reading/api/utils/formaterror"
 )
 
 func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-	}
-	user := models.User{}
-	err = json.Unmarshal(body, &user)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	user.Prepare()
-	err = user.Validate("")
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	req := dto.UserRequest{}
+	if !server.decodeJSON(w, r, &req) {
 		return
 	}
-	userCreated, err := user.SaveUser(server.DB)
-
+	userCreated, status, err := server.createUser(r, req)
 	if err != nil {
-
-		formattedError := formaterror.FormatError(err.Error())
-
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		userError(w, status, err)
 		return
 	}
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, userCreated.ID))
-	responses.JSON(w, http.StatusCreated, userCreated)
+	responses.JSON(w, http.StatusCreated, dto.NewUserResponse(userCreated, userCreated.ID))
 }
 
 // Response to GET "/users" request
 func (server *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
 
-	user := models.User{}
-
-	users, err := user.FindAllUsers(server.DB)
+	users, err := server.service(r).ListUsers(models.Query{})
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, users)
+	responses.JSON(w, http.StatusOK, dto.NewUserResponses(*users, viewerID(r)))
 }
 
 func (server *Server) GetUser(w http.ResponseWriter, r *http.Request) {
@@ -67,13 +48,12 @@ func (server *Server) GetUser(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	user := models.User{}
-	userGotten, err := user.FindUserByID(server.DB, uint32(uid))
+	userGotten, err := server.service(r).GetUser(uint32(uid))
 	if err != nil {
-		responses.ERROR(w, http.StatusBadRequest, err)
+		serviceError(w, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, userGotten)
+	responses.JSON(w, http.StatusOK, dto.NewUserResponse(userGotten, viewerID(r)))
 }
 
 func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -84,66 +64,112 @@ func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	req := dto.UserRequest{}
+	if !server.decodeJSON(w, r, &req) {
 		return
 	}
-	user := models.User{}
-	err = json.Unmarshal(body, &user)
+	updatedUser, status, err := server.updateUser(r, uint32(uid), req)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		userError(w, status, err)
 		return
 	}
-	tokenID, err := auth.ExtractTokenID(r)
+	responses.JSON(w, http.StatusOK, dto.NewUserResponse(updatedUser, updatedUser.ID))
+}
+
+func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	if tokenID != uint32(uid) {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+	status, err := server.deleteUser(r, uint32(uid))
+	if err != nil {
+		userError(w, status, err)
 		return
 	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", uid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// The user operations below are shared by the REST and gRPC APIs. Like
+// the batch operations they return the status of a failure, or 0 for an
+// error of the service layer.
+
+// createUser signs up the user req describes.
+func (server *Server) createUser(r *http.Request, req dto.UserRequest) (*models.User, int, error) {
+	user := req.Model()
 	user.Prepare()
-	err = user.Validate("update")
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+	if err := user.Validate(""); err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	if err := server.passwords.Check(user.Password, user.Email, user.Nickname); err != nil {
+		return nil, http.StatusUnprocessableEntity, err
 	}
-	updatedUser, err := user.UpdateAUser(server.DB, uint32(uid))
+	created, err := server.service(r).CreateUser(&user)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
-		return
+		return nil, 0, err
 	}
-	responses.JSON(w, http.StatusOK, updatedUser)
+	server.startEmailVerification(r, created.ID)
+	return created, http.StatusCreated, nil
 }
 
-func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
-
-	vars := mux.Vars(r)
-
-	user := models.User{}
-
-	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+// updateUser replaces the profile of user uid, who must be the one making
+// r.
+func (server *Server) updateUser(r *http.Request, uid uint32, req dto.UserRequest) (*models.User, int, error) {
+	user := req.Model()
+	tokenID, err := auth.ExtractTokenID(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusBadRequest, err)
-		return
+		return nil, http.StatusUnauthorized, errors.New("Unauthorized")
 	}
-	tokenID, err := auth.ExtractTokenID(r)
+	if tokenID != uid {
+		return nil, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized))
+	}
+	user.Prepare()
+	if err := user.Validate("update"); err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	if err := server.passwords.Check(user.Password, user.Email, user.Nickname); err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	current, err := server.service(r).GetUser(uid)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
+		return nil, 0, err
 	}
-	if tokenID != 0 && tokenID != uint32(uid) {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
-		return
+	previousEmail := current.Email
+	updated, err := server.service(r).UpdateUser(uid, &user)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !strings.EqualFold(previousEmail, updated.Email) {
+		// The new address has to be verified
+		server.startEmailVerification(r, updated.ID)
 	}
-	_, err = user.DeleteAUser(server.DB, uint32(uid))
+	return updated, http.StatusOK, nil
+}
+
+// deleteUser deletes user uid, who must be the one making r.
+func (server *Server) deleteUser(r *http.Request, uid uint32) (int, error) {
+	tokenID, err := auth.ExtractTokenID(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		return http.StatusUnauthorized, errors.New("Unauthorized")
+	}
+	if tokenID != 0 && tokenID != uid {
+		return http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized))
+	}
+	if err := server.service(r).DeleteUser(uid); err != nil {
+		return 0, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// userError writes the response for a failed user operation.
+func userError(w http.ResponseWriter, status int, err error) {
+	if status == 0 {
+		serviceError(w, err)
 		return
 	}
-	w.Header().Set("Entity", fmt.Sprintf("%d", uid))
-	responses.JSON(w, http.StatusNoContent, "")
+	responses.ERROR(w, status, err)
 }
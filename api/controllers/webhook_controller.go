@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/serg2013/reading/api/dto"
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// CreateWebhook subscribes a URL to events
+// @Summary Creates a webhook
+// @Description Subscribes a URL to changes of books, authors and users. Each event is POSTed to it as JSON, signed in the X-Webhook-Signature header with the secret: "t=<unix time>,v1=<hex HMAC-SHA256 of the time, a dot and the body>". Failed deliveries are retried with exponential backoff. The secret is in this reply only. Admins only.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body dto.WebhookRequest true "URL, events and optional secret"
+// @Success 201 {object} dto.WebhookResponse
+// @Router /v1/webhooks [post]
+func (server *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	uid, ok := server.adminID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := server.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	hook, secret, err := server.service(r).CreateWebhook(uid, req.URL, req.Secret, req.Events)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	resp := dto.NewWebhookResponse(hook)
+	resp.Secret = secret
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, hook.ID))
+	responses.JSON(w, http.StatusCreated, resp)
+}
+
+// GetWebhooks lists the webhooks
+// @Summary Lists webhooks
+// @Description Lists the webhook subscriptions, without their secrets. Admins only.
+// @Tags Webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} dto.WebhookResponse
+// @Router /v1/webhooks [get]
+func (server *Server) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	if _, ok := server.adminID(w, r); !ok {
+		return
+	}
+	hooks, err := server.service(r).ListWebhooks()
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, dto.NewWebhookResponses(*hooks))
+}
+
+// GetWebhook shows a webhook
+// @Summary Gets a webhook
+// @Description Admins only.
+// @Tags Webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} dto.WebhookResponse
+// @Router /v1/webhooks/{id} [get]
+func (server *Server) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, ok := server.adminID(w, r); !ok {
+		return
+	}
+	hook, err := server.service(r).GetWebhook(uint32(id))
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, dto.NewWebhookResponse(hook))
+}
+
+// UpdateWebhook changes a webhook
+// @Summary Updates a webhook
+// @Description Replaces the URL and events of a webhook, and its secret if one is given. Queued events go to the new URL. Admins only.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Param data body dto.WebhookRequest true "URL, events and optional secret"
+// @Success 200 {object} dto.WebhookResponse
+// @Router /v1/webhooks/{id} [put]
+func (server *Server) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, ok := server.adminID(w, r); !ok {
+		return
+	}
+	req, ok := server.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	hook, err := server.service(r).UpdateWebhook(uint32(id), req.URL, req.Secret, req.Events)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, dto.NewWebhookResponse(hook))
+}
+
+// DeleteWebhook removes a webhook
+// @Summary Deletes a webhook
+// @Description Deletes a webhook together with its delivery history. Events not delivered yet are dropped. Admins only.
+// @Tags Webhooks
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Success 204
+// @Router /v1/webhooks/{id} [delete]
+func (server *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, ok := server.adminID(w, r); !ok {
+		return
+	}
+	if err := server.service(r).DeleteWebhook(uint32(id)); err != nil {
+		serviceError(w, err)
+		return
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", id))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// GetWebhookDeliveries lists the deliveries of a webhook
+// @Summary Lists webhook deliveries
+// @Description Lists the latest 100 deliveries of a webhook, newest first: pending ones with the time of their next attempt, delivered ones, and dead ones, which ran out of attempts and are only sent again when redelivered. Admins only.
+// @Tags Webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Param status query string false "pending, delivered or dead"
+// @Success 200 {array} models.WebhookDelivery
+// @Router /v1/webhooks/{id}/deliveries [get]
+func (server *Server) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, ok := server.adminID(w, r); !ok {
+		return
+	}
+	filter := models.DeliveryFilter{Status: r.URL.Query().Get("status")}
+	switch filter.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid status, expected pending, delivered or dead"))
+		return
+	}
+	deliveries, err := server.service(r).ListWebhookDeliveries(uint32(id), filter)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook sends a delivery again
+// @Summary Redelivers a webhook delivery
+// @Description Queues a delivery to be sent again right away with all its attempts, whether it was delivered, is pending or dead. The event keeps its id. Admins only.
+// @Tags Webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Param delivery path string true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Router /v1/webhooks/{id}/deliveries/{delivery}/redeliver [post]
+func (server *Server) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	delivery, err := strconv.ParseUint(vars["delivery"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, ok := server.adminID(w, r); !ok {
+		return
+	}
+	queued, err := server.service(r).RedeliverWebhook(uint32(id), delivery)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+	responses.JSON(w, http.StatusAccepted, queued)
+}
+
+// readWebhook decodes and checks the body of a request creating or
+// changing a webhook.
+func (server *Server) readWebhook(w http.ResponseWriter, r *http.Request) (dto.WebhookRequest, bool) {
+	req := dto.WebhookRequest{}
+	if !server.decodeJSON(w, r, &req) {
+		return req, false
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if err := server.checkWebhookURL(req.URL); err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return req, false
+	}
+	if req.Secret != "" && (len(req.Secret) < 16 || len(req.Secret) > 100) {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Secret must be 16 to 100 characters"))
+		return req, false
+	}
+	if len(req.Events) == 0 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Events"))
+		return req, false
+	}
+	for _, e := range req.Events {
+		if !models.IsWebhookEvent(e) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("Unknown event %q, expected one of %s", e, strings.Join(models.WebhookEvents, ", ")))
+			return req, false
+		}
+	}
+	return req, true
+}
+
+// checkWebhookURL refuses URLs the events cannot be POSTed to, and those
+// without TLS unless allowed.
+func (server *Server) checkWebhookURL(raw string) error {
+	if raw == "" || len(raw) > 2048 {
+		return errors.New("Required URL of at most 2048 characters")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return errors.New("Invalid URL")
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && server.config.Webhooks.AllowHTTP:
+	default:
+		return errors.New("URL must use https")
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package dto
+
+// PasswordResetRequest is the body of POST /auth/password-reset.
+type PasswordResetRequest struct {
+	Email string `json:"email" example:"reader@example.com"`
+}
+
+// PasswordResetConfirmation is the body of POST /auth/password-reset/confirm.
+type PasswordResetConfirmation struct {
+	Token    string `json:"token"`
+	Password string `json:"password" example:"correct horse battery staple"`
+}
+
+// EmailVerification is the body of POST /auth/verify-email.
+type EmailVerification struct {
+	Token string `json:"token"`
+}
@@ -0,0 +1,48 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/serg2013/reading/api/models"
+)
+
+// APIKeyRequest is the body of POST /api-keys. Without ExpiresAt the key
+// expires after the configured default lifetime.
+type APIKeyRequest struct {
+	Name      string     `json:"name" example:"catalog import"`
+	Scopes    []string   `json:"scopes" example:"books:write"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyResponse describes an API key. Key is only set in the reply to
+// its creation.
+type APIKeyResponse struct {
+	ID         uint32     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func NewAPIKeyResponse(k *models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.ScopeList(),
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+func NewAPIKeyResponses(keys []models.APIKey) []APIKeyResponse {
+	resp := make([]APIKeyResponse, len(keys))
+	for i := range keys {
+		resp[i] = NewAPIKeyResponse(&keys[i])
+	}
+	return resp
+}
@@ -0,0 +1,63 @@
+package dto
+
+import "github.com/serg2013/reading/api/models"
+
+// AuthorRequest is the body of POST /authors and PUT /authors/{id}.
+// FirstBook is only read on create, where the author and the book are
+// stored together.
+type AuthorRequest struct {
+	Name      string       `json:"name" example:"Leo"`
+	Lastname  string       `json:"lastname" example:"Tolstoy"`
+	Email     string       `json:"email" example:"leo@example.com"`
+	FirstBook *BookRequest `json:"first_book,omitempty"`
+}
+
+// Model returns the author the request describes.
+func (req AuthorRequest) Model() models.Author {
+	return models.Author{
+		Name:     req.Name,
+		Lastname: req.Lastname,
+		Email:    req.Email,
+	}
+}
+
+// AuthorResponse is an author as returned by the API. Email is only filled
+// in for the author's own profile.
+type AuthorResponse struct {
+	ID        uint32        `json:"id"`
+	Name      string        `json:"name"`
+	Lastname  string        `json:"lastname"`
+	Email     string        `json:"email,omitempty"`
+	FirstBook *BookResponse `json:"first_book,omitempty"`
+	// Books is only set when asked for with ?include=books, and then
+	// also when empty.
+	Books *[]BookResponse `json:"books,omitempty"`
+}
+
+// NewAuthorResponse returns a as seen by the user with ID viewer, 0 for an
+// anonymous client. Authors share their ID with the user account that
+// manages them.
+func NewAuthorResponse(a *models.Author, viewer uint32) AuthorResponse {
+	resp := AuthorResponse{
+		ID:       a.ID,
+		Name:     a.Name,
+		Lastname: a.Lastname,
+	}
+	if viewer != 0 && viewer == a.ID {
+		resp.Email = a.Email
+	}
+	if a.Books != nil {
+		books := NewBookResponses(a.Books, viewer)
+		resp.Books = &books
+	}
+	return resp
+}
+
+// NewAuthorResponses converts a list of authors for viewer.
+func NewAuthorResponses(authors []models.Author, viewer uint32) []AuthorResponse {
+	resp := make([]AuthorResponse, len(authors))
+	for i := range authors {
+		resp[i] = NewAuthorResponse(&authors[i], viewer)
+	}
+	return resp
+}
@@ -0,0 +1,60 @@
+package dto
+
+// Operations of a batch request.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// BookBatchRequest is the body of POST /books:batch.
+type BookBatchRequest struct {
+	// Atomic applies every operation or, if one fails, none of them.
+	// Otherwise each operation is applied on its own.
+	Atomic     bool            `json:"atomic"`
+	Operations []BookOperation `json:"operations"`
+}
+
+// BookOperation creates a book, or updates or deletes book ID.
+type BookOperation struct {
+	Op   string       `json:"op" enums:"create,update,delete" example:"create"`
+	ID   uint64       `json:"id,omitempty"`
+	Book *BookRequest `json:"book,omitempty"`
+}
+
+// AuthorBatchRequest is the body of POST /authors:batch.
+type AuthorBatchRequest struct {
+	// Atomic applies every operation or, if one fails, none of them.
+	// Otherwise each operation is applied on its own.
+	Atomic     bool              `json:"atomic"`
+	Operations []AuthorOperation `json:"operations"`
+}
+
+// AuthorOperation creates an author, or updates or deletes author ID.
+type AuthorOperation struct {
+	Op     string         `json:"op" enums:"create,update,delete" example:"update"`
+	ID     uint32         `json:"id,omitempty"`
+	Author *AuthorRequest `json:"author,omitempty"`
+}
+
+// BatchResult is the outcome of one operation, in the order they were
+// sent. Status is the HTTP status the operation would have had on its own;
+// in an atomic batch that failed, the operations that were rolled back or
+// not tried have 424 Failed Dependency.
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BookBatchResult is the outcome of one operation on books.
+type BookBatchResult struct {
+	BatchResult
+	Book *BookResponse `json:"book,omitempty"`
+}
+
+// AuthorBatchResult is the outcome of one operation on authors.
+type AuthorBatchResult struct {
+	BatchResult
+	Author *AuthorResponse `json:"author,omitempty"`
+}
@@ -0,0 +1,64 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/serg2013/reading/api/models"
+)
+
+// BookRequest is the body of POST /books and PUT /books/{id}.
+type BookRequest struct {
+	Title    string `json:"title" example:"War and Peace"`
+	Content  string `json:"content" example:"Well, Prince, so Genoa and Lucca are now just family estates"`
+	AuthorID uint32 `json:"author_id" example:"1"`
+}
+
+// Model returns the book the request describes.
+func (req BookRequest) Model() models.Book {
+	return models.Book{
+		Title:    req.Title,
+		Content:  req.Content,
+		AuthorID: req.AuthorID,
+	}
+}
+
+// BookResponse is a book as returned by the API, with its author when it
+// was loaded.
+type BookResponse struct {
+	ID       uint32          `json:"id"`
+	Title    string          `json:"title"`
+	Content  string          `json:"content"`
+	AuthorID uint32          `json:"author_id"`
+	Author   *AuthorResponse `json:"author,omitempty"`
+}
+
+// NewBookResponse returns b as seen by the user with ID viewer.
+func NewBookResponse(b *models.Book, viewer uint32) BookResponse {
+	resp := BookResponse{
+		ID:       b.ID,
+		Title:    b.Title,
+		Content:  b.Content,
+		AuthorID: b.AuthorID,
+	}
+	if b.Author.ID != 0 {
+		author := NewAuthorResponse(&b.Author, viewer)
+		resp.Author = &author
+	}
+	return resp
+}
+
+// NewBookResponses converts a list of books for viewer.
+func NewBookResponses(books []models.Book, viewer uint32) []BookResponse {
+	resp := make([]BookResponse, len(books))
+	for i := range books {
+		resp[i] = NewBookResponse(&books[i], viewer)
+	}
+	return resp
+}
+
+// DownloadURL is a link to download a book without an access token.
+type DownloadURL struct {
+	// URL is relative to the API, to be fetched with GET before ExpiresAt.
+	URL       string    `json:"url" example:"/books/1/download?expires=1700000000&sig=...&uid=1"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
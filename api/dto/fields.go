@@ -0,0 +1,132 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Resource types, as named in ?fields[type]= and the tables they are
+// read from.
+const (
+	TypeBooks   = "books"
+	TypeAuthors = "authors"
+)
+
+// Fields lists the fields of each resource type a client can ask for.
+var Fields = map[string][]string{
+	TypeBooks:   {"id", "title", "content", "author_id"},
+	TypeAuthors: {"id", "name", "lastname", "email"},
+}
+
+// Relations maps the relations of each resource type, as named in
+// ?include=, to the type of the related resources.
+var Relations = map[string]map[string]string{
+	TypeBooks:   {"author": TypeAuthors},
+	TypeAuthors: {"books": TypeBooks},
+}
+
+// relationKeys maps the JSON keys holding related resources to their type.
+var relationKeys = map[string]string{
+	"author":     TypeAuthors,
+	"books":      TypeBooks,
+	"first_book": TypeBooks,
+}
+
+// CheckFields returns an error unless every field in fields is one of
+// its type's.
+func CheckFields(fields map[string][]string) error {
+	for typ, names := range fields {
+		known, ok := Fields[typ]
+		if !ok {
+			return fmt.Errorf("Unknown type %q in fields, expected one of %s", typ, strings.Join(typeNames(), ", "))
+		}
+		for _, name := range names {
+			if !contains(known, name) {
+				return fmt.Errorf("Unknown field %q of %s, expected one of %s", name, typ, strings.Join(known, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// CheckInclude returns an error unless every relation in include is one
+// of typ's.
+func CheckInclude(typ string, include []string) error {
+	for _, rel := range include {
+		if _, ok := Relations[typ][rel]; !ok {
+			return fmt.Errorf("Unknown include %q for %s, expected one of %s", rel, typ, strings.Join(relationNames(typ), ", "))
+		}
+	}
+	return nil
+}
+
+// Sparse returns v, a response of type typ or a list of them, with only
+// the fields asked for in fields. Related resources are kept and shaped by
+// the fields of their own type. Without fields v is returned as it is.
+func Sparse(v interface{}, typ string, fields map[string][]string) (interface{}, error) {
+	if len(fields) == 0 {
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return sparse(out, typ, fields), nil
+}
+
+func sparse(v interface{}, typ string, fields map[string][]string) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = sparse(v[i], typ, fields)
+		}
+	case map[string]interface{}:
+		wanted, limited := fields[typ]
+		for key, value := range v {
+			if relType, ok := relationKeys[key]; ok {
+				v[key] = sparse(value, relType, fields)
+				continue
+			}
+			if limited && !contains(wanted, key) {
+				delete(v, key)
+			}
+		}
+	}
+	return v
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func typeNames() []string {
+	var names []string
+	for typ := range Fields {
+		names = append(names, typ)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func relationNames(typ string) []string {
+	var names []string
+	for rel := range Relations[typ] {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+	return names
+}
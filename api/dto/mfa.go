@@ -0,0 +1,33 @@
+package dto
+
+// LoginChallenge is the reply to POST /login for a user with two-factor
+// login: Challenge and a code go to POST /login/mfa.
+type LoginChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	Challenge   string `json:"challenge"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// MFALogin is the body of POST /login/mfa. Code is the current code from
+// the authenticator app or a recovery code.
+type MFALogin struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code" example:"123456"`
+}
+
+// MFACode is the body of the two-factor endpoints that need a code.
+type MFACode struct {
+	Code string `json:"code" example:"123456"`
+}
+
+// TOTPEnrollment is the reply to POST /auth/totp/enroll. URI is meant to
+// be shown as a QR code; Secret is for typing in by hand.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes are shown once, when they are created.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
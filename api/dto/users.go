@@ -0,0 +1,67 @@
+// Package dto holds the request and response bodies of the HTTP API, so
+// what clients may send and see is decided here rather than by the model
+// structs stored in the database.
+package dto
+
+import (
+	"time"
+
+	"github.com/serg2013/reading/api/models"
+)
+
+// UserRequest is the body of POST /users and PUT /users/{id}. The password
+// is write-only: no response ever contains it.
+type UserRequest struct {
+	Nickname string `json:"nickname" example:"reader"`
+	Email    string `json:"email" example:"reader@example.com"`
+	Password string `json:"password" example:"password"`
+}
+
+// Model returns the user the request describes.
+func (req UserRequest) Model() models.User {
+	return models.User{
+		Nickname: req.Nickname,
+		Email:    req.Email,
+		Password: req.Password,
+	}
+}
+
+// UserResponse is a user as returned by the API. Email and the account
+// settings are only filled in for the user's own profile.
+type UserResponse struct {
+	ID            uint32    `json:"id"`
+	Nickname      string    `json:"nickname"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified,omitempty"`
+	TOTPEnabled   bool      `json:"totp_enabled,omitempty"`
+	IsAdmin       bool      `json:"is_admin,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NewUserResponse returns u as seen by the user with ID viewer, 0 for an
+// anonymous client.
+func NewUserResponse(u *models.User, viewer uint32) UserResponse {
+	resp := UserResponse{
+		ID:        u.ID,
+		Nickname:  u.Nickname,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+	if viewer != 0 && viewer == u.ID {
+		resp.Email = u.Email
+		resp.EmailVerified = u.EmailVerifiedAt != nil
+		resp.TOTPEnabled = u.TOTPEnabled
+		resp.IsAdmin = u.IsAdmin
+	}
+	return resp
+}
+
+// NewUserResponses converts a list of users for viewer.
+func NewUserResponses(users []models.User, viewer uint32) []UserResponse {
+	resp := make([]UserResponse, len(users))
+	for i := range users {
+		resp[i] = NewUserResponse(&users[i], viewer)
+	}
+	return resp
+}
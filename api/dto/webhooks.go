@@ -0,0 +1,46 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/serg2013/reading/api/models"
+)
+
+// WebhookRequest is the body of POST /webhooks and PUT /webhooks/{id}.
+// Without Secret one is generated on creation, and kept on update.
+type WebhookRequest struct {
+	URL    string   `json:"url" example:"https://search.example.com/hooks/reading"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events" example:"book.created"`
+}
+
+// WebhookResponse describes a webhook subscription. Secret is only set in
+// the reply to its creation.
+type WebhookResponse struct {
+	ID        uint32    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedBy uint32    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+func NewWebhookResponse(w *models.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    w.EventList(),
+		CreatedBy: w.CreatedBy,
+		CreatedAt: w.CreatedAt,
+		UpdatedAt: w.UpdatedAt,
+	}
+}
+
+func NewWebhookResponses(hooks []models.Webhook) []WebhookResponse {
+	resp := make([]WebhookResponse, len(hooks))
+	for i := range hooks {
+		resp[i] = NewWebhookResponse(&hooks[i])
+	}
+	return resp
+}
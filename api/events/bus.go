@@ -0,0 +1,46 @@
+// Package events hands the domain events of the outbox, see
+// models.OutboxEvent, to the subscribers in this process.
+//
+// Delivery is at least once: an event is pending until every subscriber
+// handled it, and is handed to all of them again if one fails or the
+// server stops first. Subscribers must therefore tolerate duplicates. The
+// events of one aggregate, such as book 7, are handled in the order they
+// happened; a failing event holds back only the later events of its
+// aggregate.
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/serg2013/reading/api/models"
+)
+
+// Handler handles an event. An error makes the event be retried later.
+type Handler func(ctx context.Context, e *models.OutboxEvent) error
+
+// Bus lists the subscribers. They are registered before the dispatcher
+// starts.
+type Bus struct {
+	subscribers []subscriber
+}
+
+type subscriber struct {
+	name   string
+	handle Handler
+}
+
+// Subscribe has h handle every event. name tells the subscriber in errors.
+func (b *Bus) Subscribe(name string, h Handler) {
+	b.subscribers = append(b.subscribers, subscriber{name: name, handle: h})
+}
+
+// publish hands e to every subscriber and returns the first error.
+func (b *Bus) publish(ctx context.Context, e *models.OutboxEvent) error {
+	for _, s := range b.subscribers {
+		if err := s.handle(ctx, e); err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+	return nil
+}
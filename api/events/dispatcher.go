@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/models"
+)
+
+const (
+	// batchSize is how many aggregates one round dispatches an event of.
+	batchSize = 100
+	// claimTTL bounds how long the subscribers may take for an event.
+	// Afterwards it is due again, also for other servers.
+	claimTTL = time.Minute
+	// cleanupInterval is how often dispatched events are pruned.
+	cleanupInterval = time.Hour
+)
+
+// Dispatcher hands pending events to the subscribers of Bus. Several
+// servers may run one on the same database: each event is claimed by one
+// of them at a time, and a restarted server picks up where it stopped.
+type Dispatcher struct {
+	DB  *gorm.DB
+	Bus *Bus
+	// PollInterval is how often pending events are looked for.
+	PollInterval time.Duration
+	// A failed event is retried after MinBackoff, doubling per attempt up
+	// to MaxBackoff, for as long as it takes.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long dispatched events are kept.
+	Retention time.Duration
+}
+
+// Run dispatches pending events until ctx ends. An event cut short by that
+// is dispatched again once its claim runs out.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	var cleaned time.Time
+	for {
+		if err := d.dispatchPending(ctx); err != nil && ctx.Err() == nil {
+			logger.Error(ctx, "cannot dispatch events", logger.Fields{"error": err})
+		}
+		if time.Since(cleaned) >= cleanupInterval {
+			cleaned = time.Now()
+			d.cleanup(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchPending dispatches the due events until none is left whose
+// aggregate has no earlier event failing.
+func (d *Dispatcher) dispatchPending(ctx context.Context) error {
+	for ctx.Err() == nil {
+		dispatched, err := d.dispatchDue(ctx)
+		if err != nil || dispatched == 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatchDue dispatches the earliest pending event of up to batchSize
+// aggregates, if due, and returns how many succeeded. Those aggregates'
+// next events are due in the next round.
+func (d *Dispatcher) dispatchDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	due, err := (&models.OutboxEvent{}).FindDueEvents(d.DB, now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	dispatched := 0
+	for i := range *due {
+		if ctx.Err() != nil {
+			return dispatched, nil
+		}
+		e := &(*due)[i]
+		claimed, err := e.ClaimEvent(d.DB, now, time.Now().Add(claimTTL))
+		if err != nil {
+			return dispatched, err
+		}
+		if !claimed {
+			continue
+		}
+		ok, err := d.dispatch(ctx, e)
+		if err != nil {
+			return dispatched, err
+		}
+		if ok {
+			dispatched++
+		}
+	}
+	return dispatched, nil
+}
+
+// dispatch hands e to the subscribers, records how it went and reports
+// whether all of them handled it.
+func (d *Dispatcher) dispatch(ctx context.Context, e *models.OutboxEvent) (bool, error) {
+	hctx, cancel := context.WithTimeout(ctx, claimTTL)
+	defer cancel()
+	err := d.Bus.publish(hctx, e)
+	if ctx.Err() != nil {
+		return false, nil
+	}
+	now := time.Now()
+	e.Attempts++
+	if err == nil {
+		e.DispatchedAt = &now
+		e.LastError = ""
+	} else {
+		e.NextAttemptAt = now.Add(d.backoff(e.Attempts))
+		e.LastError = err.Error()
+		logger.Warn(ctx, "event dispatch failed", logger.Fields{
+			"event_id": e.ID,
+			"type":     e.Type,
+			"attempt":  e.Attempts,
+			"retry_at": e.NextAttemptAt,
+			"error":    err,
+		})
+	}
+	return err == nil, e.RecordDispatch(d.DB)
+}
+
+// cleanup deletes the events dispatched longer than Retention ago.
+func (d *Dispatcher) cleanup(ctx context.Context) {
+	n, err := (&models.OutboxEvent{}).DeleteDispatchedEvents(d.DB, time.Now().Add(-d.Retention))
+	if err != nil {
+		logger.Error(ctx, "cannot delete dispatched events", logger.Fields{"error": err})
+		return
+	}
+	if n > 0 {
+		logger.Info(ctx, "deleted dispatched events", logger.Fields{"count": n})
+	}
+}
+
+// backoff returns how long to wait after the attempt-th failure, with up
+// to a tenth more, so that events failing together spread out.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.MinBackoff
+	for i := 1; i < attempt && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.MaxBackoff {
+		wait = d.MaxBackoff
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait)/10+1))
+}
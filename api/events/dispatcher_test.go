@@ -0,0 +1,109 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/models"
+)
+
+func init() {
+	logger.SetLevel(logger.ErrorLevel + 1)
+}
+
+// newTestDispatcher returns a dispatcher on an empty SQLite database, with
+// bus as subscribers.
+func newTestDispatcher(t *testing.T, bus *Bus) *Dispatcher {
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return &Dispatcher{DB: db, Bus: bus, MinBackoff: time.Minute, MaxBackoff: time.Hour}
+}
+
+// queue stores n events of book id.
+func queue(t *testing.T, db *gorm.DB, id uint32, n int) {
+	t.Helper()
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		e := models.OutboxEvent{Type: models.BookUpdated, AggregateType: "book", AggregateID: id, Payload: "{}", CreatedAt: now, NextAttemptAt: now}
+		if err := db.Create(&e).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDispatchKeepsTheOrderOfAnAggregate(t *testing.T) {
+	bus := &Bus{}
+	var handled []uint64
+	bus.Subscribe("test", func(ctx context.Context, e *models.OutboxEvent) error {
+		handled = append(handled, e.ID)
+		return nil
+	})
+	d := newTestDispatcher(t, bus)
+	queue(t, d.DB, 1, 3)
+	queue(t, d.DB, 2, 2)
+	queue(t, d.DB, 1, 1)
+
+	if err := d.dispatchPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 6 {
+		t.Fatalf("handled %v, want all 6 events", handled)
+	}
+	// Book 1 has events 1, 2, 3 and 6
+	last := map[bool]uint64{}
+	for _, id := range handled {
+		book1 := id <= 3 || id == 6
+		if id < last[book1] {
+			t.Errorf("handled %v, out of order for one book", handled)
+		}
+		last[book1] = id
+	}
+}
+
+func TestFailingAggregateHoldsBackOnlyItself(t *testing.T) {
+	bus := &Bus{}
+	handled := map[uint32]int{}
+	bus.Subscribe("test", func(ctx context.Context, e *models.OutboxEvent) error {
+		handled[e.AggregateID]++
+		if e.AggregateID == 1 {
+			return errors.New("book 1 cannot be handled")
+		}
+		return nil
+	})
+	d := newTestDispatcher(t, bus)
+	// More events stuck behind the failing one than a round looks at
+	queue(t, d.DB, 1, 2*batchSize)
+	queue(t, d.DB, 2, 3)
+
+	if err := d.dispatchPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if handled[1] != 1 {
+		t.Errorf("book 1 handled %d times, want its first event tried once", handled[1])
+	}
+	if handled[2] != 3 {
+		t.Errorf("book 2 handled %d times, want all 3 events", handled[2])
+	}
+	var pending int
+	d.DB.Model(&models.OutboxEvent{}).Where("dispatched_at IS NULL").Count(&pending)
+	if pending != 2*batchSize {
+		t.Errorf("%d events pending, want the %d of book 1", pending, 2*batchSize)
+	}
+	first := models.OutboxEvent{}
+	d.DB.Order("id").First(&first)
+	if first.Attempts != 1 || first.LastError == "" || !first.NextAttemptAt.After(time.Now()) {
+		t.Errorf("failed event = %+v, want retried later", first)
+	}
+}
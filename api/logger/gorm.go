@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GormLogger adapts the logger to gorm's SetLogger. Queries are logged at
+// debug level without their bound values, so no user data or password hash
+// ends up in the logs; errors are logged as warnings.
+type GormLogger struct {
+	ctx context.Context
+}
+
+// Gorm returns a gorm logger that tags every entry with the request ID in ctx.
+func Gorm(ctx context.Context) GormLogger {
+	return GormLogger{ctx: ctx}
+}
+
+func (g GormLogger) Print(values ...interface{}) {
+	if len(values) < 2 {
+		return
+	}
+	source := fmt.Sprint(values[1])
+	switch values[0] {
+	case "sql":
+		if len(values) < 6 || !std.Enabled(DebugLevel) {
+			return
+		}
+		duration, _ := values[2].(time.Duration)
+		Debug(g.ctx, "query", Fields{
+			"source":      source,
+			"duration_ms": float64(duration.Nanoseconds()) / 1e6,
+			"sql":         values[3],
+			"rows":        values[5],
+		})
+	default:
+		Warn(g.ctx, "database", Fields{
+			"source": source,
+			"error":  fmt.Sprint(values[2:]...),
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel converts a level name such as "info" into a Level.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return DebugLevel, nil
+	case "", "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q", s)
+}
+
+// Fields are the structured attributes attached to a log line.
+type Fields map[string]interface{}
+
+// Logger writes one JSON object per line. Entries below its level are
+// dropped and sensitive fields are redacted.
+type Logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level Level
+}
+
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{out: out, level: level}
+}
+
+var std = New(os.Stderr, InfoLevel)
+
+// Default returns the logger used by the package level functions.
+func Default() *Logger {
+	return std
+}
+
+// SetLevel changes the minimum level of the default logger.
+func SetLevel(level Level) {
+	std.mu.Lock()
+	std.level = level
+	std.mu.Unlock()
+}
+
+// Enabled reports whether entries at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level
+}
+
+// Log writes msg with fields. The request ID carried by ctx, if any, is
+// added to the entry.
+func (l *Logger) Log(ctx context.Context, level Level, msg string, fields Fields) {
+	if !l.Enabled(level) {
+		return
+	}
+	entry := make(map[string]interface{}, len(fields)+4)
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = redact(k, v)
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+	if id := RequestID(ctx); id != "" {
+		entry["request_id"] = id
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"level": "error", "msg": "cannot encode log entry", "error": err.Error()})
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+func Debug(ctx context.Context, msg string, fields Fields) {
+	std.Log(ctx, DebugLevel, msg, fields)
+}
+
+func Info(ctx context.Context, msg string, fields Fields) {
+	std.Log(ctx, InfoLevel, msg, fields)
+}
+
+func Warn(ctx context.Context, msg string, fields Fields) {
+	std.Log(ctx, WarnLevel, msg, fields)
+}
+
+func Error(ctx context.Context, msg string, fields Fields) {
+	std.Log(ctx, ErrorLevel, msg, fields)
+}
+
+// Fatal logs at error level and exits the process.
+func Fatal(ctx context.Context, msg string, fields Fields) {
+	std.Log(ctx, ErrorLevel, msg, fields)
+	os.Exit(1)
+}
+
+var sensitive = []string{"password", "secret", "token", "authorization", "api_key", "apikey"}
+
+// redact hides the value of fields whose name suggests a credential.
+func redact(key string, v interface{}) interface{} {
+	k := strings.ToLower(key)
+	for _, s := range sensitive {
+		if strings.Contains(k, s) {
+			return "[redacted]"
+		}
+	}
+	return v
+}
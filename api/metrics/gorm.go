@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const startKey = "metrics:start"
+
+// RegisterGormCallbacks times every create, query, update and delete made
+// through db and counts the ones that fail.
+func RegisterGormCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+	cb.Create().Before("gorm:begin_transaction").Register("metrics:before_create", startTimer)
+	cb.Create().Register("metrics:after_create", observe("create"))
+	cb.Query().Before("gorm:query").Register("metrics:before_query", startTimer)
+	cb.Query().Register("metrics:after_query", observe("query"))
+	cb.RowQuery().Before("gorm:row_query").Register("metrics:before_row_query", startTimer)
+	cb.RowQuery().Register("metrics:after_row_query", observe("row_query"))
+	cb.Update().Before("gorm:assign_updating_attributes").Register("metrics:before_update", startTimer)
+	cb.Update().Register("metrics:after_update", observe("update"))
+	cb.Delete().Before("gorm:begin_transaction").Register("metrics:before_delete", startTimer)
+	cb.Delete().Register("metrics:after_delete", observe("delete"))
+}
+
+func startTimer(scope *gorm.Scope) {
+	scope.InstanceSet(startKey, time.Now())
+}
+
+func observe(operation string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		if v, ok := scope.InstanceGet(startKey); ok {
+			if start, ok := v.(time.Time); ok {
+				DBQueryDuration.Observe(time.Since(start).Seconds(), operation)
+			}
+		}
+		if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			DBQueryErrors.Inc(operation)
+		}
+	}
+}
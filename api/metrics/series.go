@@ -0,0 +1,21 @@
+package metrics
+
+// The series exported on /metrics.
+var (
+	HTTPRequests = NewCounterVec("reading_http_requests_total",
+		"HTTP requests by route template and status.", "route", "status")
+	HTTPDuration = NewHistogramVec("reading_http_request_duration_seconds",
+		"HTTP request latency by route template and status.", DefBuckets, "route", "status")
+	HTTPInFlight = NewGauge("reading_http_requests_in_flight",
+		"HTTP requests currently being served.")
+
+	DBQueryDuration = NewHistogramVec("reading_db_query_duration_seconds",
+		"Database operation latency by operation.", DefBuckets, "operation")
+	DBQueryErrors = NewCounterVec("reading_db_query_errors_total",
+		"Failed database operations by operation.", "operation")
+
+	Logins = NewCounterVec("reading_auth_logins_total",
+		"Login attempts by result: success, failure, or challenge when the password was right and a second factor is asked for.", "result")
+	TokenValidationFailures = NewCounterVec("reading_auth_token_validation_failures_total",
+		"Rejected access tokens by reason.", "reason")
+)
@@ -0,0 +1,98 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/logger"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// SetMiddlewareRequestID gives every request an ID, reusing a well-formed
+// X-Request-ID sent by the client. The ID is echoed in the response and
+// stored in the request context for logging.
+func SetMiddlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := RequestID(r.Header.Get(requestIDHeader))
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), id)))
+	})
+}
+
+// SetMiddlewareAccessLog writes one log entry per request with its status,
+// latency and the authenticated user, if any.
+func SetMiddlewareAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		fields := logger.Fields{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     rec.status,
+			"bytes":      rec.bytes,
+			"latency_ms": float64(time.Since(start).Nanoseconds()) / 1e6,
+			"remote":     r.RemoteAddr,
+		}
+		if uid, err := auth.ExtractTokenID(r); err == nil && uid != 0 {
+			fields["user_id"] = uid
+		}
+		level := logger.InfoLevel
+		if rec.status >= http.StatusInternalServerError {
+			level = logger.ErrorLevel
+		}
+		logger.Default().Log(r.Context(), level, "request", fields)
+	})
+}
+
+// statusRecorder remembers the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// RequestID returns id if it is a well-formed request ID sent by a
+// client, or else a new one.
+func RequestID(id string) string {
+	if validRequestID(id) {
+		return id
+	}
+	return newRequestID()
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
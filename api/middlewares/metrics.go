@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/serg2013/reading/api/metrics"
+)
+
+// SetMiddlewareMetrics records the count and latency of requests labelled
+// by the router's route template, so /books/1 and /books/2 share a series,
+// and status. The method is left out: clients choose it freely, and every
+// new one would add series.
+func SetMiddlewareMetrics(router *mux.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			metrics.HTTPInFlight.Inc()
+			defer metrics.HTTPInFlight.Dec()
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			route := "unmatched"
+			var match mux.RouteMatch
+			if router.Match(r, &match) && match.Route != nil {
+				if tpl, err := match.Route.GetPathTemplate(); err == nil {
+					route = tpl
+				}
+			}
+			status := strconv.Itoa(rec.status)
+			metrics.HTTPRequests.Inc(route, status)
+			metrics.HTTPDuration.Observe(time.Since(start).Seconds(), route, status)
+		})
+	}
+}
@@ -2,7 +2,11 @@ package middlewares
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	"github.com/serg2013/reading/api/auth"
 	"github.com/serg2013/reading/api/responses"
@@ -11,11 +15,6 @@ import (
 func SetMiddlewareJSON(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, PATCH, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "allowedHeaders")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Expose-Headers", "Authorization")
 		next(w, r)
 	}
 }
@@ -30,3 +29,73 @@ func SetMiddlewareAuthentication(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// SetMiddlewareRequireMFA only lets through access tokens issued after a
+// second factor. Wrap it inside SetMiddlewareAuthentication.
+func SetMiddlewareRequireMFA(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.HasAMR(r, auth.AMRMFA) {
+			responses.ERROR(w, http.StatusForbidden, errors.New("Two-factor authentication required"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// SetMiddlewareScope refuses signed in requests not allowed to act within
+// scope. Access tokens from a login have every scope; API keys only those
+// they were given. Requests without valid credentials are left to
+// SetMiddlewareAuthentication or the handler.
+func SetMiddlewareScope(scope string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if p, err := auth.Authenticate(r); err == nil && !p.HasScope(scope) {
+				responses.ERROR(w, http.StatusForbidden, fmt.Errorf("Scope %s required", scope))
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// SetMiddlewareNoAPIKey refuses API keys and signed URLs, for account
+// settings that need a real login. Wrap it inside SetMiddlewareAuthentication.
+func SetMiddlewareNoAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, err := auth.Authenticate(r); err != nil || p.APIKeyID != 0 || p.Signed {
+			responses.ERROR(w, http.StatusForbidden, errors.New("Not allowed with an API key"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// SetMiddlewarePrincipalCache makes the request remember who it
+// authenticated as, so credentials are checked once per request. It goes
+// outside every handler that asks.
+func SetMiddlewarePrincipalCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, auth.WithPrincipalCache(r))
+	})
+}
+
+// SetMiddlewareDeprecation announces that the routes it wraps are going
+// away: since when in a Deprecation header (RFC 9745), when they stop
+// working in a Sunset header (RFC 8594), and, when successor is set, the
+// same path under that prefix in a Link header. Zero times are left out.
+func SetMiddlewareDeprecation(since, sunset time.Time, successor string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !since.IsZero() {
+				w.Header().Set("Deprecation", fmt.Sprintf("@%d", since.Unix()))
+			}
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			if successor != "" {
+				w.Header().Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successor, r.URL.Path))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/ratelimit"
+	"github.com/serg2013/reading/api/responses"
+)
+
+// SetMiddlewareRateLimit rejects requests over the limiter's rules with
+// 429 Too Many Requests. Every response carries the RateLimit-* headers.
+func SetMiddlewareRateLimit(limiter *ratelimit.Limiter) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			res, err := limiter.Allow(r)
+			if err != nil {
+				// Fail open: a broken limiter store must not take the API down.
+				logger.Error(r.Context(), "rate limiter unavailable", logger.Fields{"error": err})
+				next(w, r)
+				return
+			}
+			SetRateLimitHeaders(w, res)
+			if !res.Allowed {
+				TooManyRequests(w, res.RetryAfter)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// SetRateLimitHeaders describes the client's quota.
+func SetRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+// TooManyRequests writes a 429 asking the client to wait retryAfter.
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	responses.ERROR(w, http.StatusTooManyRequests, errors.New(http.StatusText(http.StatusTooManyRequests)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// APIKey is a personal credential for scripts and integrations. The key
+// itself is shown once; only its prefix, to find it, and a hash are kept.
+type APIKey struct {
+	ID         uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint32     `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null;unique_index" json:"prefix"`
+	Hash       string     `gorm:"size:64;not null" json:"-"`
+	Scopes     string     `gorm:"size:255;not null" json:"scopes"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// lastUsedResolution keeps every request from writing to the key's row.
+const lastUsedResolution = time.Minute
+
+// ScopeList returns the key's scopes.
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// newAPIKey returns a key of the form <keyPrefix><id>_<secret> and its
+// lookup prefix <id>.
+func newAPIKey(keyPrefix string) (string, string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix := hex.EncodeToString(id)
+	return keyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// SaveAPIKey creates the key described by k, starting with keyPrefix, and
+// returns it. It cannot be retrieved later.
+func (k *APIKey) SaveAPIKey(db *gorm.DB, keyPrefix string) (string, error) {
+	key, prefix, err := newAPIKey(keyPrefix)
+	if err != nil {
+		return "", err
+	}
+	k.Prefix = prefix
+	k.Hash = hashToken(key)
+	k.CreatedAt = time.Now()
+	err = Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(k).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, AuditCreate, "api_key", k.ID, nil, k)
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// FindAPIKeys returns the keys of user uid, newest first.
+func (k *APIKey) FindAPIKeys(db *gorm.DB, uid uint32) (*[]APIKey, error) {
+	keys := []APIKey{}
+	err := db.Model(&APIKey{}).Where("user_id = ?", uid).Order("id desc").Find(&keys).Error
+	if err != nil {
+		return &[]APIKey{}, err
+	}
+	return &keys, nil
+}
+
+// CountAPIKeys returns how many keys user uid has.
+func (k *APIKey) CountAPIKeys(db *gorm.DB, uid uint32) (int, error) {
+	var count int
+	err := db.Model(&APIKey{}).Where("user_id = ?", uid).Count(&count).Error
+	return count, err
+}
+
+// DeleteAPIKey revokes key id of user uid.
+func (k *APIKey) DeleteAPIKey(db *gorm.DB, id, uid uint32) error {
+	return Transaction(db, func(tx *gorm.DB) error {
+		before := APIKey{}
+		err := tx.Model(&APIKey{}).Where("id = ? AND user_id = ?", id, uid).Take(&before).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("id = ?", id).Delete(&APIKey{}).Error
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, AuditDelete, "api_key", id, &before, nil)
+	})
+}
+
+// CheckAPIKey returns the stored key matching key, after keyPrefix, and
+// notes that it was used. It returns gorm.ErrRecordNotFound for unknown
+// keys, and expired ones are returned for the caller to refuse.
+func (k *APIKey) CheckAPIKey(db *gorm.DB, keyPrefix, key string) (*APIKey, error) {
+	rest := strings.TrimPrefix(key, keyPrefix)
+	i := strings.IndexByte(rest, '_')
+	if i <= 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := APIKey{}
+	err := db.Model(&APIKey{}).Where("prefix = ?", rest[:i]).Take(&found).Error
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(found.Hash), []byte(hashToken(key))) != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	now := time.Now()
+	if found.LastUsedAt == nil || now.Sub(*found.LastUsedAt) > lastUsedResolution {
+		err = db.Model(&APIKey{}).Where("id = ?", found.ID).UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
+		found.LastUsedAt = &now
+	}
+	return &found, nil
+}
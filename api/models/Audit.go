@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+const auditMetaKey = "reading:audit_meta"
+
+// AuditLog records a single create, update or delete of a user, author or book.
+type AuditLog struct {
+	ID           uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	ActorID      uint32    `gorm:"index" json:"actor_id"`
+	Action       string    `gorm:"size:20;not null" json:"action"`
+	ResourceType string    `gorm:"size:50;not null;index" json:"resource_type"`
+	ResourceID   uint32    `json:"resource_id"`
+	Diff         RawJSON   `gorm:"type:text" json:"diff" swaggertype:"object"`
+	RequestID    string    `gorm:"size:100" json:"request_id"`
+	IP           string    `gorm:"size:45" json:"ip"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP;index" json:"created_at"`
+}
+
+// RawJSON is a JSON document stored as text and emitted as-is.
+type RawJSON string
+
+func (j RawJSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// AuditMeta identifies who made a change and from where.
+type AuditMeta struct {
+	ActorID   uint32
+	RequestID string
+	IP        string
+}
+
+// AuditFilter narrows down FindAuditLogs. Zero values match everything.
+type AuditFilter struct {
+	ResourceType string
+	ActorID      uint32
+	Since        time.Time
+	// Before and Limit page back through the log, newest first: entries
+	// older than the one with ID Before, at most Limit of them, or 100
+	// when 0.
+	Before uint64
+	Limit  int
+}
+
+// WithAudit attaches meta to db. Every change made through the returned
+// handle is recorded with it.
+func WithAudit(db *gorm.DB, meta AuditMeta) *gorm.DB {
+	return db.Set(auditMetaKey, meta)
+}
+
+// auditMeta returns the meta WithAudit attached to tx, if any.
+func auditMeta(tx *gorm.DB) AuditMeta {
+	meta := AuditMeta{}
+	if v, ok := tx.Get(auditMetaKey); ok {
+		meta, _ = v.(AuditMeta)
+	}
+	return meta
+}
+
+// recordAudit stores an audit entry for a change. It must be called with
+// the transaction that made the change so both are committed together.
+func recordAudit(tx *gorm.DB, action, resource string, id uint32, before, after interface{}) error {
+	meta := auditMeta(tx)
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	entry := AuditLog{
+		ActorID:      meta.ActorID,
+		Action:       action,
+		ResourceType: resource,
+		ResourceID:   id,
+		Diff:         diff,
+		RequestID:    meta.RequestID,
+		IP:           meta.IP,
+		CreatedAt:    time.Now(),
+	}
+	return tx.New().Create(&entry).Error
+}
+
+// auditDiff returns the fields that differ between before and after as
+// {"field": {"before": ..., "after": ...}}. Either side may be nil.
+func auditDiff(before, after interface{}) (RawJSON, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return "", err
+	}
+	a, err := auditFields(after)
+	if err != nil {
+		return "", err
+	}
+	diff := map[string]map[string]interface{}{}
+	for k, v := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(v, av) {
+			diff[k] = map[string]interface{}{"before": redact(k, v), "after": redact(k, a[k])}
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = map[string]interface{}{"before": nil, "after": redact(k, v)}
+		}
+	}
+	out, err := json.Marshal(diff)
+	if err != nil {
+		return "", err
+	}
+	return RawJSON(out), nil
+}
+
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if v == nil {
+		return fields, nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	// Associations such as Book.Author are audited on their own.
+	for k, v := range fields {
+		if _, ok := v.(map[string]interface{}); ok {
+			delete(fields, k)
+		}
+	}
+	return fields, nil
+}
+
+// redact hides the value of sensitive fields while still recording that they
+// changed. Password hashes never end up in the audit trail.
+func redact(field string, v interface{}) interface{} {
+	if field == "password" && v != nil {
+		return "[redacted]"
+	}
+	return v
+}
+
+func (l *AuditLog) FindAuditLogs(db *gorm.DB, filter AuditFilter) (*[]AuditLog, error) {
+	var err error
+	logs := []AuditLog{}
+	q := db.Model(&AuditLog{})
+	if filter.ResourceType != "" {
+		q = q.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ActorID != 0 {
+		q = q.Where("actor_id = ?", filter.ActorID)
+	}
+	if !filter.Since.IsZero() {
+		q = q.Where("created_at >= ?", filter.Since)
+	}
+	if filter.Before != 0 {
+		q = q.Where("id < ?", filter.Before)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	err = q.Order("id desc").Limit(limit).Find(&logs).Error
+	if err != nil {
+		return &[]AuditLog{}, err
+	}
+	return &logs, nil
+}
@@ -14,6 +14,8 @@ type Author struct {
 	Name     string `gorm:"size:255;not null;unique" json:"name"`
 	Lastname string `gorm:"size:255;not null;unique" json:"lastname"`
 	Email    string `gorm:"size:100;not null;unique" json:"email"`
+	// Books is only filled in when a Query includes them.
+	Books []Book `gorm:"-" json:"books,omitempty"`
 }
 
 func (a *Author) Prepare() {
@@ -58,64 +60,139 @@ func (a *Author) Validate(action string) error {
 }
 
 func (a *Author) SaveAuthor(db *gorm.DB) (*Author, error) {
-	var err error
-	err = db.Debug().Create(&a).Error
+	err := Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(&a).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, AuditCreate, "author", a.ID, nil, a); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditCreate, "author", a.ID, a)
+	})
 	if err != nil {
 		return &Author{}, err
 	}
 	return a, nil
 }
 
-func (a *Author) FindAllAuthors(db *gorm.DB) (*[]Author, error) {
-	var err error
+// FindAllAuthors returns a page of authors shaped by q, which may include
+// their "books".
+func (a *Author) FindAllAuthors(db *gorm.DB, q Query) (*[]Author, error) {
 	authors := []Author{}
-	err = db.Debug().Model(&Author{}).Limit(100).Find(&authors).Error
+	err := q.page(q.selectColumns(db.Model(&Author{}), "authors", "id")).Find(&authors).Error
 	if err != nil {
 		return &[]Author{}, err
 	}
-	return &authors, err
+	if q.Include["books"] {
+		if err := loadAuthorBooks(db, authors, q); err != nil {
+			return &[]Author{}, err
+		}
+	}
+	return &authors, nil
 }
 
-func (a *Author) FindAuthorByID(db *gorm.DB, uid uint32) (*Author, error) {
-	var err error
-	err = db.Debug().Model(Author{}).Where("id = ?", uid).Take(&a).Error
+// FindAuthorByID returns author uid shaped by q, which may include their
+// "books".
+func (a *Author) FindAuthorByID(db *gorm.DB, uid uint32, q Query) (*Author, error) {
+	err := q.selectColumns(db.Model(&Author{}), "authors", "id").Where("id = ?", uid).Take(&a).Error
 	if err != nil {
 		return &Author{}, err
 	}
-	if gorm.IsRecordNotFoundError(err) {
-		return &Author{}, errors.New("User Not Found")
+	if q.Include["books"] {
+		authors := []Author{*a}
+		if err := loadAuthorBooks(db, authors, q); err != nil {
+			return &Author{}, err
+		}
+		*a = authors[0]
 	}
-	return a, err
+	return a, nil
 }
 
-func (a *Author) UpdateAuthor(db *gorm.DB, uid uint32) (*Author, error) {
-	db = db.Debug().Model(&Author{}).Where("id = ?", uid).Take(&Author{}).UpdateColumns(
-		map[string]interface{}{
-			"name":     a.Name,
-			"lastname": a.Lastname,
-			"email":    a.Email,
-		},
-	)
-	if db.Error != nil {
-		return &Author{}, db.Error
+// FindAuthorsByIDs returns the authors with the given IDs by ID, shaped by
+// q, with one query. IDs without an author are left out.
+func (a *Author) FindAuthorsByIDs(db *gorm.DB, ids []uint32, q Query) (map[uint32]Author, error) {
+	byID := make(map[uint32]Author, len(ids))
+	if len(ids) == 0 {
+		return byID, nil
+	}
+	authors := []Author{}
+	err := q.selectColumns(db.Model(&Author{}), "authors", "id").Where("id IN (?)", ids).Find(&authors).Error
+	if err != nil {
+		return byID, err
+	}
+	for _, found := range authors {
+		byID[found.ID] = found
 	}
-	// This is the display the updated user
-	err := db.Debug().Model(&Author{}).Where("id = ?", uid).Take(&a).Error
+	return byID, nil
+}
+
+func (a *Author) UpdateAuthor(db *gorm.DB, uid uint32) (*Author, error) {
+	err := Transaction(db, func(tx *gorm.DB) error {
+		before := Author{}
+		err := tx.Model(&Author{}).Where("id = ?", uid).Take(&before).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Author{}).Where("id = ?", uid).UpdateColumns(
+			map[string]interface{}{
+				"name":     a.Name,
+				"lastname": a.Lastname,
+				"email":    a.Email,
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+		// This is the display the updated user
+		err = tx.Model(&Author{}).Where("id = ?", uid).Take(&a).Error
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, AuditUpdate, "author", uid, &before, a); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditUpdate, "author", uid, a)
+	})
 	if err != nil {
 		return &Author{}, err
 	}
 	return a, nil
 }
 
+// DeleteAuthor deletes author uid together with their books.
 func (a *Author) DeleteAuthor(db *gorm.DB, uid uint32) (int64, error) {
 
-	db = db.Debug().Model(&Author{}).Where("id = ?", uid).Take(&Author{}).Delete(&Author{})
-
-	if db.Error != nil {
-		if gorm.IsRecordNotFoundError(db.Error) {
-			return 0, errors.New("Author not found")
+	var rows int64
+	err := Transaction(db, func(tx *gorm.DB) error {
+		before := Author{}
+		err := tx.Model(&Author{}).Where("id = ?", uid).Take(&before).Error
+		if err != nil {
+			return err
+		}
+		// The books go one by one through DeleteABook rather than by
+		// cascade, so each of them is audited too.
+		books := []Book{}
+		err = tx.Model(&Book{}).Where("author_id = ?", uid).Order("id").Find(&books).Error
+		if err != nil {
+			return err
+		}
+		for _, book := range books {
+			if _, err := book.DeleteABook(tx, uint64(book.ID), uid); err != nil {
+				return err
+			}
 		}
-		return 0, db.Error
+		del := tx.Model(&Author{}).Where("id = ?", uid).Delete(&Author{})
+		if del.Error != nil {
+			return del.Error
+		}
+		rows = del.RowsAffected
+		if err := recordAudit(tx, AuditDelete, "author", uid, &before, nil); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditDelete, "author", uid, &before)
+	})
+	if err != nil {
+		return 0, err
 	}
-	return db.RowsAffected, nil
+	return rows, nil
 }
@@ -13,7 +13,7 @@ type Book struct {
 	Title    string `gorm:"size:255;not null;unique" json:"title"`
 	Content  string `gorm:"size:255;not null;" json:"content"`
 	Author   Author `json:"author"`
-	AuthorID uint32 `sql:"type:int REFERENCES authors(id) ON UPDATE CASCADE ON DELETE CASCADE" json:"author_id"`
+	AuthorID uint32 `gorm:"not null;index" json:"author_id"`
 }
 
 func (b *Book) Prepare() {
@@ -38,62 +38,94 @@ func (b *Book) Validate() error {
 }
 
 func (b *Book) SaveBook(db *gorm.DB) (*Book, error) {
-	var err error
-	err = db.Debug().Model(&Book{}).Create(&b).Error
-	if err != nil {
-		return &Book{}, err
-	}
-	if b.ID != 0 {
-		err = db.Debug().Model(&Book{}).Where("id = ?", b.AuthorID).Take(&b.Author).Error
+	err := Transaction(db, func(tx *gorm.DB) error {
+		err := tx.Model(&Book{}).Create(&b).Error
 		if err != nil {
-			return &Book{}, err
+			return err
 		}
+		err = tx.Model(&Author{}).Where("id = ?", b.AuthorID).Take(&b.Author).Error
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, AuditCreate, "book", b.ID, nil, b); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditCreate, "book", b.ID, b)
+	})
+	if err != nil {
+		return &Book{}, err
 	}
 	return b, nil
 }
 
-func (b *Book) FindAllBooks(db *gorm.DB) (*[]Book, error) {
-	var err error
+// FindAllBooks returns a page of books shaped by q, which may include
+// their "author".
+func (b *Book) FindAllBooks(db *gorm.DB, q Query) (*[]Book, error) {
 	books := []Book{}
-	err = db.Debug().Model(&Book{}).Limit(100).Find(&books).Error
+	required := []string{"id"}
+	if q.Include["author"] {
+		required = append(required, "author_id")
+	}
+	err := q.page(q.selectColumns(db.Model(&Book{}), "books", required...)).Find(&books).Error
 	if err != nil {
 		return &[]Book{}, err
 	}
-	if len(books) > 0 {
-		for i, _ := range books {
-			err := db.Debug().Model(&Author{}).Where("id = ?", books[i].AuthorID).Take(&books[i].Author).Error
-			if err != nil {
-				return &[]Book{}, err
-			}
+	if q.Include["author"] {
+		if err := loadBookAuthors(db, books, q); err != nil {
+			return &[]Book{}, err
 		}
 	}
 	return &books, nil
 }
 
-func (b *Book) FindBookByID(db *gorm.DB, pid uint64) (*Book, error) {
-	var err error
-	err = db.Debug().Model(&Book{}).Where("id = ?", pid).Take(&b).Error
+// FindBookByID returns book pid shaped by q, which may include its
+// "author".
+func (b *Book) FindBookByID(db *gorm.DB, pid uint64, q Query) (*Book, error) {
+	required := []string{"id"}
+	if q.Include["author"] {
+		required = append(required, "author_id")
+	}
+	err := q.selectColumns(db.Model(&Book{}), "books", required...).Where("id = ?", pid).Take(&b).Error
 	if err != nil {
 		return &Book{}, err
 	}
-	if b.ID != 0 {
-		err = db.Debug().Model(&Author{}).Where("id = ?", b.AuthorID).Take(&b.Author).Error
-		if err != nil {
+	if q.Include["author"] {
+		books := []Book{*b}
+		if err := loadBookAuthors(db, books, q); err != nil {
 			return &Book{}, err
 		}
+		*b = books[0]
 	}
 	return b, nil
 }
 
+// FindBooksByAuthorIDs returns the books of the given authors by author
+// ID, in ID order and shaped by q, with one query.
+func (b *Book) FindBooksByAuthorIDs(db *gorm.DB, ids []uint32, q Query) (map[uint32][]Book, error) {
+	byAuthor := make(map[uint32][]Book, len(ids))
+	if len(ids) == 0 {
+		return byAuthor, nil
+	}
+	books := []Book{}
+	err := q.selectColumns(db.Model(&Book{}), "books", "id", "author_id").Where("author_id IN (?)", ids).Order("id").Find(&books).Error
+	if err != nil {
+		return byAuthor, err
+	}
+	for _, found := range books {
+		byAuthor[found.AuthorID] = append(byAuthor[found.AuthorID], found)
+	}
+	return byAuthor, nil
+}
+
 func (b *Book) Book(db *gorm.DB) (*Book, error) {
 
 	var err error
-	err = db.Debug().Model(&Book{}).Where("id = ?", b.ID).Updates(Book{Title: b.Title, Content: b.Content}).Error
+	err = db.Model(&Book{}).Where("id = ?", b.ID).Updates(Book{Title: b.Title, Content: b.Content}).Error
 	if err != nil {
 		return &Book{}, err
 	}
 	if b.ID != 0 {
-		err = db.Debug().Model(&Book{}).Where("id = ?", b.AuthorID).Take(&b.Author).Error
+		err = db.Model(&Book{}).Where("id = ?", b.AuthorID).Take(&b.Author).Error
 		if err != nil {
 			return &Book{}, err
 		}
@@ -103,47 +135,62 @@ func (b *Book) Book(db *gorm.DB) (*Book, error) {
 
 func (b *Book) UpdateABook(db *gorm.DB) (*Book, error) {
 
-	var err error
-	db = db.Debug().Model(&Book{}).Where("id = ?", b.ID).Take(&Book{}).UpdateColumns(
-		map[string]interface{}{
-			"title":     b.Title,
-			"content":   b.Content,
-			"author":    b.Author,
-			"author_id": b.AuthorID,
-		},
-	)
-	err = db.Debug().Model(&Book{}).Where("id = ?", b.ID).Take(&b).Error
-	if err != nil {
-		return &Book{}, err
-	}
-	if b.ID != 0 {
-		err = db.Debug().Model(&Book{}).Where("id = ?", b.AuthorID).Take(&b.Author).Error
+	err := Transaction(db, func(tx *gorm.DB) error {
+		before := Book{}
+		err := tx.Model(&Book{}).Where("id = ?", b.ID).Take(&before).Error
 		if err != nil {
-			return &Book{}, err
+			return err
 		}
-	}
-	err = db.Debug().Model(&Book{}).Where("id = ?", b.ID).Updates(Book{Title: b.Title, Content: b.Content, Author: b.Author, AuthorID: b.AuthorID}).Error
-	if err != nil {
-		return &Book{}, err
-	}
-	if b.ID != 0 {
-		err = db.Debug().Model(&Book{}).Where("id = ?", b.AuthorID).Take(&b.Author).Error
+		err = tx.Model(&Book{}).Where("id = ?", b.ID).UpdateColumns(
+			map[string]interface{}{
+				"title":     b.Title,
+				"content":   b.Content,
+				"author_id": b.AuthorID,
+			},
+		).Error
 		if err != nil {
-			return &Book{}, err
+			return err
 		}
+		err = tx.Model(&Book{}).Where("id = ?", b.ID).Take(&b).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Author{}).Where("id = ?", b.AuthorID).Take(&b.Author).Error
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, AuditUpdate, "book", b.ID, &before, b); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditUpdate, "book", b.ID, b)
+	})
+	if err != nil {
+		return &Book{}, err
 	}
 	return b, nil
 }
 
 func (b *Book) DeleteABook(db *gorm.DB, pid uint64, uid uint32) (int64, error) {
 
-	db = db.Debug().Model(&Book{}).Where("id = ? and author_id = ?", pid, uid).Take(&Book{}).Delete(&Book{})
-
-	if db.Error != nil {
-		if gorm.IsRecordNotFoundError(db.Error) {
-			return 0, errors.New("Book not found")
+	var rows int64
+	err := Transaction(db, func(tx *gorm.DB) error {
+		before := Book{}
+		err := tx.Model(&Book{}).Where("id = ? and author_id = ?", pid, uid).Take(&before).Error
+		if err != nil {
+			return err
 		}
-		return 0, db.Error
+		del := tx.Model(&Book{}).Where("id = ? and author_id = ?", pid, uid).Delete(&Book{})
+		if del.Error != nil {
+			return del.Error
+		}
+		rows = del.RowsAffected
+		if err := recordAudit(tx, AuditDelete, "book", before.ID, &before, nil); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditDelete, "book", before.ID, &before)
+	})
+	if err != nil {
+		return 0, err
 	}
-	return db.RowsAffected, nil
+	return rows, nil
 }
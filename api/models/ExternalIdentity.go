@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ExternalIdentity links a user to an account at an OpenID Connect
+// provider, identified by the provider's issuer and subject.
+type ExternalIdentity struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	Issuer    string    `gorm:"size:255;not null;unique_index:idx_external_identity" json:"issuer"`
+	Subject   string    `gorm:"size:255;not null;unique_index:idx_external_identity" json:"subject"`
+	Email     string    `gorm:"size:100;not null" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FindExternalIdentity returns the link for subject at issuer.
+func FindExternalIdentity(db *gorm.DB, issuer, subject string) (*ExternalIdentity, error) {
+	identity := ExternalIdentity{}
+	err := db.Model(&ExternalIdentity{}).Where("issuer = ? AND subject = ?", issuer, subject).Take(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// SaveExternalIdentity stores the link and records it in the audit log.
+func (e *ExternalIdentity) SaveExternalIdentity(db *gorm.DB) error {
+	return Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(e).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, AuditCreate, "external_identity", e.ID, nil, e)
+	})
+}
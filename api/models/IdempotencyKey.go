@@ -0,0 +1,113 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header, so a retry gets the same response instead of
+// repeating the request. Keys belong to the user who sent them. Anonymous
+// requests have user 0 and their keys belong to the client, so one caller
+// cannot replay or block the requests of another.
+type IdempotencyKey struct {
+	ID     uint64 `gorm:"primary_key;auto_increment" json:"id"`
+	UserID uint32 `gorm:"not null;unique_index:idx_idempotency_owner_key" json:"user_id"`
+	// Client is the address of an anonymous caller, empty for users.
+	Client string `gorm:"size:64;not null;default:'';unique_index:idx_idempotency_owner_key" json:"client"`
+	Key    string `gorm:"column:idempotency_key;size:255;not null;unique_index:idx_idempotency_owner_key" json:"key"`
+	// Fingerprint is a hash of the method, path and body of the request,
+	// to tell a retry from another request reusing the key.
+	Fingerprint string `gorm:"size:64;not null" json:"fingerprint"`
+	// Status is 0 while the first request is still being handled.
+	Status      int    `gorm:"not null" json:"status"`
+	ContentType string `gorm:"size:255" json:"content_type"`
+	Location    string `gorm:"size:2048" json:"location"`
+	Body        string `gorm:"type:text" json:"body"`
+	// LockedUntil is when a request still in progress is taken to have
+	// died, so a retry may take the key over. Attempt counts the takeovers;
+	// the request it no longer matches cannot store or release the key.
+	LockedUntil time.Time `json:"locked_until"`
+	Attempt     int       `gorm:"not null;default:0" json:"attempt"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Done reports whether the response of the first request is stored.
+func (k *IdempotencyKey) Done() bool {
+	return k.Status != 0
+}
+
+// ClaimIdempotencyKey records that user uid, or the anonymous caller at
+// client, is sending the request with fingerprint under key. The key is
+// kept for ttl and locked for lock. If the key is already in use it
+// returns the existing record and false instead, unless that is the same
+// request left in progress past its lock, which is taken over. The unique
+// index decides between two requests racing for the same key.
+func ClaimIdempotencyKey(db *gorm.DB, uid uint32, client, key, fingerprint string, ttl, lock time.Duration) (*IdempotencyKey, bool, error) {
+	now := time.Now()
+	err := db.Where("expires_at < ?", now).Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		return nil, false, err
+	}
+	if uid != 0 {
+		client = ""
+	}
+	claim := IdempotencyKey{
+		UserID:      uid,
+		Client:      client,
+		Key:         key,
+		Fingerprint: fingerprint,
+		LockedUntil: now.Add(lock),
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+	}
+	createErr := db.Create(&claim).Error
+	if createErr == nil {
+		return &claim, true, nil
+	}
+	existing := IdempotencyKey{}
+	err = db.Model(&IdempotencyKey{}).Where("user_id = ? AND client = ? AND idempotency_key = ?", uid, client, key).Take(&existing).Error
+	if gorm.IsRecordNotFoundError(err) {
+		// The insert failed for another reason than the key being taken
+		return nil, false, createErr
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if existing.Done() || existing.Fingerprint != fingerprint || existing.LockedUntil.After(now) {
+		return &existing, false, nil
+	}
+	// Only one of the retries racing for a stale claim matches the attempt
+	res := db.Model(&IdempotencyKey{}).Where("id = ? AND attempt = ? AND status = 0", existing.ID, existing.Attempt).UpdateColumns(map[string]interface{}{
+		"attempt":      existing.Attempt + 1,
+		"locked_until": now.Add(lock),
+	})
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &existing, false, nil
+	}
+	existing.Attempt++
+	existing.LockedUntil = now.Add(lock)
+	return &existing, true, nil
+}
+
+// CompleteIdempotencyKey stores the response to the request that claimed k.
+// Nothing is stored if another request has taken k over since.
+func (k *IdempotencyKey) CompleteIdempotencyKey(db *gorm.DB, status int, contentType, location, body string) error {
+	return db.Model(&IdempotencyKey{}).Where("id = ? AND attempt = ?", k.ID, k.Attempt).UpdateColumns(map[string]interface{}{
+		"status":       status,
+		"content_type": contentType,
+		"location":     location,
+		"body":         body,
+	}).Error
+}
+
+// ReleaseIdempotencyKey forgets k, so the request can be tried again,
+// unless another request has taken k over since.
+func (k *IdempotencyKey) ReleaseIdempotencyKey(db *gorm.DB) error {
+	return db.Where("id = ? AND attempt = ?", k.ID, k.Attempt).Delete(&IdempotencyKey{}).Error
+}
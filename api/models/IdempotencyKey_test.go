@@ -0,0 +1,115 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		db = migrated(t, db)
+		claim := func(uid uint32, client, fingerprint string, lock time.Duration) (*IdempotencyKey, bool) {
+			t.Helper()
+			k, claimed, err := ClaimIdempotencyKey(db, uid, client, "the key", fingerprint, time.Hour, lock)
+			if err != nil {
+				t.Fatalf("ClaimIdempotencyKey: %v", err)
+			}
+			return k, claimed
+		}
+
+		first, claimed := claim(1, "", "request", time.Hour)
+		if !claimed {
+			t.Fatal("a new key was not claimed")
+		}
+		if _, claimed := claim(1, "", "request", time.Hour); claimed {
+			t.Error("a key in progress was claimed again")
+		}
+		if _, claimed := claim(2, "", "request", time.Hour); !claimed {
+			t.Error("the key of another user was not claimed")
+		}
+		// The address only tells anonymous callers apart
+		if _, claimed := claim(1, "192.0.2.2", "request", time.Hour); claimed {
+			t.Error("a user's key was claimed again from another address")
+		}
+		if _, claimed := claim(0, "192.0.2.1", "request", time.Hour); !claimed {
+			t.Error("an anonymous key was not claimed")
+		}
+		if _, claimed := claim(0, "192.0.2.1", "request", time.Hour); claimed {
+			t.Error("an anonymous key was claimed again by the same client")
+		}
+		if _, claimed := claim(0, "192.0.2.2", "another request", time.Hour); !claimed {
+			t.Error("an anonymous key of one client blocked another")
+		}
+		if err := first.CompleteIdempotencyKey(db, 201, "application/json", "", "{}"); err != nil {
+			t.Fatal(err)
+		}
+		if k, claimed := claim(1, "", "request", time.Hour); claimed || !k.Done() || k.Status != 201 {
+			t.Errorf("completed key = %+v, claimed %v, want its response", k, claimed)
+		}
+	})
+}
+
+func TestClaimIdempotencyKeyTakesOverStaleClaims(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		db = migrated(t, db)
+		claim := func(fingerprint string) (*IdempotencyKey, bool) {
+			t.Helper()
+			k, claimed, err := ClaimIdempotencyKey(db, 1, "", "the key", fingerprint, time.Hour, time.Hour)
+			if err != nil {
+				t.Fatalf("ClaimIdempotencyKey: %v", err)
+			}
+			return k, claimed
+		}
+
+		crashed, _ := claim("request")
+		db.Model(&IdempotencyKey{}).Where("id = ?", crashed.ID).UpdateColumn("locked_until", time.Now().Add(-time.Second))
+		if _, claimed := claim("another request"); claimed {
+			t.Error("a stale key was taken over by a different request")
+		}
+		retry, claimed := claim("request")
+		if !claimed || retry.ID != crashed.ID {
+			t.Fatalf("stale key claimed %v by %+v, want it taken over", claimed, retry)
+		}
+		if _, claimed := claim("request"); claimed {
+			t.Error("a key just taken over was claimed again")
+		}
+
+		// The first request turning up late changes nothing
+		if err := crashed.CompleteIdempotencyKey(db, 500, "", "", "late"); err != nil {
+			t.Fatal(err)
+		}
+		if err := crashed.ReleaseIdempotencyKey(db); err != nil {
+			t.Fatal(err)
+		}
+		if err := retry.CompleteIdempotencyKey(db, 201, "application/json", "", "{}"); err != nil {
+			t.Fatal(err)
+		}
+		stored := IdempotencyKey{}
+		if err := db.Where("id = ?", retry.ID).Take(&stored).Error; err != nil {
+			t.Fatalf("key gone: %v", err)
+		}
+		if stored.Status != 201 || stored.Body != "{}" {
+			t.Errorf("stored %d %q, want the response of the retry", stored.Status, stored.Body)
+		}
+	})
+}
+
+func TestMigrateReplacesTheIdempotencyIndex(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		db = migrated(t, db)
+		table := db.NewScope(&IdempotencyKey{}).TableName()
+		// As created by older versions
+		if err := db.Model(&IdempotencyKey{}).AddUniqueIndex("idx_idempotency_user_key", "user_id", "idempotency_key").Error; err != nil {
+			t.Fatal(err)
+		}
+		migrated(t, db)
+		if db.Dialect().HasIndex(table, "idx_idempotency_user_key") {
+			t.Error("the old index is still there")
+		}
+		if !db.Dialect().HasIndex(table, "idx_idempotency_owner_key") {
+			t.Error("the new index is missing")
+		}
+	})
+}
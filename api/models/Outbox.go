@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Domain events, named <Aggregate><Action>.
+const (
+	BookCreated   = "BookCreated"
+	BookUpdated   = "BookUpdated"
+	BookDeleted   = "BookDeleted"
+	AuthorCreated = "AuthorCreated"
+	AuthorUpdated = "AuthorUpdated"
+	AuthorDeleted = "AuthorDeleted"
+	UserCreated   = "UserCreated"
+	UserUpdated   = "UserUpdated"
+	UserDeleted   = "UserDeleted"
+)
+
+// domainEvents maps the audited changes of the aggregates to their events.
+var domainEvents = map[string]map[string]string{
+	"book":   {AuditCreate: BookCreated, AuditUpdate: BookUpdated, AuditDelete: BookDeleted},
+	"author": {AuditCreate: AuthorCreated, AuditUpdate: AuthorUpdated, AuditDelete: AuthorDeleted},
+	"user":   {AuditCreate: UserCreated, AuditUpdate: UserUpdated, AuditDelete: UserDeleted},
+}
+
+// OutboxEvent is a domain event, stored in the transaction of the change
+// it reports so that it exists if and only if the change does. It is
+// pending until it was handed to every subscriber, see package events.
+type OutboxEvent struct {
+	ID            uint64 `gorm:"primary_key;auto_increment" json:"id"`
+	Type          string `gorm:"size:50;not null" json:"type"`
+	AggregateType string `gorm:"size:50;not null" json:"aggregate_type"`
+	AggregateID   uint32 `gorm:"not null" json:"aggregate_id"`
+	// Payload is the aggregate after the change, or before a deletion,
+	// without secrets.
+	Payload   RawJSON   `gorm:"type:text;not null" json:"payload" swaggertype:"object"`
+	ActorID   uint32    `json:"actor_id"`
+	RequestID string    `gorm:"size:100" json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `gorm:"size:255" json:"last_error"`
+	DispatchedAt  *time.Time `gorm:"index" json:"dispatched_at"`
+}
+
+// recordEvent stores the event of a change of a book, author or user. v is
+// the aggregate after the change, or before a deletion. It must be called
+// with the transaction that made the change, next to recordAudit.
+func recordEvent(tx *gorm.DB, action, resource string, id uint32, v interface{}) error {
+	typ, ok := domainEvents[resource][action]
+	if !ok {
+		return fmt.Errorf("%s has no %s event", resource, action)
+	}
+	meta := auditMeta(tx)
+	data, err := auditFields(v)
+	if err != nil {
+		return err
+	}
+	delete(data, "password")
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	e := OutboxEvent{
+		Type:          typ,
+		AggregateType: resource,
+		AggregateID:   id,
+		Payload:       RawJSON(payload),
+		ActorID:       meta.ActorID,
+		RequestID:     meta.RequestID,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+	return tx.New().Create(&e).Error
+}
+
+// FindDueEvents returns up to limit events, oldest first, each the
+// earliest event not yet dispatched of its aggregate and due at now. The
+// later events of an aggregate wait until it is dispatched, and do not
+// take the place of the events of other aggregates.
+func (e *OutboxEvent) FindDueEvents(db *gorm.DB, now time.Time, limit int) (*[]OutboxEvent, error) {
+	events := []OutboxEvent{}
+	earliest := db.Model(&OutboxEvent{}).Select("MIN(id)").
+		Where("dispatched_at IS NULL").Group("aggregate_type, aggregate_id").SubQuery()
+	err := db.Model(&OutboxEvent{}).Where("id IN ? AND next_attempt_at <= ?", earliest, now).
+		Order("id").Limit(limit).Find(&events).Error
+	if err != nil {
+		return &[]OutboxEvent{}, err
+	}
+	return &events, nil
+}
+
+// ClaimEvent moves the next attempt of e, due at now, to until unless
+// another server did so first, and reports whether it did.
+func (e *OutboxEvent) ClaimEvent(db *gorm.DB, now, until time.Time) (bool, error) {
+	claim := db.Model(&OutboxEvent{}).
+		Where("id = ? AND dispatched_at IS NULL AND next_attempt_at <= ?", e.ID, now).
+		UpdateColumn("next_attempt_at", until)
+	if claim.Error != nil {
+		return false, claim.Error
+	}
+	return claim.RowsAffected == 1, nil
+}
+
+// RecordDispatch stores the outcome of dispatching e: when it was
+// dispatched, or its attempts, next attempt and last error.
+func (e *OutboxEvent) RecordDispatch(db *gorm.DB) error {
+	if len(e.LastError) > 255 {
+		e.LastError = e.LastError[:255]
+	}
+	return db.Model(&OutboxEvent{}).Where("id = ?", e.ID).UpdateColumns(map[string]interface{}{
+		"attempts":        e.Attempts,
+		"next_attempt_at": e.NextAttemptAt,
+		"last_error":      e.LastError,
+		"dispatched_at":   e.DispatchedAt,
+	}).Error
+}
+
+// DeleteDispatchedEvents deletes the events dispatched before t and
+// returns how many there were.
+func (e *OutboxEvent) DeleteDispatchedEvents(db *gorm.DB, t time.Time) (int64, error) {
+	del := db.Where("dispatched_at < ?", t).Delete(&OutboxEvent{})
+	return del.RowsAffected, del.Error
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestDeleteAuthorQueuesBookDeleted(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		migrated(t, db)
+		authors := []Author{
+			{Name: "Peter", Lastname: "Sidorov", Email: "p.sidorov@example.com"},
+			{Name: "Vasiliy", Lastname: "Rogov", Email: "v.rogov@example.com"},
+		}
+		for i := range authors {
+			if _, err := authors[i].SaveAuthor(db); err != nil {
+				t.Fatal(err)
+			}
+		}
+		books := []Book{
+			{Title: "Book 1", Content: "Plot", AuthorID: authors[0].ID},
+			{Title: "Book 2", Content: "Plot", AuthorID: authors[0].ID},
+			{Title: "Book 3", Content: "Plot", AuthorID: authors[1].ID},
+		}
+		for i := range books {
+			if _, err := books[i].SaveBook(db); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var last uint64
+		if err := db.Model(&OutboxEvent{}).Select("max(id)").Row().Scan(&last); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := (&Author{}).DeleteAuthor(db, authors[0].ID); err != nil {
+			t.Fatalf("DeleteAuthor: %v", err)
+		}
+		events := []OutboxEvent{}
+		if err := db.Where("id > ?", last).Order("id").Find(&events).Error; err != nil {
+			t.Fatal(err)
+		}
+		// The books go first, so no subscriber hears of a book whose
+		// author is already gone
+		want := []struct {
+			typ string
+			id  uint32
+		}{
+			{BookDeleted, uint32(books[0].ID)},
+			{BookDeleted, uint32(books[1].ID)},
+			{AuthorDeleted, authors[0].ID},
+		}
+		if len(events) != len(want) {
+			t.Fatalf("%d events queued, want %d: %+v", len(events), len(want), events)
+		}
+		for i, w := range want {
+			if events[i].Type != w.typ || events[i].AggregateID != w.id {
+				t.Errorf("event %d = %s %d, want %s %d", i, events[i].Type, events[i].AggregateID, w.typ, w.id)
+			}
+		}
+		// Deleted books are reported as they were
+		payload := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(events[0].Payload), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload["title"] != "Book 1" {
+			t.Errorf("payload = %s, want the deleted book", events[0].Payload)
+		}
+
+		// Nothing is queued for an author that is not there
+		if _, err := (&Author{}).DeleteAuthor(db, authors[0].ID); !gorm.IsRecordNotFoundError(err) {
+			t.Errorf("DeleteAuthor of a deleted author = %v, want not found", err)
+		}
+		if n := count(t, db, &OutboxEvent{}, "id > ?", last); n != len(want) {
+			t.Errorf("%d events queued, want %d", n, len(want))
+		}
+	})
+}
+
+func TestFindDueEvents(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		migrated(t, db)
+		now := time.Now()
+		queue := func(id uint32, next time.Time, dispatched bool) uint64 {
+			e := OutboxEvent{Type: BookUpdated, AggregateType: "book", AggregateID: id, Payload: "{}", CreatedAt: now, NextAttemptAt: next}
+			if dispatched {
+				e.DispatchedAt = &now
+			}
+			if err := db.Create(&e).Error; err != nil {
+				t.Fatal(err)
+			}
+			return e.ID
+		}
+		queue(1, now, true)
+		book1 := queue(1, now, false)
+		queue(1, now, false)
+		queue(2, now.Add(time.Hour), false)
+		queue(2, now, false)
+		// Same ID, another aggregate
+		author1 := queue(0, now, false)
+		db.Model(&OutboxEvent{}).Where("id = ?", author1).Updates(map[string]interface{}{"aggregate_type": "author", "aggregate_id": 1})
+
+		due, err := (&OutboxEvent{}).FindDueEvents(db, now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []uint64
+		for _, e := range *due {
+			ids = append(ids, e.ID)
+		}
+		if len(ids) != 2 || ids[0] != book1 || ids[1] != author1 {
+			t.Errorf("due = %v, want %d of book 1 and %d of author 1; book 2 waits for its first", ids, book1, author1)
+		}
+		if due, _ := (&OutboxEvent{}).FindDueEvents(db, now, 1); len(*due) != 1 || (*due)[0].ID != book1 {
+			t.Errorf("due with limit 1 = %+v", *due)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// Query shapes a read: which columns of each table to select and which
+// relations to load along. The zero Query reads every column and no
+// relations.
+type Query struct {
+	// Fields lists the columns wanted per table, every column for tables
+	// not listed. The caller checks the names against the table.
+	Fields map[string][]string
+	// Include names the relations to load, such as "author" of a book.
+	Include map[string]bool
+	// After and Limit page through a list in ID order: rows after the
+	// one with ID After, at most Limit of them, or 100 when 0.
+	After uint32
+	Limit int
+}
+
+// page limits a list read to the rows of q's page.
+func (q Query) page(db *gorm.DB) *gorm.DB {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if q.After != 0 {
+		db = db.Where("id > ?", q.After)
+	}
+	return db.Order("id").Limit(limit)
+}
+
+// selectColumns limits db to the columns q wants from table, plus the
+// required ones the read cannot do without.
+func (q Query) selectColumns(db *gorm.DB, table string, required ...string) *gorm.DB {
+	fields, ok := q.Fields[table]
+	if !ok {
+		return db
+	}
+	columns := append([]string{}, required...)
+	for _, f := range fields {
+		if !contains(columns, f) {
+			columns = append(columns, f)
+		}
+	}
+	return db.Select(columns)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loadBookAuthors sets the Author of each book with one query.
+func loadBookAuthors(db *gorm.DB, books []Book, q Query) error {
+	if len(books) == 0 {
+		return nil
+	}
+	ids := make([]uint32, 0, len(books))
+	for i := range books {
+		ids = append(ids, books[i].AuthorID)
+	}
+	author := Author{}
+	byID, err := author.FindAuthorsByIDs(db, ids, q)
+	if err != nil {
+		return err
+	}
+	for i := range books {
+		books[i].Author = byID[books[i].AuthorID]
+	}
+	return nil
+}
+
+// loadAuthorBooks sets the Books of each author with one query.
+func loadAuthorBooks(db *gorm.DB, authors []Author, q Query) error {
+	if len(authors) == 0 {
+		return nil
+	}
+	ids := make([]uint32, 0, len(authors))
+	for i := range authors {
+		ids = append(ids, authors[i].ID)
+	}
+	book := Book{}
+	byAuthor, err := book.FindBooksByAuthorIDs(db, ids, q)
+	if err != nil {
+		return err
+	}
+	for i := range authors {
+		authors[i].Books = byAuthor[authors[i].ID]
+		if authors[i].Books == nil {
+			authors[i].Books = []Book{}
+		}
+	}
+	return nil
+}
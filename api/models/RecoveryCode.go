@@ -0,0 +1,92 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrInvalidCode = errors.New("Invalid code")
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time.
+const RecoveryCodeCount = 10
+
+// RecoveryCode lets a user log in once without their authenticator app.
+// Like UserToken only a hash is stored.
+type RecoveryCode struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null;index" json:"user_id"`
+	Hash      string     `gorm:"size:64;not null;unique_index" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// recoveryAlphabet leaves out characters that are easily confused.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// newRecoveryCode returns a code of the form xxxxx-xxxxx, about 49 bits.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 11)
+	for i, c := range b {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		// The small modulo bias is irrelevant at this length
+		code = append(code, recoveryAlphabet[int(c)%len(recoveryAlphabet)])
+	}
+	return string(code), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), " ", "", -1))
+}
+
+// ReplaceRecoveryCodes deletes the recovery codes of user uid and returns
+// RecoveryCodeCount new ones. They cannot be shown again.
+func ReplaceRecoveryCodes(db *gorm.DB, uid uint32) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	err := Transaction(db, func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", uid).Delete(&RecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for i := range codes {
+			codes[i], err = newRecoveryCode()
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&RecoveryCode{UserID: uid, Hash: hashToken(codes[i]), CreatedAt: now}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode uses up code for user uid. It returns ErrInvalidCode if
+// the code is unknown or was used before.
+func UseRecoveryCode(db *gorm.DB, uid uint32, code string) error {
+	used := db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", uid, hashToken(normalizeRecoveryCode(code))).
+		UpdateColumn("used_at", time.Now())
+	if used.Error != nil {
+		return used.Error
+	}
+	if used.RowsAffected != 1 {
+		return ErrInvalidCode
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// Tables lists every model stored in its own table, parents before the
+// tables that reference them.
+func Tables() []interface{} {
+	return []interface{}{&User{}, &UserToken{}, &RecoveryCode{}, &ExternalIdentity{}, &APIKey{}, &IdempotencyKey{}, &Author{}, &Book{}, &AuditLog{}, &OutboxEvent{}, &Webhook{}, &WebhookDelivery{}}
+}
+
+// foreignKey is a constraint added after the tables exist, so the model
+// definitions stay free of dialect specific SQL.
+type foreignKey struct {
+	model    interface{}
+	field    string
+	dest     string
+	onDelete string
+	onUpdate string
+}
+
+var foreignKeys = []foreignKey{
+	{&UserToken{}, "user_id", "users(id)", "CASCADE", "CASCADE"},
+	{&RecoveryCode{}, "user_id", "users(id)", "CASCADE", "CASCADE"},
+	{&ExternalIdentity{}, "user_id", "users(id)", "CASCADE", "CASCADE"},
+	{&APIKey{}, "user_id", "users(id)", "CASCADE", "CASCADE"},
+	{&Book{}, "author_id", "authors(id)", "CASCADE", "CASCADE"},
+	{&WebhookDelivery{}, "webhook_id", "webhooks(id)", "CASCADE", "CASCADE"},
+}
+
+// Migrate creates or updates every table and adds missing foreign keys.
+// SQLite cannot add constraints to an existing table, so there the keys
+// are left out and cascades are not enforced by the database; the models
+// delete the rows that would cascade themselves.
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(Tables()...).Error; err != nil {
+		return err
+	}
+	// Replaced by idx_idempotency_owner_key, which also covers the client
+	idempotency := db.NewScope(&IdempotencyKey{}).TableName()
+	if db.Dialect().HasIndex(idempotency, "idx_idempotency_user_key") {
+		if err := db.Model(&IdempotencyKey{}).RemoveIndex("idx_idempotency_user_key").Error; err != nil {
+			return err
+		}
+	}
+	if db.Dialect().GetName() == "sqlite3" {
+		return nil
+	}
+	for _, fk := range foreignKeys {
+		table := db.NewScope(fk.model).TableName()
+		n, err := countForeignKeys(db, table, fk.field)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		err = db.Model(fk.model).AddForeignKey(fk.field, fk.dest, fk.onDelete, fk.onUpdate).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countForeignKeys returns how many foreign keys column of table has,
+// whatever they are named. Databases seeded by older versions have keys
+// named by gorm, or by hand, next to which a second one must not be added.
+func countForeignKeys(db *gorm.DB, table, column string) (int, error) {
+	var query string
+	switch db.Dialect().GetName() {
+	case "mysql":
+		query = `SELECT count(*) FROM information_schema.key_column_usage
+			WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?
+			AND referenced_table_name IS NOT NULL`
+	default:
+		query = `SELECT count(*) FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name
+			WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = CURRENT_SCHEMA()
+			AND tc.table_name = ? AND kcu.column_name = ?`
+	}
+	var n int
+	err := db.Raw(query, table, column).Row().Scan(&n)
+	return n, err
+}
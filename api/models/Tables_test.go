@@ -0,0 +1,181 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// testDatabase is a driver the model tests run against.
+type testDatabase struct {
+	driver string
+	dsn    string
+}
+
+// testDatabases returns SQLite, which always runs, and Postgres and MySQL
+// when TEST_POSTGRES_DSN and TEST_MYSQL_DSN name a database that may be
+// emptied.
+func testDatabases(t *testing.T) []testDatabase {
+	dbs := []testDatabase{
+		{"sqlite3", "file:" + filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=1"},
+	}
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		dbs = append(dbs, testDatabase{"postgres", dsn})
+	}
+	if dsn := os.Getenv("TEST_MYSQL_DSN"); dsn != "" {
+		dbs = append(dbs, testDatabase{"mysql", dsn})
+	}
+	return dbs
+}
+
+// forEachDatabase runs fn against an empty database of every driver.
+func forEachDatabase(t *testing.T, fn func(t *testing.T, db *gorm.DB)) {
+	for _, tdb := range testDatabases(t) {
+		tdb := tdb
+		t.Run(tdb.driver, func(t *testing.T) {
+			db, err := gorm.Open(tdb.driver, tdb.dsn)
+			if err != nil {
+				t.Fatalf("open %s: %v", tdb.driver, err)
+			}
+			defer db.Close()
+			dropTables(t, db)
+			fn(t, db)
+		})
+	}
+}
+
+func dropTables(t *testing.T, db *gorm.DB) {
+	tables := Tables()
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := db.DropTableIfExists(tables[i]).Error; err != nil {
+			t.Fatalf("drop table: %v", err)
+		}
+	}
+}
+
+// migrated returns db with every table created.
+func migrated(t *testing.T, db *gorm.DB) *gorm.DB {
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+func count(t *testing.T, db *gorm.DB, model interface{}, where string, args ...interface{}) int {
+	var n int
+	if err := db.Model(model).Where(where, args...).Count(&n).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return n
+}
+
+func TestMigrateAddsEachForeignKeyOnce(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		if db.Dialect().GetName() == "sqlite3" {
+			// No keys to add, but migrating again must work
+			migrated(t, db)
+			migrated(t, db)
+			return
+		}
+		if err := db.AutoMigrate(Tables()...).Error; err != nil {
+			t.Fatal(err)
+		}
+		// A key added before, under another name than Migrate's
+		err := db.Exec("ALTER TABLE books ADD CONSTRAINT books_author_fk FOREIGN KEY (author_id) REFERENCES authors(id)").Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrated(t, db)
+		migrated(t, db)
+		for _, fk := range foreignKeys {
+			table := db.NewScope(fk.model).TableName()
+			n, err := countForeignKeys(db, table, fk.field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Errorf("%s.%s has %d foreign keys, want 1", table, fk.field, n)
+			}
+		}
+	})
+}
+
+func TestDeleteAUserDeletesTheirRows(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		migrated(t, db)
+		now := time.Now()
+		users := []User{
+			{Nickname: "one", Email: "one@example.com", Password: "password"},
+			{Nickname: "two", Email: "two@example.com", Password: "password"},
+		}
+		for i := range users {
+			if _, err := users[i].SaveUser(db); err != nil {
+				t.Fatal(err)
+			}
+			uid := users[i].ID
+			rows := []interface{}{
+				&UserToken{UserID: uid, Purpose: "verify", Hash: hashToken(users[i].Email), ExpiresAt: now},
+				&RecoveryCode{UserID: uid, Hash: hashToken(users[i].Nickname), CreatedAt: now},
+				&ExternalIdentity{UserID: uid, Issuer: "https://idp", Subject: users[i].Nickname, Email: users[i].Email},
+				&APIKey{UserID: uid, Name: "ci", Prefix: users[i].Nickname, Hash: "x", Scopes: "books:read", ExpiresAt: now},
+			}
+			for _, row := range rows {
+				if err := db.Create(row).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		if _, err := (&User{}).DeleteAUser(db, users[0].ID); err != nil {
+			t.Fatalf("DeleteAUser: %v", err)
+		}
+		for _, model := range []interface{}{&UserToken{}, &RecoveryCode{}, &ExternalIdentity{}, &APIKey{}} {
+			if n := count(t, db, model, "user_id = ?", users[0].ID); n != 0 {
+				t.Errorf("%T: %d rows of the deleted user left", model, n)
+			}
+			if n := count(t, db, model, "user_id = ?", users[1].ID); n != 1 {
+				t.Errorf("%T: %d rows of the other user, want 1", model, n)
+			}
+		}
+	})
+}
+
+func TestDeleteAuthorDeletesTheirBooks(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		migrated(t, db)
+		authors := []Author{
+			{Name: "Peter", Lastname: "Sidorov", Email: "p.sidorov@example.com"},
+			{Name: "Vasiliy", Lastname: "Rogov", Email: "v.rogov@example.com"},
+		}
+		for i := range authors {
+			if _, err := authors[i].SaveAuthor(db); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i, title := range []string{"Book 1", "Book 2", "Book 3"} {
+			book := Book{Title: title, Content: "Plot", AuthorID: authors[i/2].ID}
+			if _, err := book.SaveBook(db); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := (&Author{}).DeleteAuthor(db, authors[0].ID); err != nil {
+			t.Fatalf("DeleteAuthor: %v", err)
+		}
+		if n := count(t, db, &Book{}, "author_id = ?", authors[0].ID); n != 0 {
+			t.Errorf("%d books of the deleted author left", n)
+		}
+		if n := count(t, db, &Book{}, "author_id = ?", authors[1].ID); n != 1 {
+			t.Errorf("%d books of the other author, want 1", n)
+		}
+		if n := count(t, db, &AuditLog{}, "resource_type = ? AND action = ?", "book", AuditDelete); n != 2 {
+			t.Errorf("%d book deletions audited, want 2", n)
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Transaction runs fn inside a database transaction, committing when fn
+// returns nil and rolling back otherwise. If db is already a transaction fn
+// joins it, so callers can compose several model methods into one unit.
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return fn(db)
+	}
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
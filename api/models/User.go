@@ -3,7 +3,6 @@ package models
 import (
 	"errors"
 	"html"
-	"log"
 	"strings"
 	"time"
 
@@ -13,12 +12,22 @@ import (
 )
 
 type User struct {
-	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
-	Nickname  string    `gorm:"size:255;not null;unique" json:"nickname"`
-	Email     string    `gorm:"size:100;not null;unique" json:"email"`
-	Password  string    `gorm:"size:100;not null;" json:"password"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID       uint32 `gorm:"primary_key;auto_increment" json:"id"`
+	Nickname string `gorm:"size:255;not null;unique" json:"nickname"`
+	Email    string `gorm:"size:100;not null;unique" json:"email"`
+	Password string `gorm:"size:100;not null;" json:"password"`
+	IsAdmin  bool   `gorm:"not null;default:false" json:"is_admin"`
+	// EmailVerifiedAt is set once the user follows the verification link,
+	// and cleared when the email changes.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TOTPSecret is set on enrollment and only used for login once the
+	// user proved their app works, which sets TOTPEnabled. TOTPLastStep is
+	// the time step of the last code accepted, so no code works twice.
+	TOTPSecret   string    `gorm:"size:64" json:"-"`
+	TOTPEnabled  bool      `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep int64     `gorm:"not null;default:0" json:"-"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
 func Hash(password string) ([]byte, error) {
@@ -42,6 +51,11 @@ func (u *User) Prepare() {
 	u.ID = 0
 	u.Nickname = html.EscapeString(strings.TrimSpace(u.Nickname))
 	u.Email = html.EscapeString(strings.TrimSpace(u.Email))
+	u.IsAdmin = false
+	u.EmailVerifiedAt = nil
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastStep = 0
 	u.CreatedAt = time.Now()
 	u.UpdatedAt = time.Now()
 }
@@ -94,18 +108,26 @@ func (u *User) Validate(action string) error {
 
 func (u *User) SaveUser(db *gorm.DB) (*User, error) {
 
-	var err error
-	err = db.Debug().Create(&u).Error
+	err := Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, AuditCreate, "user", u.ID, nil, u); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditCreate, "user", u.ID, u)
+	})
 	if err != nil {
 		return &User{}, err
 	}
 	return u, nil
 }
 
-func (u *User) FindAllUsers(db *gorm.DB) (*[]User, error) {
+// FindAllUsers returns the page of users q asks for.
+func (u *User) FindAllUsers(db *gorm.DB, q Query) (*[]User, error) {
 	var err error
 	users := []User{}
-	err = db.Debug().Model(&User{}).Limit(100).Find(&users).Error
+	err = q.page(db.Model(&User{})).Find(&users).Error
 	if err != nil {
 		return &[]User{}, err
 	}
@@ -114,7 +136,7 @@ func (u *User) FindAllUsers(db *gorm.DB) (*[]User, error) {
 
 func (u *User) FindUserByID(db *gorm.DB, uid uint32) (*User, error) {
 	var err error
-	err = db.Debug().Model(User{}).Where("id = ?", uid).Take(&u).Error
+	err = db.Model(User{}).Where("id = ?", uid).Take(&u).Error
 	if err != nil {
 		return &User{}, err
 	}
@@ -129,33 +151,166 @@ func (u *User) UpdateAUser(db *gorm.DB, uid uint32) (*User, error) {
 	// To hash the password
 	err := u.BeforeSave()
 	if err != nil {
-		log.Fatal(err)
+		return &User{}, err
 	}
-	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
-		map[string]interface{}{
+	err = Transaction(db, func(tx *gorm.DB) error {
+		before := User{}
+		err := tx.Model(&User{}).Where("id = ?", uid).Take(&before).Error
+		if err != nil {
+			return err
+		}
+		changes := map[string]interface{}{
 			"password":   u.Password,
 			"nickname":   u.Nickname,
 			"email":      u.Email,
 			"updated_at": time.Now(),
-		},
-	)
-	if db.Error != nil {
-		return &User{}, db.Error
-	}
-	// This is the display the updated user
-	err = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&u).Error
+		}
+		if !strings.EqualFold(before.Email, u.Email) {
+			// A new address has to be verified again
+			changes["email_verified_at"] = nil
+		}
+		err = tx.Model(&User{}).Where("id = ?", uid).UpdateColumns(changes).Error
+		if err != nil {
+			return err
+		}
+		// This is the display the updated user
+		err = tx.Model(&User{}).Where("id = ?", uid).Take(&u).Error
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, AuditUpdate, "user", uid, &before, u); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditUpdate, "user", uid, u)
+	})
 	if err != nil {
 		return &User{}, err
 	}
 	return u, nil
 }
 
-func (u *User) DeleteAUser(db *gorm.DB, uid uint32) (int64, error) {
+// SetPassword replaces the password of user uid.
+func (u *User) SetPassword(db *gorm.DB, uid uint32, password string) error {
+	hashedPassword, err := Hash(password)
+	if err != nil {
+		return err
+	}
+	return u.updateColumns(db, uid, map[string]interface{}{
+		"password":   string(hashedPassword),
+		"updated_at": time.Now(),
+	})
+}
+
+// MarkEmailVerified records that user uid proved they own their email.
+func (u *User) MarkEmailVerified(db *gorm.DB, uid uint32) error {
+	return u.updateColumns(db, uid, map[string]interface{}{
+		"email_verified_at": time.Now(),
+	})
+}
+
+// SetTOTPSecret stores a new secret for user uid pending confirmation.
+// Two-factor login stays off until EnableTOTP.
+func (u *User) SetTOTPSecret(db *gorm.DB, uid uint32, secret string) error {
+	return u.updateColumns(db, uid, map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+		"updated_at":     time.Now(),
+	})
+}
+
+// EnableTOTP turns on two-factor login for user uid.
+func (u *User) EnableTOTP(db *gorm.DB, uid uint32) error {
+	return u.updateColumns(db, uid, map[string]interface{}{
+		"totp_enabled": true,
+		"updated_at":   time.Now(),
+	})
+}
 
-	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).Delete(&User{})
+// DisableTOTP turns off two-factor login for user uid and forgets the
+// secret and recovery codes.
+func (u *User) DisableTOTP(db *gorm.DB, uid uint32) error {
+	return Transaction(db, func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", uid).Delete(&RecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+		return u.updateColumns(tx, uid, map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+			"updated_at":     time.Now(),
+		})
+	})
+}
 
-	if db.Error != nil {
-		return 0, db.Error
+// UseTOTPStep records that the code of time step step was accepted for user
+// uid. It returns ErrInvalidCode if that step or a later one was already
+// used, also when two requests race with the same code.
+func (u *User) UseTOTPStep(db *gorm.DB, uid uint32, step int64) error {
+	used := db.Model(&User{}).Where("id = ? AND totp_last_step < ?", uid, step).UpdateColumn("totp_last_step", step)
+	if used.Error != nil {
+		return used.Error
+	}
+	if used.RowsAffected != 1 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// updateColumns applies changes to user uid and records them in the audit
+// log, leaving the user in u.
+func (u *User) updateColumns(db *gorm.DB, uid uint32, changes map[string]interface{}) error {
+	return Transaction(db, func(tx *gorm.DB) error {
+		before := User{}
+		err := tx.Model(&User{}).Where("id = ?", uid).Take(&before).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&User{}).Where("id = ?", uid).UpdateColumns(changes).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&User{}).Where("id = ?", uid).Take(u).Error
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, AuditUpdate, "user", uid, &before, u); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditUpdate, "user", uid, u)
+	})
+}
+
+// DeleteAUser deletes user uid together with their tokens, recovery codes,
+// linked identities and API keys.
+func (u *User) DeleteAUser(db *gorm.DB, uid uint32) (int64, error) {
+
+	var rows int64
+	err := Transaction(db, func(tx *gorm.DB) error {
+		before := User{}
+		err := tx.Model(&User{}).Where("id = ?", uid).Take(&before).Error
+		if err != nil {
+			return err
+		}
+		// SQLite does not cascade, see Migrate
+		for _, child := range []interface{}{&UserToken{}, &RecoveryCode{}, &ExternalIdentity{}, &APIKey{}} {
+			if err := tx.Where("user_id = ?", uid).Delete(child).Error; err != nil {
+				return err
+			}
+		}
+		del := tx.Model(&User{}).Where("id = ?", uid).Delete(&User{})
+		if del.Error != nil {
+			return del.Error
+		}
+		rows = del.RowsAffected
+		if err := recordAudit(tx, AuditDelete, "user", uid, &before, nil); err != nil {
+			return err
+		}
+		return recordEvent(tx, AuditDelete, "user", uid, &before)
+	})
+	if err != nil {
+		return 0, err
 	}
-	return db.RowsAffected, nil
+	return rows, nil
 }
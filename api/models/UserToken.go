@@ -0,0 +1,93 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Purposes of a UserToken.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+var ErrInvalidToken = errors.New("Invalid or expired token")
+
+// UserToken is a single-use secret mailed to a user. Only its SHA-256 hash
+// is stored, so a copy of the database cannot be used to take over accounts.
+type UserToken struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null;index" json:"user_id"`
+	Purpose   string     `gorm:"size:32;not null" json:"purpose"`
+	Hash      string     `gorm:"size:64;not null;unique_index" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueUserToken creates a token for purpose valid for ttl and returns it.
+// Earlier unused tokens of the user for the same purpose stop working.
+func IssueUserToken(db *gorm.DB, uid uint32, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	err := Transaction(db, func(tx *gorm.DB) error {
+		err := tx.Model(&UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", uid, purpose).
+			UpdateColumn("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&UserToken{
+			UserID:    uid,
+			Purpose:   purpose,
+			Hash:      hashToken(raw),
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeUserToken marks the token raw for purpose as used and returns the
+// ID of its user. It returns ErrInvalidToken if the token is unknown,
+// expired or already used, also when two requests race to use it.
+func ConsumeUserToken(db *gorm.DB, raw, purpose string) (uint32, error) {
+	token := UserToken{}
+	err := db.Model(&UserToken{}).Where("hash = ? AND purpose = ?", hashToken(raw), purpose).Take(&token).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if token.UsedAt != nil || now.After(token.ExpiresAt) {
+		return 0, ErrInvalidToken
+	}
+	used := db.Model(&UserToken{}).Where("id = ? AND used_at IS NULL", token.ID).UpdateColumn("used_at", now)
+	if used.Error != nil {
+		return 0, used.Error
+	}
+	if used.RowsAffected != 1 {
+		return 0, ErrInvalidToken
+	}
+	return token.UserID, nil
+}
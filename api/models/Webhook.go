@@ -0,0 +1,323 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Events a webhook can subscribe to, named <resource>.<action>.
+var WebhookEvents = []string{
+	"book.created", "book.updated", "book.deleted",
+	"author.created", "author.updated", "author.deleted",
+	"user.created", "user.updated", "user.deleted",
+}
+
+// webhookEvents names the domain events for webhooks.
+var webhookEvents = map[string]string{
+	BookCreated:   "book.created",
+	BookUpdated:   "book.updated",
+	BookDeleted:   "book.deleted",
+	AuthorCreated: "author.created",
+	AuthorUpdated: "author.updated",
+	AuthorDeleted: "author.deleted",
+	UserCreated:   "user.created",
+	UserUpdated:   "user.updated",
+	UserDeleted:   "user.deleted",
+}
+
+// Webhook subscribes URL to events. Every event is POSTed to it, signed
+// with Secret, which is kept to sign and never shown again.
+type Webhook struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	URL       string    `gorm:"size:2048;not null" json:"url"`
+	Secret    string    `gorm:"size:100;not null" json:"-"`
+	Events    string    `gorm:"size:255;not null" json:"events"`
+	CreatedBy uint32    `gorm:"not null" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Delivery states. A delivery is retried while pending, until it is
+// delivered or out of attempts, when it is dead.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event to send to one webhook, and how sending it
+// went so far.
+type WebhookDelivery struct {
+	ID        uint64 `gorm:"primary_key;auto_increment" json:"id"`
+	WebhookID uint32 `gorm:"not null;index" json:"webhook_id"`
+	// EventID is the ID of the OutboxEvent delivered, the same for every
+	// webhook and across redeliveries, so receivers can drop duplicates.
+	EventID       string     `gorm:"size:32;not null;index" json:"event_id"`
+	Event         string     `gorm:"size:50;not null" json:"event"`
+	Payload       RawJSON    `gorm:"type:text;not null" json:"payload" swaggertype:"object"`
+	Status        string     `gorm:"size:20;not null;index:idx_webhook_deliveries_due" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index:idx_webhook_deliveries_due" json:"next_attempt_at"`
+	LastStatus    int        `json:"last_status"`
+	LastError     string     `gorm:"size:255" json:"last_error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+// DeliveryFilter narrows down FindDeliveries. Zero values match everything.
+type DeliveryFilter struct {
+	Status string
+}
+
+// EventList returns the events w subscribes to.
+func (w *Webhook) EventList() []string {
+	return strings.Fields(w.Events)
+}
+
+// Subscribes reports whether w wants event.
+func (w *Webhook) Subscribes(event string) bool {
+	for _, e := range w.EventList() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) SaveWebhook(db *gorm.DB) (*Webhook, error) {
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = w.CreatedAt
+	err := Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(w).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, AuditCreate, "webhook", w.ID, nil, w)
+	})
+	if err != nil {
+		return &Webhook{}, err
+	}
+	return w, nil
+}
+
+func (w *Webhook) FindWebhooks(db *gorm.DB) (*[]Webhook, error) {
+	hooks := []Webhook{}
+	err := db.Model(&Webhook{}).Order("id").Find(&hooks).Error
+	if err != nil {
+		return &[]Webhook{}, err
+	}
+	return &hooks, nil
+}
+
+func (w *Webhook) FindWebhookByID(db *gorm.DB, id uint32) (*Webhook, error) {
+	err := db.Model(&Webhook{}).Where("id = ?", id).Take(w).Error
+	if err != nil {
+		return &Webhook{}, err
+	}
+	return w, nil
+}
+
+// UpdateAWebhook replaces the URL and events of webhook id, and its secret
+// unless w has none.
+func (w *Webhook) UpdateAWebhook(db *gorm.DB, id uint32) (*Webhook, error) {
+	err := Transaction(db, func(tx *gorm.DB) error {
+		before := Webhook{}
+		err := tx.Model(&Webhook{}).Where("id = ?", id).Take(&before).Error
+		if err != nil {
+			return err
+		}
+		changes := map[string]interface{}{
+			"url":        w.URL,
+			"events":     w.Events,
+			"updated_at": time.Now(),
+		}
+		if w.Secret != "" {
+			changes["secret"] = w.Secret
+		}
+		err = tx.Model(&Webhook{}).Where("id = ?", id).UpdateColumns(changes).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Webhook{}).Where("id = ?", id).Take(w).Error
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, AuditUpdate, "webhook", id, &before, w)
+	})
+	if err != nil {
+		return &Webhook{}, err
+	}
+	return w, nil
+}
+
+// DeleteAWebhook deletes webhook id together with its deliveries.
+func (w *Webhook) DeleteAWebhook(db *gorm.DB, id uint32) (int64, error) {
+	var rows int64
+	err := Transaction(db, func(tx *gorm.DB) error {
+		before := Webhook{}
+		err := tx.Model(&Webhook{}).Where("id = ?", id).Take(&before).Error
+		if err != nil {
+			return err
+		}
+		// SQLite does not cascade, see Migrate
+		err = tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+		del := tx.Model(&Webhook{}).Where("id = ?", id).Delete(&Webhook{})
+		if del.Error != nil {
+			return del.Error
+		}
+		rows = del.RowsAffected
+		return recordAudit(tx, AuditDelete, "webhook", id, &before, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+// QueueWebhooks queues event e for the webhooks subscribed to it. Queueing
+// an event again adds only the deliveries it is still missing, so e may be
+// handed over more than once.
+func (d *WebhookDelivery) QueueWebhooks(db *gorm.DB, e *OutboxEvent) error {
+	event, ok := webhookEvents[e.Type]
+	if !ok {
+		return nil
+	}
+	hooks, err := (&Webhook{}).FindWebhooks(db)
+	if err != nil {
+		return err
+	}
+	eventID := strconv.FormatUint(e.ID, 10)
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         eventID,
+		"type":       event,
+		"created_at": e.CreatedAt,
+		"data":       e.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	return Transaction(db, func(tx *gorm.DB) error {
+		for _, h := range *hooks {
+			if !h.Subscribes(event) {
+				continue
+			}
+			var queued int
+			err := tx.Model(&WebhookDelivery{}).Where("webhook_id = ? AND event_id = ?", h.ID, eventID).Count(&queued).Error
+			if err != nil {
+				return err
+			}
+			if queued > 0 {
+				continue
+			}
+			now := time.Now()
+			delivery := WebhookDelivery{
+				WebhookID:     h.ID,
+				EventID:       eventID,
+				Event:         event,
+				Payload:       RawJSON(payload),
+				Status:        DeliveryPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+			}
+			if err := tx.Create(&delivery).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// IsWebhookEvent reports whether a webhook can subscribe to event.
+func IsWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// FindDeliveries returns the latest deliveries to webhook id, newest first.
+func (d *WebhookDelivery) FindDeliveries(db *gorm.DB, id uint32, filter DeliveryFilter) (*[]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	q := db.Model(&WebhookDelivery{}).Where("webhook_id = ?", id)
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	err := q.Order("id desc").Limit(100).Find(&deliveries).Error
+	if err != nil {
+		return &[]WebhookDelivery{}, err
+	}
+	return &deliveries, nil
+}
+
+// FindDueDeliveries returns up to limit pending deliveries whose next
+// attempt is due, oldest first.
+func (d *WebhookDelivery) FindDueDeliveries(db *gorm.DB, now time.Time, limit int) (*[]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	err := db.Model(&WebhookDelivery{}).
+		Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("id").Limit(limit).Find(&deliveries).Error
+	if err != nil {
+		return &[]WebhookDelivery{}, err
+	}
+	return &deliveries, nil
+}
+
+// ClaimDelivery moves the next attempt of d, due at now, to until unless
+// another server did so first, and reports whether it did. Whoever claims
+// a delivery sends it; if they die, it is due again at until.
+func (d *WebhookDelivery) ClaimDelivery(db *gorm.DB, now, until time.Time) (bool, error) {
+	claim := db.Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", d.ID, DeliveryPending, now).
+		UpdateColumn("next_attempt_at", until)
+	if claim.Error != nil {
+		return false, claim.Error
+	}
+	return claim.RowsAffected == 1, nil
+}
+
+// RecordAttempt stores the outcome of sending d: its status, attempts,
+// next attempt and last response.
+func (d *WebhookDelivery) RecordAttempt(db *gorm.DB) error {
+	if len(d.LastError) > 255 {
+		d.LastError = d.LastError[:255]
+	}
+	return db.Model(&WebhookDelivery{}).Where("id = ?", d.ID).UpdateColumns(map[string]interface{}{
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"next_attempt_at": d.NextAttemptAt,
+		"last_status":     d.LastStatus,
+		"last_error":      d.LastError,
+		"delivered_at":    d.DeliveredAt,
+	}).Error
+}
+
+// Redeliver queues delivery id of webhook hook to be sent again now, with
+// all its attempts, whatever its status.
+func (d *WebhookDelivery) Redeliver(db *gorm.DB, hook uint32, id uint64) (*WebhookDelivery, error) {
+	err := Transaction(db, func(tx *gorm.DB) error {
+		err := tx.Model(&WebhookDelivery{}).Where("id = ? AND webhook_id = ?", id, hook).Take(d).Error
+		if err != nil {
+			return err
+		}
+		d.Status = DeliveryPending
+		d.Attempts = 0
+		d.NextAttemptAt = time.Now()
+		return tx.Model(&WebhookDelivery{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+			"status":          d.Status,
+			"attempts":        d.Attempts,
+			"next_attempt_at": d.NextAttemptAt,
+		}).Error
+	})
+	if err != nil {
+		return &WebhookDelivery{}, err
+	}
+	return d, nil
+}
@@ -0,0 +1,115 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// leeway allows for clock differences with the provider.
+const leeway = time.Minute
+
+// Claims are the verified claims of an ID token this API uses.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	// AMR lists how the provider authenticated the user, if it says.
+	AMR []string
+}
+
+// Verify checks the signature, issuer, audience, lifetime and nonce of an
+// ID token (OpenID Connect Core 1.0 section 3.1.3.7) and returns its claims.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	if _, err := p.Discover(ctx); err != nil {
+		return nil, err
+	}
+	parser := &jwt.Parser{
+		ValidMethods:         []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"},
+		SkipClaimsValidation: true,
+	}
+	token, err := parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oidc: id token: %v", err)
+	}
+	mc, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("oidc: id token: unreadable claims")
+	}
+	now := time.Now()
+	switch {
+	case stringClaim(mc, "iss") != p.Issuer:
+		return nil, errors.New("oidc: id token: wrong issuer")
+	case !hasAudience(mc, p.ClientID):
+		return nil, errors.New("oidc: id token: wrong audience")
+	case !timeClaim(mc, "exp").Add(leeway).After(now):
+		return nil, errors.New("oidc: id token: expired")
+	case timeClaim(mc, "iat").After(now.Add(leeway)):
+		return nil, errors.New("oidc: id token: issued in the future")
+	case subtle.ConstantTimeCompare([]byte(stringClaim(mc, "nonce")), []byte(nonce)) != 1:
+		return nil, errors.New("oidc: id token: wrong nonce")
+	case stringClaim(mc, "sub") == "":
+		return nil, errors.New("oidc: id token: no subject")
+	}
+	claims := &Claims{
+		Subject:           stringClaim(mc, "sub"),
+		Email:             stringClaim(mc, "email"),
+		Name:              stringClaim(mc, "name"),
+		PreferredUsername: stringClaim(mc, "preferred_username"),
+	}
+	// Some providers send the flag as a string
+	switch v := mc["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = v
+	case string:
+		claims.EmailVerified = v == "true"
+	}
+	if list, ok := mc["amr"].([]interface{}); ok {
+		for _, m := range list {
+			if s, ok := m.(string); ok {
+				claims.AMR = append(claims.AMR, s)
+			}
+		}
+	}
+	return claims, nil
+}
+
+func stringClaim(mc jwt.MapClaims, name string) string {
+	s, _ := mc[name].(string)
+	return s
+}
+
+func timeClaim(mc jwt.MapClaims, name string) time.Time {
+	f, _ := mc[name].(float64)
+	return time.Unix(int64(f), 0)
+}
+
+// hasAudience reports whether the aud claim, a string or a list, holds
+// clientID. With several audiences azp must name this client.
+func hasAudience(mc jwt.MapClaims, clientID string) bool {
+	switch aud := mc["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		found := false
+		for _, a := range aud {
+			if a == clientID {
+				found = true
+			}
+		}
+		if len(aud) > 1 {
+			return found && stringClaim(mc, "azp") == clientID
+		}
+		return found
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/serg2013/reading/api/oidc/oidctest"
+)
+
+const redirectURL = "https://reading.example.com/v1/auth/oidc/callback"
+
+func newTestProvider(t *testing.T) (*oidctest.Server, *Provider) {
+	idp := oidctest.NewServer("reading", "client secret")
+	t.Cleanup(idp.Close)
+	return idp, NewProvider(idp.URL, "", idp.ClientID, idp.ClientSecret, redirectURL, []string{"openid", "email"})
+}
+
+func TestDiscover(t *testing.T) {
+	idp, p := newTestProvider(t)
+	d, err := p.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if d.TokenEndpoint != idp.URL+"/token" || d.JWKSURI != idp.URL+"/keys" {
+		t.Errorf("Discover = %+v", d)
+	}
+
+	other := NewProvider("https://other.example.com", idp.URL+"/.well-known/openid-configuration", "reading", "", redirectURL, nil)
+	if _, err := other.Discover(context.Background()); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Errorf("Discover of a document for another issuer = %v, want an error", err)
+	}
+
+	incomplete := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"issuer":"http://` + r.Host + `","authorization_endpoint":"http://` + r.Host + `/authorize"}`))
+	}))
+	defer incomplete.Close()
+	if _, err := NewProvider(incomplete.URL, "", "reading", "", redirectURL, nil).Discover(context.Background()); err == nil {
+		t.Error("Discover of a document without token endpoint succeeded")
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp, p := newTestProvider(t)
+	ctx := context.Background()
+	state, nonce, verifier := "the state", "the nonce", "the verifier"
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := mustParse(t, authURL).Query()
+	want := map[string]string{
+		"client_id":             "reading",
+		"redirect_uri":          redirectURL,
+		"state":                 state,
+		"nonce":                 nonce,
+		"code_challenge":        CodeChallenge(verifier),
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	if q.Get("code_challenge") == verifier {
+		t.Error("the verifier itself was sent")
+	}
+
+	authorize := func() string {
+		back, err := idp.Authorize(authURL, jwt.MapClaims{"sub": "u-1", "email": "reader@example.com", "email_verified": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back.Query().Get("state") != state {
+			t.Fatalf("state = %q, want %q", back.Query().Get("state"), state)
+		}
+		return back.Query().Get("code")
+	}
+
+	claims, err := p.Exchange(ctx, authorize(), verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "u-1" || claims.Email != "reader@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if _, err := p.Exchange(ctx, authorize(), "another verifier", nonce); err == nil {
+		t.Error("Exchange with the wrong PKCE verifier succeeded")
+	}
+	if _, err := p.Exchange(ctx, authorize(), verifier, "another nonce"); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("Exchange with the wrong nonce = %v, want a nonce error", err)
+	}
+	code := authorize()
+	if _, err := p.Exchange(ctx, code, verifier, nonce); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, verifier, nonce); err == nil {
+		t.Error("a code was exchanged twice")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	idp, p := newTestProvider(t)
+	now := time.Now()
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		err    string
+	}{
+		{"valid", jwt.MapClaims{}, ""},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}, "wrong issuer"},
+		{"no issuer", jwt.MapClaims{"iss": nil}, "wrong issuer"},
+		{"wrong audience", jwt.MapClaims{"aud": "another client"}, "wrong audience"},
+		{"audiences without azp", jwt.MapClaims{"aud": []string{"reading", "another client"}}, "wrong audience"},
+		{"audiences with azp", jwt.MapClaims{"aud": []string{"reading", "another client"}, "azp": "reading"}, ""},
+		{"expired", jwt.MapClaims{"exp": now.Add(-2 * leeway).Unix()}, "expired"},
+		{"expired within leeway", jwt.MapClaims{"exp": now.Add(-leeway / 2).Unix()}, ""},
+		{"no expiry", jwt.MapClaims{"exp": nil}, "expired"},
+		{"issued in the future", jwt.MapClaims{"iat": now.Add(2 * leeway).Unix()}, "future"},
+		{"wrong nonce", jwt.MapClaims{"nonce": "another nonce"}, "wrong nonce"},
+		{"no nonce", jwt.MapClaims{"nonce": nil}, "wrong nonce"},
+		{"no subject", jwt.MapClaims{"sub": nil}, "no subject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "u-1", "nonce": "the nonce"}
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			_, err := p.Verify(context.Background(), idp.IDToken(claims), "the nonce")
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Verify: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("Verify = %v, want an error saying %q", err, tt.err)
+			}
+		})
+	}
+
+	t.Run("not signed by the provider", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss": idp.URL, "aud": "reading", "sub": "u-1", "nonce": "the nonce",
+			"iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		})
+		raw, _ := token.SignedString([]byte("client secret"))
+		if _, err := p.Verify(context.Background(), raw, "the nonce"); err == nil {
+			t.Error("Verify accepted an HMAC signed token")
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	idp, p := newTestProvider(t)
+	ctx := context.Background()
+	claims := jwt.MapClaims{"sub": "u-1", "nonce": "n"}
+	if _, err := p.Verify(ctx, idp.IDToken(claims), "n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(ctx, idp.IDToken(claims), "n"); err != nil {
+		t.Fatal(err)
+	}
+	if n := idp.KeyFetches(); n != 1 {
+		t.Fatalf("keys fetched %d times, want once", n)
+	}
+
+	idp.RotateKey()
+	rotated := idp.IDToken(claims)
+	// Right after a fetch unknown keys are refused without asking again
+	if _, err := p.Verify(ctx, rotated, "n"); err == nil {
+		t.Fatal("Verify accepted an unknown key without refetching")
+	}
+	if n := idp.KeyFetches(); n != 1 {
+		t.Fatalf("keys fetched %d times, want once", n)
+	}
+
+	p.keys.fetched = time.Now().Add(-minRefresh)
+	if _, err := p.Verify(ctx, rotated, "n"); err != nil {
+		t.Fatalf("Verify after rotation: %v", err)
+	}
+	if n := idp.KeyFetches(); n != 2 {
+		t.Errorf("keys fetched %d times, want twice", n)
+	}
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,73 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// breached is a short list of the passwords most often found in public
+// breach dumps. Deployments can add a longer one with AddFile.
+//
+//go:embed breached.txt
+var breached []byte
+
+// List is a set of passwords, matched case-insensitively.
+type List struct {
+	set map[string]struct{}
+}
+
+// DefaultList returns the built-in list.
+func DefaultList() *List {
+	l := &List{set: make(map[string]struct{})}
+	// The embedded file is known to be well formed
+	_ = l.add(bytes.NewReader(breached))
+	return l
+}
+
+// AddFile adds the passwords in the file at path, one per line. Blank
+// lines and lines starting with # are skipped.
+func (l *List) AddFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := l.add(f); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+func (l *List) add(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l.set[strings.ToLower(line)] = struct{}{}
+	}
+	return sc.Err()
+}
+
+// Contains reports whether password is on the list.
+func (l *List) Contains(password string) bool {
+	if l == nil {
+		return false
+	}
+	_, ok := l.set[strings.ToLower(password)]
+	return ok
+}
+
+// Len returns the number of passwords on the list.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.set)
+}
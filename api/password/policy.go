@@ -0,0 +1,73 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy is the set of rules a new password must satisfy.
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Breached lists passwords known from leaks, refused whatever the
+	// other rules say. Nil disables the check.
+	Breached *List
+}
+
+var ErrBreached = errors.New("Password is too common, it appears in known data breaches")
+
+// Check returns the first rule password breaks, or nil. Personal lists
+// values such as the email and nickname the password must not contain.
+func (p *Policy) Check(password string, personal ...string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("Password must be at most %d bytes", p.MaxLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return errors.New("Password must contain an upper case letter")
+	case p.RequireLower && !lower:
+		return errors.New("Password must contain a lower case letter")
+	case p.RequireDigit && !digit:
+		return errors.New("Password must contain a digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("Password must contain a symbol")
+	}
+	lowered := strings.ToLower(password)
+	for _, v := range personal {
+		// For an email only the part before @ is personal
+		if i := strings.IndexByte(v, '@'); i >= 0 {
+			v = v[:i]
+		}
+		v = strings.ToLower(strings.TrimSpace(v))
+		if len(v) >= 3 && strings.Contains(lowered, v) {
+			return errors.New("Password must not contain your email or nickname")
+		}
+	}
+	if p.Breached.Contains(password) {
+		return ErrBreached
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+// Package proto holds the protobuf definitions of the gRPC API. The Go code
+// in reading/v1 is generated from them with buf, protoc-gen-go and
+// protoc-gen-go-grpc:
+//
+//	go generate ./api/proto
+package proto
+
+//go:generate buf generate
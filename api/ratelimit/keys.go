@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/serg2013/reading/api/auth"
+)
+
+// ByIP groups requests by client address.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByUser groups requests by the authenticated user.
+func ByUser(r *http.Request) string {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil || uid == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d", uid)
+}
+
+// maxLoginPeek bounds how much of a login body ByLoginEmail reads.
+const maxLoginPeek = 1 << 16
+
+// ByLoginEmail groups login requests by the account they try. The body is
+// left intact for the handler, which also answers bodies too large to
+// peek at; those are only limited by the other rules, such as ByIP.
+func ByLoginEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxLoginPeek+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > maxLoginPeek {
+		return ""
+	}
+	creds := struct {
+		Email string `json:"email"`
+	}{}
+	if json.Unmarshal(body, &creds) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(creds.Email))
+}
+
+// readCloser reads the bytes peeked at before the rest of a body, and
+// closes the body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
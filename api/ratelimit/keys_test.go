@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestByLoginEmailKeepsTheBody(t *testing.T) {
+	large := `{"email":"a@example.com","password":"` + strings.Repeat("x", maxLoginPeek) + `"}`
+	tests := []struct {
+		name string
+		body string
+		key  string
+	}{
+		{"email", `{"email":" User@Example.com ","password":"secret"}`, "user@example.com"},
+		{"no email", `{"password":"secret"}`, ""},
+		{"not json", `email=a@example.com`, ""},
+		{"too large to peek at", large, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/login", strings.NewReader(tt.body))
+			if key := ByLoginEmail(r); key != tt.key {
+				t.Errorf("key = %q, want %q", key, tt.key)
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body has %d bytes left, want all %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
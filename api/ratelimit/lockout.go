@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"strings"
+	"time"
+)
+
+// Attempts counts recent failed logins for an account.
+type Attempts struct {
+	Count int
+	Last  time.Time
+}
+
+// AttemptStore keeps failed login counts. Failures older than window are
+// forgotten.
+type AttemptStore interface {
+	AddFailure(key string, now time.Time, window time.Duration) (Attempts, error)
+	Attempts(key string, now time.Time, window time.Duration) (Attempts, error)
+	ResetFailures(key string) error
+}
+
+// LoginGuard slows down and then locks out repeated failed logins for an
+// account. After DelayAfter failures each attempt must wait BaseDelay,
+// doubling per further failure up to MaxDelay; after LockAfter failures the
+// account is locked for LockFor.
+type LoginGuard struct {
+	Store      AttemptStore
+	DelayAfter int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	LockAfter  int
+	LockFor    time.Duration
+}
+
+func accountKey(account string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+// Wait returns how long account must wait before it may try to log in
+// again, or zero.
+func (g *LoginGuard) Wait(account string) (time.Duration, error) {
+	now := time.Now()
+	a, err := g.Store.Attempts(accountKey(account), now, g.LockFor)
+	if err != nil {
+		return 0, err
+	}
+	if wait := g.penalty(a.Count) - now.Sub(a.Last); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Failed records a failed login for account.
+func (g *LoginGuard) Failed(account string) error {
+	_, err := g.Store.AddFailure(accountKey(account), time.Now(), g.LockFor)
+	return err
+}
+
+// Succeeded clears the failures of account.
+func (g *LoginGuard) Succeeded(account string) error {
+	return g.Store.ResetFailures(accountKey(account))
+}
+
+// penalty is the wait imposed after n consecutive failures.
+func (g *LoginGuard) penalty(n int) time.Duration {
+	switch {
+	case g.LockAfter > 0 && n >= g.LockAfter:
+		return g.LockFor
+	case g.DelayAfter > 0 && n >= g.DelayAfter:
+		d := g.BaseDelay
+		for i := g.DelayAfter; i < n && d < g.MaxDelay; i++ {
+			d *= 2
+		}
+		if d > g.MaxDelay {
+			d = g.MaxDelay
+		}
+		return d
+	}
+	return 0
+}
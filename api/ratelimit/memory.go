@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets and login failures in process memory. Entries
+// idle for longer than an hour are dropped.
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	failures map[string]*Attempts
+	swept    time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+const idleTTL = time.Hour
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  map[string]*bucket{},
+		failures: map[string]*Attempts{},
+	}
+}
+
+func (m *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+	var res Result
+	b.tokens, res = take(b.tokens, b.last, now, limit)
+	b.last = now
+	return res, nil
+}
+
+func (m *MemoryStore) AddFailure(key string, now time.Time, window time.Duration) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	a, ok := m.failures[key]
+	if !ok || now.Sub(a.Last) > window {
+		a = &Attempts{}
+		m.failures[key] = a
+	}
+	a.Count++
+	a.Last = now
+	return *a, nil
+}
+
+func (m *MemoryStore) Attempts(key string, now time.Time, window time.Duration) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.failures[key]
+	if !ok || now.Sub(a.Last) > window {
+		return Attempts{}, nil
+	}
+	return *a, nil
+}
+
+func (m *MemoryStore) ResetFailures(key string) error {
+	m.mu.Lock()
+	delete(m.failures, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// sweep drops idle entries at most once a minute. m.mu must be held.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for k, b := range m.buckets {
+		if now.Sub(b.last) > idleTTL {
+			delete(m.buckets, k)
+		}
+	}
+	for k, a := range m.failures {
+		if now.Sub(a.Last) > idleTTL {
+			delete(m.failures, k)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate
+// requests per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a limit of n requests per minute with a burst of n.
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// Result describes the state of a bucket after a request was counted.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, or zero.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. MemoryStore serves a single process; a
+// shared implementation (e.g. Redis) lets several replicas enforce one
+// limit.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Rule applies a limit to requests grouped by Key. A Key returning ""
+// means the rule does not apply to the request.
+type Rule struct {
+	Name  string
+	Limit Limit
+	Key   func(r *http.Request) string
+}
+
+// Limiter checks requests against a set of rules.
+type Limiter struct {
+	store Store
+	rules []Rule
+}
+
+func NewLimiter(store Store, rules ...Rule) *Limiter {
+	return &Limiter{store: store, rules: rules}
+}
+
+// Allow counts r against every rule and returns the most restrictive
+// result: a denial if any rule denies, otherwise the one with the fewest
+// remaining requests.
+func (l *Limiter) Allow(r *http.Request) (Result, error) {
+	best := Result{Allowed: true, Remaining: math.MaxInt32}
+	now := time.Now()
+	for _, rule := range l.rules {
+		if rule.Limit.Burst <= 0 {
+			continue
+		}
+		key := rule.Key(r)
+		if key == "" {
+			continue
+		}
+		res, err := l.store.Take(rule.Name+":"+key, rule.Limit, now)
+		if err != nil {
+			return Result{}, err
+		}
+		switch {
+		case !res.Allowed && (best.Allowed || res.RetryAfter > best.RetryAfter):
+			best = res
+		case res.Allowed && best.Allowed && res.Remaining < best.Remaining:
+			best = res
+		}
+	}
+	if best.Remaining == math.MaxInt32 {
+		best.Remaining = 0
+	}
+	return best, nil
+}
+
+// take updates a bucket holding tokens at last and reports the result.
+func take(tokens float64, last, now time.Time, limit Limit) (float64, Result) {
+	burst := float64(limit.Burst)
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*limit.Rate)
+	}
+	res := Result{Limit: limit.Burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else if limit.Rate > 0 {
+		res.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	} else {
+		res.RetryAfter = time.Hour
+	}
+	res.Remaining = int(tokens)
+	if limit.Rate > 0 {
+		res.Reset = seconds((burst - tokens) / limit.Rate)
+	}
+	return tokens, res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -1,9 +1,15 @@
 package seed
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/logger"
 	"github.com/serg2013/reading/api/models"
 )
 
@@ -11,12 +17,11 @@ var users = []models.User{
 	{
 		Nickname: "user1",
 		Email:    "user1@gmail.com",
-		Password: "password",
+		IsAdmin:  true,
 	},
 	{
 		Nickname: "user2",
 		Email:    "user2@gmail.com",
-		Password: "password",
 	},
 }
 
@@ -63,38 +68,55 @@ var books = []models.Book{
 
 func Load(db *gorm.DB) {
 
-	err := db.Debug().DropTableIfExists(&models.Book{}, &models.Author{}, &models.User{}).Error
-	if err != nil {
-		log.Fatalf("cannot drop table: %v", err)
-	}
-	err = db.Debug().AutoMigrate(&models.User{}, &models.Author{}, &models.Book{}).Error
-	if err != nil {
-		log.Fatalf("cannot migrate table: %v", err)
+	tables := models.Tables()
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := db.DropTableIfExists(tables[i]).Error; err != nil {
+			logger.Fatal(context.Background(), "cannot drop table", logger.Fields{"error": err})
+		}
 	}
-	err = db.Debug().Model(&models.Book{}).AddForeignKey("author_id", "authors(id)", "cascade", "cascade").Error
+	err := models.Migrate(db)
 	if err != nil {
-		log.Fatalf("attaching foreign key error: %v", err)
+		logger.Fatal(context.Background(), "cannot migrate table", logger.Fields{"error": err})
 	}
 
+	// The seeded addresses count as verified. The passwords are new on
+	// every seeding, so no sample account has a known one; they go to the
+	// terminal once, since the log redacts them.
+	verified := time.Now()
 	for i, _ := range users {
-		err = db.Debug().Model(&models.User{}).Create(&users[i]).Error
+		password, err := randomPassword()
 		if err != nil {
-			log.Fatalf("cannot seed users table: %v", err)
+			logger.Fatal(context.Background(), "cannot generate a password", logger.Fields{"error": err})
 		}
+		users[i].Password = password
+		users[i].EmailVerifiedAt = &verified
+		err = db.Model(&models.User{}).Create(&users[i]).Error
+		if err != nil {
+			logger.Fatal(context.Background(), "cannot seed users table", logger.Fields{"error": err})
+		}
+		fmt.Fprintf(os.Stderr, "seeded user %s (admin: %v) with password %s\n", users[i].Email, users[i].IsAdmin, password)
 	}
 
 	for i, _ := range authors {
-		err = db.Debug().Model(&models.Author{}).Create(&authors[i]).Error
+		err = db.Model(&models.Author{}).Create(&authors[i]).Error
 		if err != nil {
-			log.Fatalf("cannot seed authors table: %v", err)
+			logger.Fatal(context.Background(), "cannot seed authors table", logger.Fields{"error": err})
 		}
 
 		books[i].AuthorID = authors[i].ID
 
-		err = db.Debug().Model(&models.Book{}).Create(&books[i]).Error
+		err = db.Model(&models.Book{}).Create(&books[i]).Error
 		if err != nil {
-			log.Fatalf("cannot seed books table: %v", err)
+			logger.Fatal(context.Background(), "cannot seed books table", logger.Fields{"error": err})
 		}
 
 	}
 }
+
+func randomPassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -1,39 +1,41 @@
 package api
 
 import (
-	"fmt"
-	"log"
+	"context"
 	"os"
 
-	"github.com/joho/godotenv"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/config"
 	"github.com/serg2013/reading/api/controllers"
+	"github.com/serg2013/reading/api/logger"
 	"github.com/serg2013/reading/api/seed"
 )
 
 var server = controllers.Server{}
 
-func init() {
-	// loads values from .env into the system
-	if err := godotenv.Load(); err != nil {
-		log.Print("bad .env file found")
-	}
-}
-
 // Main run point
 func Run() {
 
-	var err error
-	err = godotenv.Load()
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatalf("Error getting env, %v", err)
-	} else {
-		fmt.Println("We are getting the env values")
+		logger.Fatal(context.Background(), "cannot load configuration", logger.Fields{"error": err})
 	}
 
-	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_PORT"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
+	level, _ := logger.ParseLevel(cfg.Log.Level)
+	logger.SetLevel(level)
+	logger.Info(context.Background(), "configuration loaded", logger.Fields{"config": cfg})
 
-	seed.Load(server.DB)
+	auth.Configure(cfg.Auth.Secret.Value(), cfg.Auth.TokenTTL)
+	auth.AllowQueryTokens(cfg.Auth.QueryTokenRoutes)
+
+	server.Initialize(cfg)
+
+	// Initialize migrated the tables; seeding starts them over
+	if cfg.Dev.Seed {
+		logger.Warn(context.Background(), "dev.seed is on: replacing the database with sample data", nil)
+		seed.Load(server.DB)
+	}
 
-	server.Run(":8080")
+	server.Run()
 
 }
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/models"
+)
+
+var ErrAlreadyVerified = errors.New("Email already verified")
+
+// RequestPasswordReset returns the user with email and a new password reset
+// token valid for ttl. It returns ErrNotFound if no user has that email.
+func (s *Service) RequestPasswordReset(email string, ttl time.Duration) (*models.User, string, error) {
+	user := models.User{}
+	err := s.db.Model(&models.User{}).Where("email = ?", email).Take(&user).Error
+	if err != nil {
+		return nil, "", notFound(err)
+	}
+	token, err := models.IssueUserToken(s.db, user.ID, models.TokenPasswordReset, ttl)
+	if err != nil {
+		return nil, "", err
+	}
+	return &user, token, nil
+}
+
+// ResetPassword sets password for the user a reset token was issued to and
+// uses up the token. Following the mailed link also proves the user owns
+// the email, so it counts as verified.
+func (s *Service) ResetPassword(token, password string) error {
+	return models.Transaction(s.db, func(tx *gorm.DB) error {
+		uid, err := models.ConsumeUserToken(tx, token, models.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		user := models.User{}
+		if err := user.SetPassword(tx, uid, password); err != nil {
+			return notFound(err)
+		}
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+		return user.MarkEmailVerified(tx, uid)
+	})
+}
+
+// StartEmailVerification returns user uid and a new verification token
+// valid for ttl. It returns ErrAlreadyVerified if there is nothing to do.
+func (s *Service) StartEmailVerification(uid uint32, ttl time.Duration) (*models.User, string, error) {
+	user := models.User{}
+	found, err := user.FindUserByID(s.db, uid)
+	if err != nil {
+		return nil, "", notFound(err)
+	}
+	if found.EmailVerifiedAt != nil {
+		return nil, "", ErrAlreadyVerified
+	}
+	token, err := models.IssueUserToken(s.db, uid, models.TokenEmailVerification, ttl)
+	if err != nil {
+		return nil, "", err
+	}
+	return found, token, nil
+}
+
+// VerifyEmail marks the email of the user a verification token was issued
+// to as verified and uses up the token.
+func (s *Service) VerifyEmail(token string) error {
+	return models.Transaction(s.db, func(tx *gorm.DB) error {
+		uid, err := models.ConsumeUserToken(tx, token, models.TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+		user := models.User{}
+		return notFound(user.MarkEmailVerified(tx, uid))
+	})
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/models"
+)
+
+// MaxAPIKeys is how many API keys one user may have.
+const MaxAPIKeys = 25
+
+var ErrTooManyAPIKeys = errors.New("Too many API keys, revoke one first")
+
+// CreateAPIKey creates a key for user uid and returns it together with the
+// key itself, which is not stored and cannot be shown again.
+func (s *Service) CreateAPIKey(uid uint32, name string, scopes []string, expiresAt time.Time) (*models.APIKey, string, error) {
+	key := &models.APIKey{
+		UserID:    uid,
+		Name:      name,
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	}
+	var raw string
+	err := models.Transaction(s.db, func(tx *gorm.DB) error {
+		count, err := key.CountAPIKeys(tx, uid)
+		if err != nil {
+			return err
+		}
+		if count >= MaxAPIKeys {
+			return ErrTooManyAPIKeys
+		}
+		raw, err = key.SaveAPIKey(tx, auth.APIKeyPrefix)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, raw, nil
+}
+
+func (s *Service) ListAPIKeys(uid uint32) (*[]models.APIKey, error) {
+	key := models.APIKey{}
+	return key.FindAPIKeys(s.db, uid)
+}
+
+// DeleteAPIKey revokes key id of user uid.
+func (s *Service) DeleteAPIKey(id, uid uint32) error {
+	key := models.APIKey{}
+	return notFound(key.DeleteAPIKey(s.db, id, uid))
+}
+
+// AuthenticateAPIKey returns who key acts for. It returns
+// auth.ErrInvalidAPIKey for unknown, revoked and expired keys.
+func (s *Service) AuthenticateAPIKey(raw string) (*auth.Principal, error) {
+	key := models.APIKey{}
+	found, err := key.CheckAPIKey(s.db, auth.APIKeyPrefix, raw)
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(found.ExpiresAt) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	return &auth.Principal{UserID: found.UserID, APIKeyID: found.ID, Scopes: found.ScopeList()}, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import "github.com/serg2013/reading/api/models"
+
+func (s *Service) CreateAuthor(author *models.Author) (*models.Author, error) {
+	return author.SaveAuthor(s.db)
+}
+
+// CreateAuthorWithBook creates an author together with their first book.
+// Either both rows are stored or neither is.
+func (s *Service) CreateAuthorWithBook(author *models.Author, book *models.Book) (*models.Author, *models.Book, error) {
+	err := s.WithTx(func(tx *Service) error {
+		var err error
+		if author, err = tx.CreateAuthor(author); err != nil {
+			return err
+		}
+		book.AuthorID = author.ID
+		book, err = tx.CreateBook(book)
+		return err
+	})
+	if err != nil {
+		return &models.Author{}, &models.Book{}, err
+	}
+	return author, book, nil
+}
+
+func (s *Service) ListAuthors(q models.Query) (*[]models.Author, error) {
+	author := models.Author{}
+	return author.FindAllAuthors(s.db, q)
+}
+
+func (s *Service) GetAuthor(uid uint32, q models.Query) (*models.Author, error) {
+	author := models.Author{}
+	found, err := author.FindAuthorByID(s.db, uid, q)
+	return found, notFound(err)
+}
+
+// AuthorsByID returns the authors with the given IDs, for callers that
+// would otherwise look them up one at a time.
+func (s *Service) AuthorsByID(ids []uint32, q models.Query) (map[uint32]models.Author, error) {
+	author := models.Author{}
+	return author.FindAuthorsByIDs(s.db, ids, q)
+}
+
+func (s *Service) UpdateAuthor(uid uint32, author *models.Author) (*models.Author, error) {
+	updated, err := author.UpdateAuthor(s.db, uid)
+	return updated, notFound(err)
+}
+
+func (s *Service) DeleteAuthor(uid uint32) error {
+	author := models.Author{}
+	_, err := author.DeleteAuthor(s.db, uid)
+	return notFound(err)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/models"
+)
+
+func (s *Service) CreateBook(book *models.Book) (*models.Book, error) {
+	return book.SaveBook(s.db)
+}
+
+func (s *Service) ListBooks(q models.Query) (*[]models.Book, error) {
+	book := models.Book{}
+	return book.FindAllBooks(s.db, q)
+}
+
+func (s *Service) GetBook(pid uint64, q models.Query) (*models.Book, error) {
+	book := models.Book{}
+	found, err := book.FindBookByID(s.db, pid, q)
+	return found, notFound(err)
+}
+
+// BooksByAuthor returns the books of the given authors, for callers that
+// would otherwise look them up one author at a time.
+func (s *Service) BooksByAuthor(ids []uint32, q models.Query) (map[uint32][]models.Book, error) {
+	book := models.Book{}
+	return book.FindBooksByAuthorIDs(s.db, ids, q)
+}
+
+// UpdateBook replaces the title, content and author of book pid on behalf
+// of author uid, who must own it.
+func (s *Service) UpdateBook(pid uint64, uid uint32, update *models.Book) (*models.Book, error) {
+	var updated *models.Book
+	err := models.Transaction(s.db, func(tx *gorm.DB) error {
+		book, err := ownedBook(tx, pid, uid)
+		if err != nil {
+			return err
+		}
+		update.ID = book.ID
+		updated, err = update.UpdateABook(tx)
+		return err
+	})
+	if err != nil {
+		return &models.Book{}, err
+	}
+	return updated, nil
+}
+
+// DeleteBook removes book pid on behalf of author uid, who must own it.
+func (s *Service) DeleteBook(pid uint64, uid uint32) error {
+	return models.Transaction(s.db, func(tx *gorm.DB) error {
+		book, err := ownedBook(tx, pid, uid)
+		if err != nil {
+			return err
+		}
+		_, err = book.DeleteABook(tx, pid, uid)
+		return notFound(err)
+	})
+}
+
+func ownedBook(tx *gorm.DB, pid uint64, uid uint32) (*models.Book, error) {
+	book := models.Book{}
+	err := tx.Model(&models.Book{}).Where("id = ?", pid).Take(&book).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if book.AuthorID != uid {
+		return nil, ErrUnauthorized
+	}
+	return &book, nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/models"
+)
+
+var (
+	ErrEmailNotVerifiedByProvider = errors.New("The identity provider has not verified this email")
+	ErrUnverifiedAccount          = errors.New("An account with this email exists but its email is not verified; reset its password first")
+	ErrSignupDisabled             = errors.New("No account with this email exists")
+)
+
+// ExternalUser is a user as asserted by an identity provider.
+type ExternalUser struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// Nickname is the preferred name for a new account.
+	Nickname string
+}
+
+// SignInExternal returns the user an identity provider vouched for. A
+// known provider account signs in as the user it is linked to. Otherwise
+// it is linked to the user with the same verified email, or, with
+// allowSignup, to a new user.
+func (s *Service) SignInExternal(ext ExternalUser, allowSignup bool) (*models.User, error) {
+	var signedIn *models.User
+	err := models.Transaction(s.db, func(tx *gorm.DB) error {
+		identity, err := models.FindExternalIdentity(tx, ext.Issuer, ext.Subject)
+		if err == nil {
+			user := models.User{}
+			signedIn, err = user.FindUserByID(tx, identity.UserID)
+			return notFound(err)
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		if !ext.EmailVerified || ext.Email == "" {
+			return ErrEmailNotVerifiedByProvider
+		}
+		user := models.User{}
+		err = tx.Model(&models.User{}).Where("LOWER(email) = ?", strings.ToLower(ext.Email)).Take(&user).Error
+		switch {
+		case err == nil:
+			// Someone may have signed up with this address without owning
+			// it. Linking would let them in with their password too.
+			if user.EmailVerifiedAt == nil {
+				return ErrUnverifiedAccount
+			}
+		case gorm.IsRecordNotFoundError(err):
+			if !allowSignup {
+				return ErrSignupDisabled
+			}
+			created, err := provisionUser(tx, ext)
+			if err != nil {
+				return err
+			}
+			user = *created
+		default:
+			return err
+		}
+		link := models.ExternalIdentity{
+			UserID:  user.ID,
+			Issuer:  ext.Issuer,
+			Subject: ext.Subject,
+			Email:   ext.Email,
+		}
+		if err := link.SaveExternalIdentity(tx); err != nil {
+			return err
+		}
+		signedIn = &user
+		return nil
+	})
+	return signedIn, err
+}
+
+// provisionUser creates the account of a user first signing in through an
+// identity provider. It gets an unusable random password: the user can
+// set one through password reset.
+func provisionUser(tx *gorm.DB, ext ExternalUser) (*models.User, error) {
+	nickname, err := freeNickname(tx, ext)
+	if err != nil {
+		return nil, err
+	}
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	verified := time.Now()
+	user := models.User{
+		Nickname:        nickname,
+		Email:           ext.Email,
+		Password:        hex.EncodeToString(password),
+		EmailVerifiedAt: &verified,
+	}
+	return user.SaveUser(tx)
+}
+
+// freeNickname returns the preferred nickname, or the email's local part,
+// with a number appended if another user has it.
+func freeNickname(tx *gorm.DB, ext ExternalUser) (string, error) {
+	base := strings.TrimSpace(ext.Nickname)
+	if base == "" {
+		base = strings.SplitN(ext.Email, "@", 2)[0]
+	}
+	base = html.EscapeString(base)
+	for i := 1; i <= 100; i++ {
+		nickname := base
+		if i > 1 {
+			nickname = fmt.Sprintf("%s%d", base, i)
+		}
+		var count int
+		err := tx.Model(&models.User{}).Where("nickname = ?", nickname).Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return nickname, nil
+		}
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/auth"
+	"github.com/serg2013/reading/api/models"
+	"github.com/serg2013/reading/api/totp"
+)
+
+var (
+	ErrMFAEnabled    = errors.New("Two-factor authentication is already enabled")
+	ErrMFANotEnabled = errors.New("Two-factor authentication is not enabled")
+	ErrMFANotStarted = errors.New("Two-factor enrollment has not been started")
+)
+
+// EnrollTOTP gives user uid a new TOTP secret and returns it with its
+// provisioning URI. Login does not ask for codes until ConfirmTOTP.
+func (s *Service) EnrollTOTP(uid uint32, issuer string) (string, string, error) {
+	user := models.User{}
+	found, err := user.FindUserByID(s.db, uid)
+	if err != nil {
+		return "", "", notFound(err)
+	}
+	if found.TOTPEnabled {
+		return "", "", ErrMFAEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := user.SetTOTPSecret(s.db, uid, secret); err != nil {
+		return "", "", notFound(err)
+	}
+	return secret, totp.ProvisioningURI(issuer, found.Email, secret), nil
+}
+
+// ConfirmTOTP turns on two-factor login for user uid once code shows their
+// app has the pending secret, and returns the first recovery codes.
+func (s *Service) ConfirmTOTP(uid uint32, code string) ([]string, error) {
+	var codes []string
+	err := models.Transaction(s.db, func(tx *gorm.DB) error {
+		user := models.User{}
+		found, err := user.FindUserByID(tx, uid)
+		if err != nil {
+			return notFound(err)
+		}
+		switch {
+		case found.TOTPEnabled:
+			return ErrMFAEnabled
+		case found.TOTPSecret == "":
+			return ErrMFANotStarted
+		}
+		if err := useTOTPCode(tx, found, code); err != nil {
+			return err
+		}
+		if err := user.EnableTOTP(tx, uid); err != nil {
+			return err
+		}
+		codes, err = models.ReplaceRecoveryCodes(tx, uid)
+		return err
+	})
+	return codes, err
+}
+
+// VerifySecondFactor checks code, from the authenticator app or a recovery
+// code, for user uid and returns the authentication methods to record in
+// the access token.
+func (s *Service) VerifySecondFactor(uid uint32, code string) ([]string, error) {
+	var amr []string
+	err := models.Transaction(s.db, func(tx *gorm.DB) error {
+		user := models.User{}
+		found, err := user.FindUserByID(tx, uid)
+		if err != nil {
+			return notFound(err)
+		}
+		if !found.TOTPEnabled {
+			return ErrMFANotEnabled
+		}
+		amr, err = useSecondFactor(tx, found, code)
+		return err
+	})
+	return amr, err
+}
+
+// DisableTOTP turns off two-factor login for user uid, who must give a
+// current code or a recovery code.
+func (s *Service) DisableTOTP(uid uint32, code string) error {
+	return models.Transaction(s.db, func(tx *gorm.DB) error {
+		user := models.User{}
+		found, err := user.FindUserByID(tx, uid)
+		if err != nil {
+			return notFound(err)
+		}
+		if !found.TOTPEnabled {
+			return ErrMFANotEnabled
+		}
+		if _, err := useSecondFactor(tx, found, code); err != nil {
+			return err
+		}
+		return user.DisableTOTP(tx, uid)
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of user uid, who
+// must give a current code or a recovery code.
+func (s *Service) RegenerateRecoveryCodes(uid uint32, code string) ([]string, error) {
+	var codes []string
+	err := models.Transaction(s.db, func(tx *gorm.DB) error {
+		user := models.User{}
+		found, err := user.FindUserByID(tx, uid)
+		if err != nil {
+			return notFound(err)
+		}
+		if !found.TOTPEnabled {
+			return ErrMFANotEnabled
+		}
+		if _, err := useSecondFactor(tx, found, code); err != nil {
+			return err
+		}
+		codes, err = models.ReplaceRecoveryCodes(tx, uid)
+		return err
+	})
+	return codes, err
+}
+
+// useSecondFactor accepts a TOTP code or, failing that, a recovery code.
+func useSecondFactor(tx *gorm.DB, user *models.User, code string) ([]string, error) {
+	if err := useTOTPCode(tx, user, code); err == nil {
+		return []string{auth.AMRPassword, auth.AMROTP, auth.AMRMFA}, nil
+	} else if !errors.Is(err, models.ErrInvalidCode) {
+		return nil, err
+	}
+	if err := models.UseRecoveryCode(tx, user.ID, code); err != nil {
+		return nil, err
+	}
+	return []string{auth.AMRPassword, auth.AMRMFA}, nil
+}
+
+func useTOTPCode(tx *gorm.DB, user *models.User, code string) error {
+	step, ok := totp.Validate(user.TOTPSecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return models.ErrInvalidCode
+	}
+	return user.UseTOTPStep(tx, user.ID, step)
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/models"
+)
+
+var (
+	ErrNotFound     = errors.New("Not found")
+	ErrUnauthorized = errors.New("Unauthorized")
+)
+
+// Service implements the application use cases on top of the models. Every
+// write runs in a single transaction that is rolled back as a whole if any
+// step fails.
+type Service struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// WithTx runs fn with a Service bound to one transaction, so several use
+// cases can be committed or rolled back together.
+func (s *Service) WithTx(fn func(tx *Service) error) error {
+	return models.Transaction(s.db, func(tx *gorm.DB) error {
+		return fn(New(tx))
+	})
+}
+
+func notFound(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrNotFound
+	}
+	return err
+}
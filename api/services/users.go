@@ -0,0 +1,29 @@
+package services
+
+import "github.com/serg2013/reading/api/models"
+
+func (s *Service) CreateUser(user *models.User) (*models.User, error) {
+	return user.SaveUser(s.db)
+}
+
+func (s *Service) ListUsers(q models.Query) (*[]models.User, error) {
+	user := models.User{}
+	return user.FindAllUsers(s.db, q)
+}
+
+func (s *Service) GetUser(uid uint32) (*models.User, error) {
+	user := models.User{}
+	found, err := user.FindUserByID(s.db, uid)
+	return found, notFound(err)
+}
+
+func (s *Service) UpdateUser(uid uint32, user *models.User) (*models.User, error) {
+	updated, err := user.UpdateAUser(s.db, uid)
+	return updated, notFound(err)
+}
+
+func (s *Service) DeleteUser(uid uint32) error {
+	user := models.User{}
+	_, err := user.DeleteAUser(s.db, uid)
+	return notFound(err)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/serg2013/reading/api/models"
+)
+
+// webhookSecretPrefix starts generated webhook secrets.
+const webhookSecretPrefix = "whsec_"
+
+// CreateWebhook subscribes url to events on behalf of admin uid. Without a
+// secret one is generated. The secret is returned, as it is not shown
+// again.
+func (s *Service) CreateWebhook(uid uint32, url, secret string, events []string) (*models.Webhook, string, error) {
+	if secret == "" {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, "", err
+		}
+		secret = webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	}
+	hook := &models.Webhook{
+		URL:       url,
+		Secret:    secret,
+		Events:    strings.Join(events, " "),
+		CreatedBy: uid,
+	}
+	created, err := hook.SaveWebhook(s.db)
+	if err != nil {
+		return nil, "", err
+	}
+	return created, secret, nil
+}
+
+func (s *Service) ListWebhooks() (*[]models.Webhook, error) {
+	hook := models.Webhook{}
+	return hook.FindWebhooks(s.db)
+}
+
+func (s *Service) GetWebhook(id uint32) (*models.Webhook, error) {
+	hook := models.Webhook{}
+	found, err := hook.FindWebhookByID(s.db, id)
+	return found, notFound(err)
+}
+
+// UpdateWebhook replaces the URL and events of webhook id, and its secret
+// unless secret is empty.
+func (s *Service) UpdateWebhook(id uint32, url, secret string, events []string) (*models.Webhook, error) {
+	hook := &models.Webhook{
+		URL:    url,
+		Secret: secret,
+		Events: strings.Join(events, " "),
+	}
+	updated, err := hook.UpdateAWebhook(s.db, id)
+	return updated, notFound(err)
+}
+
+// DeleteWebhook deletes webhook id. Its queued events are dropped.
+func (s *Service) DeleteWebhook(id uint32) error {
+	hook := models.Webhook{}
+	_, err := hook.DeleteAWebhook(s.db, id)
+	return notFound(err)
+}
+
+// ListWebhookDeliveries returns the latest deliveries to webhook id.
+func (s *Service) ListWebhookDeliveries(id uint32, filter models.DeliveryFilter) (*[]models.WebhookDelivery, error) {
+	if _, err := s.GetWebhook(id); err != nil {
+		return nil, err
+	}
+	delivery := models.WebhookDelivery{}
+	return delivery.FindDeliveries(s.db, id, filter)
+}
+
+// RedeliverWebhook sends delivery id of webhook hook again, also when it
+// was delivered or is dead.
+func (s *Service) RedeliverWebhook(hook uint32, id uint64) (*models.WebhookDelivery, error) {
+	delivery := models.WebhookDelivery{}
+	found, err := delivery.Redeliver(s.db, hook, id)
+	return found, notFound(err)
+}
+
+// QueueWebhooks queues event e for the webhooks subscribed to it. It may be
+// called again for the same event.
+func (s *Service) QueueWebhooks(e *models.OutboxEvent) error {
+	delivery := models.WebhookDelivery{}
+	return delivery.QueueWebhooks(s.db, e)
+}
@@ -0,0 +1,183 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/models"
+)
+
+// batchSize is how many due deliveries one poll sends at most.
+const batchSize = 50
+
+// Dispatcher sends due deliveries. Several servers may run one on the same
+// database: each delivery is claimed by one of them at a time.
+type Dispatcher struct {
+	DB *gorm.DB
+	// Timeout bounds one attempt, PollInterval is how often due
+	// deliveries are looked for.
+	Timeout      time.Duration
+	PollInterval time.Duration
+	// A failed delivery is retried after MinBackoff, doubling per attempt
+	// up to MaxBackoff, and is dead after MaxAttempts.
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+
+	client *http.Client
+}
+
+// Run sends due deliveries until ctx ends. An attempt cut short by that is
+// not counted; the delivery is due again once its claim runs out.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.client = newClient(d.Timeout)
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.sendDue(ctx); err != nil && ctx.Err() == nil {
+			logger.Error(ctx, "cannot send webhooks", logger.Fields{"error": err})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newClient returns the client posting deliveries, each within timeout.
+func newClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		// A redirect is a failure, so a webhook cannot point elsewhere
+		// than it was checked to.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (d *Dispatcher) sendDue(ctx context.Context) error {
+	now := time.Now()
+	due, err := (&models.WebhookDelivery{}).FindDueDeliveries(d.DB, now, batchSize)
+	if err != nil {
+		return err
+	}
+	hooks := map[uint32]*models.Webhook{}
+	for i := range *due {
+		if ctx.Err() != nil {
+			return nil
+		}
+		delivery := &(*due)[i]
+		// The claim outlasts the attempt; should this server die, another
+		// one retries once it runs out.
+		claimed, err := delivery.ClaimDelivery(d.DB, now, time.Now().Add(2*d.Timeout))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		hook, ok := hooks[delivery.WebhookID]
+		if !ok {
+			hook, err = (&models.Webhook{}).FindWebhookByID(d.DB, delivery.WebhookID)
+			if gorm.IsRecordNotFoundError(err) {
+				// Deleted since, along with its deliveries
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			hooks[delivery.WebhookID] = hook
+		}
+		if err := d.send(ctx, hook, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send makes an attempt to deliver delivery to hook and records how it went.
+func (d *Dispatcher) send(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery) error {
+	status, err := d.post(ctx, hook, delivery)
+	if ctx.Err() != nil {
+		return nil
+	}
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatus = status
+	fields := logger.Fields{
+		"webhook_id":  hook.ID,
+		"delivery_id": delivery.ID,
+		"event":       delivery.Event,
+		"attempt":     delivery.Attempts,
+		"status":      status,
+	}
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		logger.Info(ctx, "webhook delivered", fields)
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = err.Error()
+		fields["error"] = err
+		logger.Error(ctx, "webhook delivery dead", fields)
+	default:
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+		fields["error"] = err
+		fields["retry_at"] = delivery.NextAttemptAt
+		logger.Warn(ctx, "webhook delivery failed", fields)
+	}
+	return delivery.RecordAttempt(d.DB)
+}
+
+// post sends delivery to hook and returns the HTTP status of the answer,
+// which must be 2xx.
+func (d *Dispatcher) post(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "reading-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, time.Now(), body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drained, so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns how long to wait after the attempt-th failure, with up
+// to a tenth more, so that deliveries failing together spread out.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.MinBackoff
+	for i := 1; i < attempt && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.MaxBackoff {
+		wait = d.MaxBackoff
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait)/10+1))
+}
@@ -0,0 +1,275 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/serg2013/reading/api/logger"
+	"github.com/serg2013/reading/api/models"
+)
+
+func init() {
+	logger.SetLevel(logger.ErrorLevel + 1)
+}
+
+const secret = "the webhook secret"
+
+// receiver is a webhook endpoint answering with the statuses queued, then
+// 200, and keeping what it was sent.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []received
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rec := &receiver{statuses: statuses}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.requests = append(rec.requests, received{r.Header.Clone(), body})
+		status := http.StatusOK
+		if len(rec.statuses) > 0 {
+			status, rec.statuses = rec.statuses[0], rec.statuses[1:]
+		}
+		if status == http.StatusFound {
+			http.Redirect(w, r, "/elsewhere", status)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+func (rec *receiver) received() []received {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]received(nil), rec.requests...)
+}
+
+// verify checks signature as a receiver should: the MAC of its timestamp
+// and body, and a timestamp within tolerance of now.
+func verify(secret, signature string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, v1 string
+	for _, part := range strings.Split(signature, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return errors.New("malformed signature")
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			v1 = kv[1]
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("no timestamp")
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return errors.New("timestamp too old")
+	}
+	if !hmac.Equal([]byte(v1), []byte(mac(secret, ts, body))) {
+		return errors.New("wrong signature")
+	}
+	return nil
+}
+
+// newTestDispatcher returns a dispatcher on an empty SQLite database and
+// queues a delivery of a book.created event to url.
+func newTestDispatcher(t *testing.T, url string) (*Dispatcher, *models.WebhookDelivery) {
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	hook := models.Webhook{URL: url, Secret: secret, Events: "book.created", CreatedBy: 1}
+	if err := db.Create(&hook).Error; err != nil {
+		t.Fatal(err)
+	}
+	delivery := models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		EventID:       "event-1",
+		Event:         "book.created",
+		Payload:       `{"id":"event-1","type":"book.created","data":{"id":1}}`,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := db.Create(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	d := &Dispatcher{
+		DB:          db,
+		Timeout:     5 * time.Second,
+		MinBackoff:  time.Minute,
+		MaxBackoff:  4 * time.Minute,
+		MaxAttempts: 3,
+		client:      newClient(5 * time.Second),
+	}
+	return d, &delivery
+}
+
+// stored reloads delivery.
+func stored(t *testing.T, d *Dispatcher, delivery *models.WebhookDelivery) models.WebhookDelivery {
+	t.Helper()
+	got := models.WebhookDelivery{}
+	if err := d.DB.Where("id = ?", delivery.ID).Take(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// makeDue moves the next attempt of delivery to now.
+func makeDue(t *testing.T, d *Dispatcher, delivery *models.WebhookDelivery) {
+	t.Helper()
+	if err := d.DB.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).UpdateColumn("next_attempt_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sendDue(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	if err := d.sendDue(context.Background()); err != nil {
+		t.Fatalf("sendDue: %v", err)
+	}
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	rec := newReceiver(t)
+	d, delivery := newTestDispatcher(t, rec.URL)
+	sendDue(t, d)
+
+	got := rec.received()
+	if len(got) != 1 {
+		t.Fatalf("%d requests received, want 1", len(got))
+	}
+	h, body := got[0].header, got[0].body
+	if string(body) != string(delivery.Payload) {
+		t.Errorf("body = %s, want the payload", body)
+	}
+	if h.Get(EventHeader) != "book.created" || h.Get(DeliveryHeader) != strconv.FormatUint(delivery.ID, 10) || h.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", h)
+	}
+	signature := h.Get(SignatureHeader)
+	now := time.Now()
+	if err := verify(secret, signature, body, now, 5*time.Minute); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if verify("another secret", signature, body, now, 5*time.Minute) == nil {
+		t.Error("signature verified with another secret")
+	}
+	if verify(secret, signature, append(body, ' '), now, 5*time.Minute) == nil {
+		t.Error("signature verified for another body")
+	}
+	if verify(secret, signature, body, now.Add(time.Hour), 5*time.Minute) == nil {
+		t.Error("signature verified an hour later")
+	}
+
+	if s := stored(t, d, delivery); s.Status != models.DeliveryDelivered || s.Attempts != 1 || s.LastStatus != 200 || s.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want delivered at the first attempt", s)
+	}
+	sendDue(t, d)
+	if n := len(rec.received()); n != 1 {
+		t.Errorf("%d requests received, want a delivered event sent once", n)
+	}
+}
+
+func TestDeliveryRetriesWithBackoff(t *testing.T) {
+	rec := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	d, delivery := newTestDispatcher(t, rec.URL)
+
+	for attempt, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+		before := time.Now()
+		sendDue(t, d)
+		s := stored(t, d, delivery)
+		if s.Status != models.DeliveryPending || s.Attempts != attempt+1 || s.LastStatus < 500 || s.LastError == "" {
+			t.Fatalf("after attempt %d delivery = %+v, want pending with the failure", attempt+1, s)
+		}
+		if retry := s.NextAttemptAt.Sub(before); retry < wait || retry > wait+wait/10+time.Second {
+			t.Errorf("attempt %d retried after %s, want %s and up to a tenth more", attempt+1, retry, wait)
+		}
+		// Not sent again before it is due
+		sendDue(t, d)
+		if n := len(rec.received()); n != attempt+1 {
+			t.Fatalf("%d requests received, want %d", n, attempt+1)
+		}
+		makeDue(t, d, delivery)
+	}
+	sendDue(t, d)
+	if s := stored(t, d, delivery); s.Status != models.DeliveryDelivered || s.Attempts != 3 || s.LastError != "" {
+		t.Errorf("delivery = %+v, want delivered at the third attempt", s)
+	}
+	// Every attempt carries the same event and delivery
+	for _, r := range rec.received() {
+		if r.header.Get(DeliveryHeader) != strconv.FormatUint(delivery.ID, 10) || string(r.body) != string(delivery.Payload) {
+			t.Errorf("attempt sent %v %s", r.header, r.body)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		got := d.backoff(attempt + 1)
+		if got < want || got > want+want/10 {
+			t.Errorf("backoff(%d) = %s, want %s and up to a tenth more", attempt+1, got, want)
+		}
+	}
+}
+
+func TestDeliveryDies(t *testing.T) {
+	// A redirect fails like an error, and is not followed
+	rec := newReceiver(t, http.StatusGone, http.StatusFound, http.StatusInternalServerError)
+	d, delivery := newTestDispatcher(t, rec.URL)
+
+	for i := 0; i < d.MaxAttempts; i++ {
+		makeDue(t, d, delivery)
+		sendDue(t, d)
+	}
+	s := stored(t, d, delivery)
+	if s.Status != models.DeliveryDead || s.Attempts != d.MaxAttempts || s.LastStatus != http.StatusInternalServerError || s.DeliveredAt != nil {
+		t.Fatalf("delivery = %+v, want dead after %d attempts", s, d.MaxAttempts)
+	}
+	if n := len(rec.received()); n != d.MaxAttempts {
+		t.Errorf("%d requests received, want %d", n, d.MaxAttempts)
+	}
+
+	makeDue(t, d, delivery)
+	sendDue(t, d)
+	if n := len(rec.received()); n != d.MaxAttempts {
+		t.Errorf("a dead delivery was sent again")
+	}
+
+	// Until redelivered by hand
+	if _, err := (&models.WebhookDelivery{}).Redeliver(d.DB, s.WebhookID, s.ID); err != nil {
+		t.Fatal(err)
+	}
+	sendDue(t, d)
+	if s := stored(t, d, delivery); s.Status != models.DeliveryDelivered || s.Attempts != 1 {
+		t.Errorf("redelivered = %+v, want delivered", s)
+	}
+}
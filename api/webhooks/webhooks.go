@@ -0,0 +1,45 @@
+// Package webhooks sends the events queued for webhook subscriptions, see
+// models.WebhookDelivery.
+//
+// Each event is POSTed as JSON with the headers
+//
+//	X-Webhook-Event: book.created
+//	X-Webhook-Delivery: 42
+//	X-Webhook-Signature: t=1700000000,v1=<hex>
+//
+// where v1 is the HMAC-SHA256, keyed with the webhook's secret, of the
+// timestamp t, a dot and the body. Receivers should recompute it and
+// refuse old timestamps. An event may arrive more than once, and after
+// later ones when it had to be retried; its id and created_at in the body
+// tell duplicates and the order of events.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Headers of a delivery.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Sign returns the signature header of body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, mac(secret, ts, body))
+}
+
+func mac(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}